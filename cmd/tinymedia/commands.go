@@ -0,0 +1,281 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/zzvanq/tinymedia/internal/query"
+	"github.com/zzvanq/tinymedia/pkg/meta/codec"
+	"github.com/zzvanq/tinymedia/pkg/meta/manager"
+)
+
+type command struct {
+	summary string
+	// setup registers the command flags and returns the function running it
+	// once they're parsed. The returned error is a usage error.
+	setup func(fs *flag.FlagSet, opts *runOptions) func(files []string) (int, error)
+}
+
+var commandNames = []string{"get", "set", "delete", "list", "strip", "copy", "apply", "export", "import", "find"}
+
+var commands = map[string]command{
+	"get": {
+		summary: "print the fields of a vendor, all of them unless -f is given",
+		setup: func(fs *flag.FlagSet, opts *runOptions) func([]string) (int, error) {
+			vendor := fs.String("v", "", "vendor, e.g. tinymeta, exif, xmp")
+			var fields listFlag
+			fs.Var(&fields, "f", "field to print, repeatable")
+
+			return func(files []string) (int, error) {
+				if *vendor == "" {
+					return 0, errVendorRequired
+				}
+				task := metaTask{vendor: *vendor, read: fields, readAll: len(fields) == 0}
+				return handleMeta(files, task, *opts), nil
+			}
+		},
+	},
+	"set": {
+		summary: "set fields of a vendor",
+		setup: func(fs *flag.FlagSet, opts *runOptions) func([]string) (int, error) {
+			vendor := fs.String("v", "", "vendor, e.g. tinymeta, exif, xmp")
+			var fields listFlag
+			fs.Var(&fields, "f", "field=value to set, repeatable, the value may be empty")
+
+			return func(files []string) (int, error) {
+				if *vendor == "" {
+					return 0, errVendorRequired
+				}
+				if len(fields) == 0 {
+					return 0, errFieldRequired
+				}
+
+				update := make(map[string]string, len(fields))
+				for _, f := range fields {
+					k, v, ok := strings.Cut(f, "=")
+					if !ok || k == "" {
+						return 0, fmt.Errorf("invalid field %q, want field=value", f)
+					}
+					update[k] = v
+				}
+				return handleMeta(files, metaTask{vendor: *vendor, update: update}, *opts), nil
+			}
+		},
+	},
+	"delete": {
+		summary: "delete fields of a vendor",
+		setup: func(fs *flag.FlagSet, opts *runOptions) func([]string) (int, error) {
+			vendor := fs.String("v", "", "vendor, e.g. tinymeta, exif, xmp")
+			var fields listFlag
+			fs.Var(&fields, "f", "field to delete, repeatable")
+
+			return func(files []string) (int, error) {
+				if *vendor == "" {
+					return 0, errVendorRequired
+				}
+				if len(fields) == 0 {
+					return 0, errFieldRequired
+				}
+				return handleMeta(files, metaTask{vendor: *vendor, delete: fields}, *opts), nil
+			}
+		},
+	},
+	"list": {
+		summary: "list the vendors present in the files",
+		setup: func(fs *flag.FlagSet, opts *runOptions) func([]string) (int, error) {
+			return func(files []string) (int, error) {
+				return handleMeta(files, metaTask{vendors: true}, *opts), nil
+			}
+		},
+	},
+	"strip": {
+		summary: "remove whole vendors, or all the metadata not needed for rendering",
+		setup: func(fs *flag.FlagSet, opts *runOptions) func([]string) (int, error) {
+			all := fs.Bool("all", false, "remove all the metadata not needed for rendering")
+			var vendors listFlag
+			fs.Var(&vendors, "v", "vendor to remove, repeatable")
+
+			return func(files []string) (int, error) {
+				if len(vendors) == 0 && !*all {
+					return 0, errors.New("either -v or -all is required")
+				}
+				return handleMeta(files, metaTask{strip: vendors, stripAll: *all}, *opts), nil
+			}
+		},
+	},
+	"copy": {
+		summary: "copy the metadata of a file into the others, across file types",
+		setup: func(fs *flag.FlagSet, opts *runOptions) func([]string) (int, error) {
+			from := fs.String("from", "", "file to copy the metadata from")
+			fs.Var(&opts.inputs.to, "to", "file to copy the metadata to, repeatable, in addition to the arguments")
+			var vendors, include, exclude listFlag
+			fs.Var(&vendors, "v", "vendor to copy, repeatable, all the ones both file types support by default")
+			fs.Var(&include, "include-field", "glob of the fields to copy, repeatable")
+			fs.Var(&exclude, "exclude-field", "glob of the fields to leave out, repeatable")
+
+			return func(files []string) (int, error) {
+				if *from == "" {
+					return 0, errors.New("-from is required")
+				}
+				copyOpts := manager.CopyOptions{Include: include, Exclude: exclude}
+				for _, v := range vendors {
+					copyOpts.Vendors = append(copyOpts.Vendors, codec.MetaCodecVendor(v))
+				}
+
+				copied, err := readSource(*from, copyOpts)
+				if err != nil {
+					if errors.Is(err, path.ErrBadPattern) {
+						return 0, err
+					}
+					fmt.Fprintf(os.Stderr, "%s: %v\n", *from, err)
+					return errorCode(err), nil
+				}
+				task := metaTask{copy: copied, copyStrict: len(vendors) > 0}
+				return handleMeta(files, task, *opts), nil
+			}
+		},
+	},
+	"apply": {
+		summary: "set and delete fields as listed by a CSV or JSON lines manifest, - for stdin",
+		setup: func(fs *flag.FlagSet, opts *runOptions) func([]string) (int, error) {
+			format := fs.String("format", "", "manifest format: csv or jsonl, by default told by the extension")
+			vendor := fs.String("v", "", "vendor of the rows not naming one")
+
+			return func(args []string) (int, error) {
+				if len(args) != 1 {
+					return 0, errors.New("a single manifest is required")
+				}
+				newWriter, ok := resultWriters[opts.output]
+				if !ok {
+					return 0, fmt.Errorf("unknown output format %q", opts.output)
+				}
+				f, err := manifestFormat(args[0], *format)
+				if err != nil {
+					return 0, err
+				}
+
+				tasks, err := readManifest(args[0], f, *vendor, os.Stdin)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+					return exitFailure, nil
+				}
+				return runTasks(tasks, newWriter(os.Stdout), *opts), nil
+			}
+		},
+	},
+	"export": {
+		summary: "walk the trees into a JSON lines or CSV index of the vendor fields, updating the -index one",
+		setup: func(fs *flag.FlagSet, opts *runOptions) func([]string) (int, error) {
+			vendor := fs.String("v", "", "vendor, e.g. tinymeta, exif, xmp")
+			index := fs.String("index", "", "index to update, skipping the files unchanged since, stdout by default")
+			format := fs.String("format", "", "index format: csv or jsonl, by default told by the extension")
+
+			return func(files []string) (int, error) {
+				if *vendor == "" {
+					return 0, errVendorRequired
+				}
+				f := *format
+				if f == "" && *index == "" {
+					f = manifestJSONL
+				}
+				f, err := manifestFormat(*index, f)
+				if err != nil {
+					return 0, err
+				}
+				return exportIndex(files, *vendor, *index, f, *opts), nil
+			}
+		},
+	},
+	"import": {
+		summary: "set the vendor fields of the files to the ones of an exported index",
+		setup: func(fs *flag.FlagSet, opts *runOptions) func([]string) (int, error) {
+			format := fs.String("format", "", "index format: csv or jsonl, by default told by the extension")
+
+			return func(args []string) (int, error) {
+				if len(args) != 1 {
+					return 0, errors.New("a single index is required")
+				}
+				newWriter, ok := resultWriters[opts.output]
+				if !ok {
+					return 0, fmt.Errorf("unknown output format %q", opts.output)
+				}
+				f, err := manifestFormat(args[0], *format)
+				if err != nil {
+					return 0, err
+				}
+
+				entries, err := readIndex(args[0], f)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+					return exitFailure, nil
+				}
+				return runTasks(importTasks(entries), newWriter(os.Stdout), *opts), nil
+			}
+		},
+	},
+	"find": {
+		summary: "print the paths of the files whose fields match an expression, e.g. 'artist == \"X\" && year >= 2020'",
+		setup: func(fs *flag.FlagSet, opts *runOptions) func([]string) (int, error) {
+			vendor := fs.String("v", string(codec.TinyMetaVendor), "vendor of the fields")
+			nul := fs.Bool("0", false, "end the paths with NUL instead of a newline")
+
+			return func(args []string) (int, error) {
+				if len(args) == 0 {
+					return 0, errors.New("an expression is required")
+				}
+				filter, err := query.Parse(args[0])
+				if err != nil {
+					return 0, err
+				}
+				paths := args[1:]
+				if len(paths) == 0 && !opts.inputs.given() {
+					paths = []string{"."}
+				}
+				return findFiles(paths, *vendor, filter, *nul, *opts), nil
+			}
+		},
+	},
+}
+
+var (
+	errVendorRequired = errors.New("-v is required")
+	errFieldRequired  = errors.New("at least one -f is required")
+)
+
+func (c command) parser(name string) (*flag.FlagSet, *runOptions, func([]string) (int, error)) {
+	fs := flag.NewFlagSet("tinymedia "+name, flag.ExitOnError)
+	opts := addRunFlags(fs)
+	run := c.setup(fs, opts)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: tinymedia %s [flags] files...\n\n%s\n\n", name, c.summary)
+		fs.PrintDefaults()
+	}
+	return fs, opts, run
+}
+
+func (c command) run(name string, args []string) int {
+	fs, opts, run := c.parser(name)
+	fs.Parse(args)
+
+	if fs.NArg() == 0 && !opts.inputs.given() {
+		return usageError(fs, errors.New("no input files"))
+	}
+	if err := opts.validate(); err != nil {
+		return usageError(fs, err)
+	}
+	code, err := run(fs.Args())
+	if err != nil {
+		return usageError(fs, err)
+	}
+	return code
+}
+
+func usageError(fs *flag.FlagSet, err error) int {
+	fmt.Fprintln(os.Stderr, err)
+	fs.Usage()
+	return exitUsage
+}
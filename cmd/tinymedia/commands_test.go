@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_commands_SetGet(t *testing.T) {
+	testFile := filepath.Join("./", "test.jpg")
+	createTestJPEG(t, testFile, "tinymeta", nil)
+	defer os.Remove(testFile)
+
+	cmd := exec.Command("./tinymedia.test", "set",
+		"-v", "tinymeta",
+		"-f", "title=Hello, World",
+		"-f", "a=b=c",
+		"-f", "comment=",
+		testFile,
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("set failed: %v\noutput: %s", err, output)
+	}
+
+	cmd = exec.Command("./tinymedia.test", "get",
+		"-v", "tinymeta",
+		"-f", "title",
+		"-f", "a",
+		"-f", "comment",
+		testFile,
+	)
+	output, err = cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("get failed: %v\noutput: %s", err, output)
+	}
+
+	got := string(output)
+	for _, want := range []string{
+		kvQuote("title", "Hello, World"),
+		kvQuote("a", "b=c"),
+		kvQuote("comment", ""),
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %s in:\n%s", want, got)
+		}
+	}
+}
+
+func Test_commands_DeleteListStrip(t *testing.T) {
+	testFile := filepath.Join("./", "test.jpg")
+	createTestJPEG(t, testFile, "tinymeta", map[string]string{
+		"artist": "Test Artist",
+		"title":  "Test Title",
+	})
+	defer os.Remove(testFile)
+
+	cmd := exec.Command("./tinymedia.test", "delete", "-v", "tinymeta", "-f", "artist", testFile)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("delete failed: %v\noutput: %s", err, output)
+	}
+
+	cmd = exec.Command("./tinymedia.test", "get", "-v", "tinymeta", testFile)
+	output, _ := cmd.CombinedOutput()
+	want := "File=" + testFile + "\n" + kvQuote("title", "Test Title") + "\n\n"
+	if string(output) != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, output)
+	}
+
+	cmd = exec.Command("./tinymedia.test", "list", testFile)
+	output, _ = cmd.CombinedOutput()
+	if !strings.Contains(string(output), `Vendor="tinymeta"`) {
+		t.Errorf("tinymeta not listed:\n%s", output)
+	}
+
+	cmd = exec.Command("./tinymedia.test", "strip", "-v", "tinymeta", testFile)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("strip failed: %v\noutput: %s", err, output)
+	}
+
+	cmd = exec.Command("./tinymedia.test", "list", testFile)
+	output, _ = cmd.CombinedOutput()
+	if strings.Contains(string(output), "Vendor=") {
+		t.Errorf("tinymeta not stripped:\n%s", output)
+	}
+}
+
+func Test_commands_Copy(t *testing.T) {
+	src := filepath.Join("./", "test1.jpg")
+	dst := filepath.Join("./", "test2.jpg")
+	createTestJPEG(t, src, "tinymeta", map[string]string{"artist": "Source Artist"})
+	defer os.Remove(src)
+	createTestJPEG(t, dst, "tinymeta", map[string]string{"title": "Kept Title"})
+	defer os.Remove(dst)
+
+	cmd := exec.Command("./tinymedia.test", "copy", "-from", src, dst)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("copy failed: %v\noutput: %s", err, output)
+	}
+
+	cmd = exec.Command("./tinymedia.test", "get", "-v", "tinymeta", dst)
+	output, _ := cmd.CombinedOutput()
+	got := string(output)
+	if !strings.Contains(got, kvQuote("artist", "Source Artist")) || !strings.Contains(got, kvQuote("title", "Kept Title")) {
+		t.Errorf("metadata not copied:\n%s", got)
+	}
+}
+
+func Test_commands_CopyAcrossTypes(t *testing.T) {
+	src := filepath.Join("./", "test1.jpg")
+	dst := filepath.Join("./", "test2.png")
+	createTestJPEG(t, src, "tinymeta", map[string]string{"artist": "Source Artist", "note": "n"})
+	defer os.Remove(src)
+	png := []byte{
+		0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A,
+		0x00, 0x00, 0x00, 0x0D, 'I', 'H', 'D', 'R',
+		0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 0x08, 0x00, 0x00, 0x00, 0x00,
+		0x3A, 0x7E, 0x9B, 0x55,
+		0x00, 0x00, 0x00, 0x00, 'I', 'E', 'N', 'D', 0xAE, 0x42, 0x60, 0x82,
+	}
+	os.WriteFile(dst, png, 0644)
+	defer os.Remove(dst)
+
+	cmd := exec.Command("./tinymedia.test", "copy", "--from", src, "--to", dst, "-exclude-field", "note")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("copy failed: %v\noutput: %s", err, output)
+	}
+
+	cmd = exec.Command("./tinymedia.test", "get", "-v", "tinymeta", dst)
+	output, _ := cmd.CombinedOutput()
+	got := string(output)
+	if !strings.Contains(got, kvQuote("artist", "Source Artist")) || strings.Contains(got, `"note"`) {
+		t.Errorf("want only artist copied, got:\n%s", got)
+	}
+}
+
+func Test_commands_GIF(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "test.gif")
+	gif := append([]byte("GIF89a"), 1, 0, 1, 0, 0, 0, 0)
+	gif = append(gif, 0x2C, 0, 0, 0, 0, 1, 0, 1, 0, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3B)
+	os.WriteFile(testFile, gif, 0644)
+
+	cmd := exec.Command("./tinymedia.test", "set", "-v", "tinymeta", "-f", "source=sticker pack", testFile)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("set failed: %v\noutput: %s", err, output)
+	}
+
+	output, _ := exec.Command("./tinymedia.test", "get", "-v", "tinymeta", testFile).CombinedOutput()
+	if !strings.Contains(string(output), kvQuote("source", "sticker pack")) {
+		t.Errorf("metadata not set:\n%s", output)
+	}
+	data, _ := os.ReadFile(testFile)
+	if !strings.HasSuffix(string(data), string(gif[13:])) {
+		t.Errorf("image data changed: %v", data)
+	}
+}
+
+func Test_commands_WebP(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "test.webp")
+	vp8l := []byte("VP8L\x05\x00\x00\x00\x2F\x00\x00\x00\x00\x00")
+	webp := append([]byte("RIFF\x12\x00\x00\x00WEBP"), vp8l...)
+	os.WriteFile(testFile, webp, 0644)
+
+	cmd := exec.Command("./tinymedia.test", "set", "-v", "xmp", "-f", "dc:title=sticker", testFile)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("set failed: %v\noutput: %s", err, output)
+	}
+
+	output, _ := exec.Command("./tinymedia.test", "get", "-v", "xmp", testFile).CombinedOutput()
+	if !strings.Contains(string(output), kvQuote("dc:title", "sticker")) {
+		t.Errorf("metadata not set:\n%s", output)
+	}
+	data, _ := os.ReadFile(testFile)
+	if string(data[12:16]) != "VP8X" || !bytes.Contains(data, vp8l) {
+		t.Errorf("not converted to the extended format: %v", data)
+	}
+}
+
+func Test_commands_TIFF(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "test.dng")
+	// a 1x1 image whose single strip follows the 3 entries IFD0
+	tiff := []byte("II*\x00\x08\x00\x00\x00\x03\x00")
+	tiff = append(tiff, 0x00, 0x01, 0x03, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00)
+	tiff = append(tiff, 0x11, 0x01, 0x04, 0x00, 0x01, 0x00, 0x00, 0x00, 0x32, 0x00, 0x00, 0x00)
+	tiff = append(tiff, 0x17, 0x01, 0x04, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00)
+	tiff = append(tiff, 0x00, 0x00, 0x00, 0x00, 0xAB)
+	os.WriteFile(testFile, tiff, 0644)
+
+	cmd := exec.Command("./tinymedia.test", "set", "-v", "tinymeta", "-f", "source=scanner", testFile)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("set failed: %v\noutput: %s", err, output)
+	}
+
+	output, _ := exec.Command("./tinymedia.test", "get", "-v", "tinymeta", testFile).CombinedOutput()
+	if !strings.Contains(string(output), kvQuote("source", "scanner")) {
+		t.Errorf("metadata not set:\n%s", output)
+	}
+	data, _ := os.ReadFile(testFile)
+	if !bytes.HasPrefix(data[8:], tiff[8:]) {
+		t.Errorf("original IFD0 or strip changed: %v", data)
+	}
+}
+
+func Test_commands_MP4(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "test.mp4")
+	mp4 := []byte("\x00\x00\x00\x10ftypisom\x00\x00\x00\x00\x00\x00\x00\x0Dmdatmedia")
+	os.WriteFile(testFile, mp4, 0644)
+
+	cmd := exec.Command("./tinymedia.test", "set", "-v", "tinymeta", "-f", "source=phone", testFile)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("set failed: %v\noutput: %s", err, output)
+	}
+
+	output, _ := exec.Command("./tinymedia.test", "get", "-v", "tinymeta", testFile).CombinedOutput()
+	if !strings.Contains(string(output), kvQuote("source", "phone")) {
+		t.Errorf("metadata not set:\n%s", output)
+	}
+	data, _ := os.ReadFile(testFile)
+	if !bytes.HasSuffix(data, mp4[16:]) || !bytes.Contains(data, []byte("uuid")) {
+		t.Errorf("uuid box not inserted before the media data: %v", data)
+	}
+}
+
+func Test_commands_MP3(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "test.mp3")
+	audio := []byte{0xFF, 0xFB, 0x90, 0x00, 0x00}
+	os.WriteFile(testFile, audio, 0644)
+
+	cmd := exec.Command("./tinymedia.test", "set", "-v", "id3", "-f", "TIT2=Episode 1", "-f", "show=tinymedia", testFile)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("set failed: %v\noutput: %s", err, output)
+	}
+
+	output, _ := exec.Command("./tinymedia.test", "get", "-v", "id3", testFile).CombinedOutput()
+	if !strings.Contains(string(output), kvQuote("TIT2", "Episode 1")) || !strings.Contains(string(output), kvQuote("show", "tinymedia")) {
+		t.Errorf("metadata not set:\n%s", output)
+	}
+	data, _ := os.ReadFile(testFile)
+	if !bytes.HasPrefix(data, []byte("ID3")) || !bytes.HasSuffix(data, audio) {
+		t.Errorf("tag not added in front of the audio: %v", data)
+	}
+}
+
+func Test_commands_UsageErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "unknown command", args: []string{"frobnicate"}, want: "unknown command"},
+		{name: "no files", args: []string{"get", "-v", "tinymeta"}, want: "no input files"},
+		{name: "no vendor", args: []string{"get", "test.jpg"}, want: "-v is required"},
+		{name: "invalid field", args: []string{"set", "-v", "tinymeta", "-f", "title", "test.jpg"}, want: "want field=value"},
+		{name: "nothing to strip", args: []string{"strip", "test.jpg"}, want: "either -v or -all"},
+		{name: "copy without source", args: []string{"copy", "test.jpg"}, want: "-from is required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := exec.Command("./tinymedia.test", tt.args...).CombinedOutput()
+
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) || exitErr.ExitCode() != 2 {
+				t.Errorf("want exit code 2, got: %v", err)
+			}
+			if !strings.Contains(string(output), tt.want) {
+				t.Errorf("want %q in:\n%s", tt.want, output)
+			}
+		})
+	}
+}
+
+func Test_commands_Help(t *testing.T) {
+	output, err := exec.Command("./tinymedia.test", "help", "set").CombinedOutput()
+	if err != nil {
+		t.Fatalf("help failed: %v\noutput: %s", err, output)
+	}
+	if !strings.Contains(string(output), "Usage: tinymedia set") || !strings.Contains(string(output), "-f value") {
+		t.Errorf("wrong help:\n%s", output)
+	}
+}
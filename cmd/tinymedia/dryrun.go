@@ -0,0 +1,114 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+
+	"github.com/zzvanq/tinymedia/pkg/meta/manager"
+)
+
+// fieldChange is a field the task changes, Before or After is nil when the
+// field is missing. A vendor the file type can't decode is reported as a
+// whole, without Field, with an empty value when it's present.
+type fieldChange struct {
+	Vendor string  `json:"vendor"`
+	Field  string  `json:"field,omitempty"`
+	Before *string `json:"before"`
+	After  *string `json:"after"`
+}
+
+func (c fieldChange) String() string {
+	name := strconv.Quote(c.Vendor)
+	if c.Field != "" {
+		name += " " + strconv.Quote(c.Field)
+	}
+	return name + ": " + c.values()
+}
+
+func (c fieldChange) values() string {
+	value := func(v *string) string {
+		if v == nil {
+			return "(none)"
+		}
+		if c.Field == "" {
+			return "(present)"
+		}
+		return strconv.Quote(*v)
+	}
+	return value(c.Before) + " -> " + value(c.After)
+}
+
+// snapshot reads the fields of every vendor present in the file, the ones
+// of vendors it can't decode are nil.
+func snapshot(metaManager manager.MetaManager) (map[string]map[string]string, error) {
+	vendors, err := metaManager.Vendors()
+	if err != nil {
+		return nil, err
+	}
+
+	meta := make(map[string]map[string]string, len(vendors))
+	for _, v := range vendors {
+		fields, err := metaManager.Fields(v)
+		if err != nil && !manager.IsVendorNotSupported(err) {
+			return nil, err
+		}
+		meta[string(v)] = fields
+	}
+	return meta, nil
+}
+
+// diffMeta returns the changes from before to after sorted by vendor and field.
+func diffMeta(before, after map[string]map[string]string) []fieldChange {
+	var changes []fieldChange
+	vendors := slices.Sorted(maps.Keys(before))
+	for v := range after {
+		if _, ok := before[v]; !ok {
+			vendors = append(vendors, v)
+		}
+	}
+	slices.Sort(vendors)
+
+	for _, v := range vendors {
+		b, inBefore := before[v]
+		a, inAfter := after[v]
+		if (inBefore && b == nil) || (inAfter && a == nil) {
+			if inBefore != inAfter {
+				changes = append(changes, fieldChange{Vendor: v, Before: presence(inBefore), After: presence(inAfter)})
+			}
+			continue
+		}
+
+		fields := slices.Sorted(maps.Keys(b))
+		for k := range a {
+			if _, ok := b[k]; !ok {
+				fields = append(fields, k)
+			}
+		}
+		slices.Sort(fields)
+
+		for _, k := range fields {
+			bv, inB := b[k]
+			av, inA := a[k]
+			if inB == inA && bv == av {
+				continue
+			}
+			c := fieldChange{Vendor: v, Field: k}
+			if inB {
+				c.Before = &bv
+			}
+			if inA {
+				c.After = &av
+			}
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
+
+func presence(present bool) *string {
+	if !present {
+		return nil
+	}
+	return new(string)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_diffMeta(t *testing.T) {
+	before := map[string]map[string]string{
+		"tinymeta": {"artist": "a", "title": "t"},
+		"JFIF":     nil,
+	}
+	after := map[string]map[string]string{
+		"tinymeta": {"artist": "b", "album": "c", "title": "t"},
+	}
+
+	var got []string
+	for _, c := range diffMeta(before, after) {
+		got = append(got, c.String())
+	}
+	want := []string{
+		`"JFIF": (present) -> (none)`,
+		`"tinymeta" "album": (none) -> "c"`,
+		`"tinymeta" "artist": "a" -> "b"`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+}
+
+func Test_handleMeta_DryRun(t *testing.T) {
+	testFile := filepath.Join("./", "test.jpg")
+	createTestJPEG(t, testFile, "tinymeta", map[string]string{
+		"artist": "Test Artist",
+	})
+	defer os.Remove(testFile)
+	original, _ := os.ReadFile(testFile)
+
+	cmd := exec.Command("./tinymedia.test", "set", "-dry-run", "-v", "tinymeta", "-f", "artist=New", "-f", "title=T", testFile)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("dry run failed: %v\noutput: %s", err, output)
+	}
+
+	want := "File=test.jpg\n" +
+		`Change="tinymeta" "artist": "Test Artist" -> "New"` + "\n" +
+		`Change="tinymeta" "title": (none) -> "T"` + "\n\n"
+	if string(output) != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, output)
+	}
+	if data, _ := os.ReadFile(testFile); !bytes.Equal(data, original) {
+		t.Errorf("file changed by a dry run")
+	}
+}
+
+func Test_handleMeta_Backup(t *testing.T) {
+	tests := []struct {
+		name    string
+		flag    string
+		suffix  string
+		inPlace bool
+	}{
+		{name: "default suffix", flag: "-backup", suffix: ".bak"},
+		{name: "suffix", flag: "-backup=.orig", suffix: ".orig"},
+		// the original is copied, then updated in place
+		{name: "in place copy", flag: "-backup", suffix: ".bak", inPlace: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testFile := filepath.Join("./", "test.jpg")
+			createTestJPEG(t, testFile, "tinymeta", map[string]string{
+				"artist": "Test Artist",
+			})
+			defer os.Remove(testFile)
+			defer os.Remove(testFile + tt.suffix)
+			if tt.inPlace {
+				cmd := exec.Command("./tinymedia.test", "set", "-pad", "512", "-v", "tinymeta", "-f", "title=Title", testFile)
+				if output, err := cmd.CombinedOutput(); err != nil {
+					t.Fatalf("padding failed: %v\noutput: %s", err, output)
+				}
+			}
+			original, _ := os.ReadFile(testFile)
+			info, _ := os.Stat(testFile)
+
+			args := []string{"set", tt.flag, "-v", "tinymeta", "-f", "artist=New", testFile}
+			if tt.inPlace {
+				args = append([]string{"set", "-in-place"}, args[1:]...)
+			}
+			cmd := exec.Command("./tinymedia.test", args...)
+			if output, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("set failed: %v\noutput: %s", err, output)
+			}
+
+			if data, _ := os.ReadFile(testFile + tt.suffix); !bytes.Equal(data, original) {
+				t.Errorf("want backup: %v, got: %v", original, data)
+			}
+			backup, _ := os.Stat(testFile + tt.suffix)
+			updated, _ := os.Stat(testFile)
+			if tt.inPlace && (os.SameFile(info, backup) || !os.SameFile(info, updated)) {
+				t.Errorf("want the original updated in place and copied as the backup")
+			}
+			if !tt.inPlace && !os.SameFile(info, backup) {
+				t.Errorf("want the original linked as the backup")
+			}
+			if data, _ := os.ReadFile(testFile); bytes.Equal(data, original) {
+				t.Errorf("file not updated")
+			}
+		})
+	}
+}
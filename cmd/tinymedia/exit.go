@@ -0,0 +1,99 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"runtime"
+
+	fileUpdate "github.com/zzvanq/tinymedia/internal/file"
+	"github.com/zzvanq/tinymedia/pkg/file"
+	"github.com/zzvanq/tinymedia/pkg/meta"
+	"github.com/zzvanq/tinymedia/pkg/meta/manager"
+)
+
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+	// the file type, or the vendor for the file type, is not supported
+	exitUnsupported   = 3
+	exitCorrupted     = 4
+	exitMissingVendor = 5
+	// some of the files failed, the rest succeeded
+	exitPartial = 6
+)
+
+// runOptions are the flags shared by all the commands.
+type runOptions struct {
+	output   string
+	failFast bool
+	jobs     int
+	stream   bool
+	progress bool
+	inputs   inputOptions
+	write    writeOptions
+}
+
+type writeOptions struct {
+	update  fileUpdate.UpdateOptions
+	inPlace bool
+	padding int
+	dryRun  bool
+}
+
+func addRunFlags(fs *flag.FlagSet) *runOptions {
+	opts := &runOptions{}
+	fs.StringVar(&opts.output, "o", "text", "output format: text, json, ndjson or csv")
+	fs.BoolVar(&opts.failFast, "fail-fast", false, "stop at the first failed file, all the files are processed despite failures by default")
+	fs.IntVar(&opts.jobs, "j", runtime.NumCPU(), "number of files processed concurrently")
+	fs.BoolVar(&opts.stream, "stream", false, "emit the results as they're ready instead of in input order")
+	fs.BoolVar(&opts.progress, "progress", false, "report the progress and a summary on stderr")
+	fs.BoolVar(&opts.inputs.recursive, "r", false, "walk the directories, skipping files of unsupported types")
+	fs.Var(&opts.inputs.include, "include", "glob of the walked files to process, repeatable")
+	fs.Var(&opts.inputs.exclude, "exclude", "glob of the walked files and directories to leave out, repeatable")
+	fs.StringVar(&opts.inputs.symlinks, "symlinks", symlinksSkip, "links met while walking: skip or follow")
+	fs.StringVar(&opts.inputs.filesFrom, "files-from", "", "file listing the inputs by line or NUL, - for stdin")
+	fs.BoolVar(&opts.write.update.FollowSymlinks, "follow-symlinks", false, "update the files links point to instead of failing")
+	fs.BoolVar(&opts.write.update.PreserveTimes, "preserve-times", false, "keep the modification time of updated files")
+	fs.BoolVar(&opts.write.inPlace, "in-place", false, "overwrite the metadata in place when it fits the padding")
+	fs.IntVar(&opts.write.padding, "pad", 0, "bytes of padding to reserve when a file is rewritten")
+	fs.BoolVar(&opts.write.dryRun, "dry-run", false, "report the changes to the fields without writing the files")
+	fs.Var((*backupFlag)(&opts.write.update.Backup), "backup", "keep the original beside the updated file, -backup=suffix to set the suffix (default \""+defaultBackupSuffix+"\")")
+	return opts
+}
+
+func (o runOptions) validate() error {
+	if o.jobs < 1 {
+		return errors.New("-j must be at least 1")
+	}
+	if o.write.padding < 0 || o.write.padding > manager.MaxPadding {
+		return fmt.Errorf("-pad must be between 0 and %d", manager.MaxPadding)
+	}
+	return o.inputs.validate()
+}
+
+func errorCode(err error) int {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, file.ErrUnsupportedFileType),
+		errors.Is(err, meta.ErrVendorNotSupported),
+		errors.Is(err, meta.ErrNotSupported):
+		return exitUnsupported
+	case errors.Is(err, meta.ErrNotFound):
+		return exitMissingVendor
+	case errors.Is(err, meta.ErrCorrupted),
+		errors.Is(err, meta.ErrInvalid),
+		errors.Is(err, gzip.ErrHeader),
+		errors.Is(err, gzip.ErrChecksum),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.As(err, &syntaxErr),
+		errors.As(err, &typeErr):
+		return exitCorrupted
+	}
+	return exitFailure
+}
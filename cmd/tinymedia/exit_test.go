@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_exitCodes(t *testing.T) {
+	valid := filepath.Join("./", "test.jpg")
+	createTestJPEG(t, valid, "tinymeta", map[string]string{"artist": "a"})
+	defer os.Remove(valid)
+
+	empty := filepath.Join("./", "test1.jpg")
+	createTestJPEG(t, empty, "tinymeta", nil)
+	defer os.Remove(empty)
+
+	unsupported := filepath.Join("./", "test.txt")
+	os.WriteFile(unsupported, []byte("plain text"), 0644)
+	defer os.Remove(unsupported)
+
+	corrupted := filepath.Join("./", "test2.jpg")
+	os.WriteFile(corrupted, []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x10, 0x01}, 0644)
+	defer os.Remove(corrupted)
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+	}{
+		{name: "ok", args: []string{"get", "-v", "tinymeta", valid}, wantCode: exitOK},
+		{name: "unsupported type", args: []string{"get", "-v", "tinymeta", unsupported}, wantCode: exitUnsupported},
+		{name: "unsupported vendor", args: []string{"get", "-v", "nope", valid}, wantCode: exitUnsupported},
+		{name: "corrupted", args: []string{"get", "-v", "tinymeta", corrupted}, wantCode: exitCorrupted},
+		{name: "missing vendor", args: []string{"get", "-v", "tinymeta", empty}, wantCode: exitMissingVendor},
+		{name: "partial", args: []string{"get", "-v", "tinymeta", valid, empty}, wantCode: exitPartial},
+		{name: "not found", args: []string{"get", "-v", "tinymeta", "missing.jpg"}, wantCode: exitFailure},
+		{name: "usage", args: []string{"get", "-v", "tinymeta", "-pad", "-1", valid}, wantCode: exitUsage},
+		{name: "padding too large", args: []string{"set", "-v", "tinymeta", "-f", "a=b", "-pad", "100000", valid}, wantCode: exitUsage},
+		{name: "no jobs", args: []string{"get", "-v", "tinymeta", "-j", "0", valid}, wantCode: exitUsage},
+		{name: "legacy usage", args: []string{"-i", valid, "-m", "artist"}, wantCode: exitUsage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := exec.Command("./tinymedia.test", tt.args...).Run()
+
+			code := exitOK
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				code = exitErr.ExitCode()
+			}
+			if code != tt.wantCode {
+				t.Errorf("want exit code: %d, got: %d", tt.wantCode, code)
+			}
+		})
+	}
+}
+
+func Test_exitCodes_FailFast(t *testing.T) {
+	valid := filepath.Join("./", "test.jpg")
+	createTestJPEG(t, valid, "tinymeta", map[string]string{"artist": "a"})
+	defer os.Remove(valid)
+
+	cmd := exec.Command("./tinymedia.test", "get", "-v", "tinymeta", "-fail-fast", "-j", "1", "missing.jpg", valid)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != exitFailure {
+		t.Errorf("want exit code %d, got: %v", exitFailure, err)
+	}
+	if !strings.HasPrefix(stderr.String(), "missing.jpg: ") {
+		t.Errorf("want the file name in the error, got:\n%s", stderr.String())
+	}
+	if len(output) > 0 {
+		t.Errorf("files after the failed one must be skipped, got:\n%s", output)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_commands_Find(t *testing.T) {
+	dir := t.TempDir()
+	recent := filepath.Join(dir, "recent.jpg")
+	old := filepath.Join(dir, "old.jpg")
+	untagged := filepath.Join(dir, "untagged.jpg")
+	createTestJPEG(t, recent, "tinymeta", map[string]string{"artist": "X", "year": "2021"})
+	createTestJPEG(t, old, "tinymeta", map[string]string{"artist": "X", "year": "1999"})
+	createTestJPEG(t, untagged, "tinymeta", nil)
+
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{expr: `artist == "X" && year >= 2020`, want: []string{recent}},
+		{expr: `artist =~ "^X"`, want: []string{old, recent}},
+		{expr: `!has(artist)`, want: []string{untagged}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			cmd := exec.Command("./tinymedia.test", "find", "-j", "1", tt.expr, dir)
+			output, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("find failed: %v\noutput: %s", err, output)
+			}
+			want := strings.Join(tt.want, "\n") + "\n"
+			if string(output) != want {
+				t.Errorf("want:\n%s\ngot:\n%s", want, output)
+			}
+		})
+	}
+
+	cmd := exec.Command("./tinymedia.test", "find", `artist ==`, dir)
+	output, _ := cmd.CombinedOutput()
+	if code := cmd.ProcessState.ExitCode(); code != exitUsage || !strings.Contains(string(output), "syntax error") {
+		t.Errorf("want exit code: %d and a syntax error, got: %d\n%s", exitUsage, code, output)
+	}
+
+	list := filepath.Join(t.TempDir(), "list.txt")
+	if err := os.WriteFile(list, []byte(recent+"\n"), 0644); err != nil {
+		t.Fatalf("failed to write the list: %v", err)
+	}
+	cmd = exec.Command("./tinymedia.test", "find", "-files-from", list)
+	output, _ = cmd.CombinedOutput()
+	if code := cmd.ProcessState.ExitCode(); code != exitUsage || !strings.Contains(string(output), "an expression is required") {
+		t.Errorf("want exit code: %d and a missing expression error, got: %d\n%s", exitUsage, code, output)
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	fileUpdate "github.com/zzvanq/tinymedia/internal/file"
+)
+
+// indexEntry is the metadata of a vendor of a file. Export skips the files
+// whose size and modification time match their entry.
+type indexEntry struct {
+	File   string            `json:"file"`
+	Size   int64             `json:"size"`
+	Mtime  time.Time         `json:"mtime"`
+	Type   string            `json:"type"`
+	Vendor string            `json:"vendor"`
+	Fields map[string]string `json:"fields"`
+
+	// row is the line of the index the entry starts at
+	row int
+}
+
+var indexHeader = []string{"file", "size", "mtime", "type", "vendor", "field", "value"}
+
+func (e indexEntry) unchanged(info fs.FileInfo, vendor string) bool {
+	return e.Vendor == vendor && e.Size == info.Size() && e.Mtime.Equal(info.ModTime())
+}
+
+// exportIndex reads the vendor fields of the files into the index, from
+// the previous one for the unchanged files.
+func exportIndex(paths []string, vendor, index, format string, opts runOptions) int {
+	opts.inputs.recursive = true
+	inputs, err := expandInputs(paths, opts.inputs, os.Stdin)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	if slices.ContainsFunc(inputs, func(in input) bool { return in.path == stdinInput }) {
+		fmt.Fprintln(os.Stderr, "stdin can't be exported")
+		return exitUsage
+	}
+
+	previous := make(map[string]indexEntry)
+	if index != "" {
+		entries, err := readIndex(index, format)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", index, err)
+			return exitFailure
+		}
+		for _, e := range entries {
+			previous[e.File] = e
+		}
+	}
+
+	reused := make(map[string]*indexEntry)
+	infos := make(map[string]fs.FileInfo)
+	var tasks []fileTask
+	for _, in := range inputs {
+		info, err := os.Stat(in.path)
+		if err == nil {
+			if e, ok := previous[in.path]; ok && e.unchanged(info, vendor) {
+				reused[in.path] = &e
+				continue
+			}
+			infos[in.path] = info
+		}
+		task := metaTask{vendor: vendor, readAll: true, optional: true}
+		tasks = append(tasks, fileTask{in: in, task: task})
+	}
+
+	collected := &collectWriter{}
+	code := runTasks(tasks, collected, opts)
+	for _, r := range collected.results {
+		info, ok := infos[r.File]
+		if r.err != nil || !ok {
+			continue
+		}
+		reused[r.File] = &indexEntry{
+			File: r.File, Size: info.Size(), Mtime: info.ModTime(),
+			Type: r.Type, Vendor: vendor, Fields: r.Fields,
+		}
+	}
+
+	// failed and skipped files are left out
+	var entries []*indexEntry
+	for _, in := range inputs {
+		if e, ok := reused[in.path]; ok {
+			entries = append(entries, e)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := writeIndex(&buf, format, entries); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	if err := writeIndexFile(index, buf.Bytes()); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", index, err)
+		return exitFailure
+	}
+	return code
+}
+
+// writeIndexFile replaces the index, writing to stdout if there's none.
+func writeIndexFile(index string, data []byte) error {
+	if index == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	if _, err := os.Stat(index); errors.Is(err, fs.ErrNotExist) {
+		return os.WriteFile(index, data, 0644)
+	}
+	return fileUpdate.UpdateFile(bytes.NewReader(data), index)
+}
+
+// importTasks sets the vendor fields of the files to the index ones.
+func importTasks(entries []indexEntry) []fileTask {
+	tasks := make([]fileTask, len(entries))
+	for i, e := range entries {
+		ft := fileTask{
+			in:   input{path: e.File},
+			task: metaTask{vendor: e.Vendor, update: e.Fields, replace: true},
+			row:  e.row,
+		}
+		switch {
+		case e.File == "":
+			ft.err = errors.New("no file")
+		case e.Vendor == "":
+			ft.err = errors.New("no vendor")
+		}
+		tasks[i] = ft
+	}
+	return tasks
+}
+
+func readIndex(name, format string) ([]indexEntry, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if format == manifestCSV {
+		return readCSVIndex(f)
+	}
+
+	var entries []indexEntry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<24)
+	for line := 1; sc.Scan(); line++ {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var e indexEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		e.row = line
+		entries = append(entries, e)
+	}
+	return entries, sc.Err()
+}
+
+// readCSVIndex reads a row per field, the rows of a file are consecutive.
+// A file without fields has a single row with an empty field.
+func readCSVIndex(r io.Reader) ([]indexEntry, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(indexHeader)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the index header: %w", err)
+	}
+	if !slices.Equal(header, indexHeader) {
+		return nil, errors.New("invalid index header")
+	}
+
+	var entries []indexEntry
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+
+		last := len(entries) - 1
+		if last < 0 || entries[last].File != record[0] || entries[last].Vendor != record[4] {
+			e := indexEntry{File: record[0], Type: record[3], Vendor: record[4], Fields: map[string]string{}, row: line}
+			if e.Size, err = strconv.ParseInt(record[1], 10, 64); err != nil {
+				return nil, fmt.Errorf("line %d: invalid size: %w", line, err)
+			}
+			if e.Mtime, err = time.Parse(time.RFC3339Nano, record[2]); err != nil {
+				return nil, fmt.Errorf("line %d: invalid mtime: %w", line, err)
+			}
+			entries = append(entries, e)
+			last++
+		}
+		if record[5] != "" {
+			entries[last].Fields[record[5]] = record[6]
+		}
+	}
+}
+
+func writeIndex(w io.Writer, format string, entries []*indexEntry) error {
+	if format != manifestCSV {
+		enc := json.NewEncoder(w)
+		for _, e := range entries {
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(indexHeader); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		row := []string{e.File, strconv.FormatInt(e.Size, 10), e.Mtime.Format(time.RFC3339Nano), e.Type, e.Vendor}
+		if len(e.Fields) == 0 {
+			if err := cw.Write(append(row, "", "")); err != nil {
+				return err
+			}
+		}
+		for _, k := range slices.Sorted(maps.Keys(e.Fields)) {
+			if err := cw.Write(append(row, k, e.Fields[k])); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// collectWriter keeps the results instead of writing them.
+type collectWriter struct {
+	results []fileResult
+}
+
+func (c *collectWriter) Write(r fileResult) error {
+	c.results = append(c.results, r)
+	return nil
+}
+
+func (c *collectWriter) Close() error {
+	return nil
+}
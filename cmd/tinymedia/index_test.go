@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_commands_ExportImport(t *testing.T) {
+	dir := t.TempDir()
+	tagged := filepath.Join(dir, "tagged.jpg")
+	untagged := filepath.Join(dir, "sub", "untagged.jpg")
+	os.Mkdir(filepath.Join(dir, "sub"), 0755)
+	createTestJPEG(t, tagged, "tinymeta", map[string]string{"artist": "A", "title": "T"})
+	createTestJPEG(t, untagged, "tinymeta", nil)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not an image"), 0644)
+
+	index := filepath.Join(dir, "index.jsonl")
+	cmd := exec.Command("./tinymedia.test", "export", "-v", "tinymeta", "-index", index, dir)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("export failed: %v\noutput: %s", err, output)
+	}
+
+	data, _ := os.ReadFile(index)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("want 2 entries, got:\n%s", data)
+	}
+	if !strings.Contains(lines[0], `"file":"`+untagged+`"`) || !strings.Contains(lines[0], `"fields":{}`) {
+		t.Errorf("wrong untagged entry: %s", lines[0])
+	}
+	if !strings.Contains(lines[1], `"file":"`+tagged+`"`) || !strings.Contains(lines[1], `"fields":{"artist":"A","title":"T"}`) {
+		t.Errorf("wrong tagged entry: %s", lines[1])
+	}
+
+	// the unchanged files keep the entries of the index
+	edited := strings.Replace(string(data), `"artist":"A"`, `"artist":"Catalog"`, 1)
+	os.WriteFile(index, []byte(edited), 0644)
+	cmd = exec.Command("./tinymedia.test", "export", "-v", "tinymeta", "-index", index, dir)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("export failed: %v\noutput: %s", err, output)
+	}
+	if data, _ := os.ReadFile(index); string(data) != edited {
+		t.Errorf("unchanged files exported again:\n%s", data)
+	}
+
+	cmd = exec.Command("./tinymedia.test", "import", index)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("import failed: %v\noutput: %s", err, output)
+	}
+	output, _ := exec.Command("./tinymedia.test", "get", "-v", "tinymeta", tagged).CombinedOutput()
+	if !strings.Contains(string(output), kvQuote("artist", "Catalog")) {
+		t.Errorf("index not imported:\n%s", output)
+	}
+
+	cmd = exec.Command("./tinymedia.test", "export", "-v", "tinymeta", "-format", "csv", tagged)
+	output, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	rows := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if len(rows) != 3 || rows[0] != "file,size,mtime,type,vendor,field,value" || !strings.HasSuffix(rows[1], ",jpeg,tinymeta,artist,Catalog") {
+		t.Errorf("wrong csv index:\n%s", output)
+	}
+}
+
+// createCameraJPEG writes a JPEG whose EXIF has the image and exposure
+// tags cameras write, which the codec reads but doesn't write.
+func createCameraJPEG(t *testing.T, path string) {
+	t.Helper()
+
+	le := binary.LittleEndian
+	tiff := []byte("II*\x00\x08\x00\x00\x00")
+	entry := func(tag, typ uint16, count, value uint32) {
+		tiff = le.AppendUint16(tiff, tag)
+		tiff = le.AppendUint16(tiff, typ)
+		tiff = le.AppendUint32(tiff, count)
+		tiff = le.AppendUint32(tiff, value)
+	}
+	makeAt := uint32(8 + 2 + 3*12 + 4)
+	exifAt := makeAt + 6
+	tiff = le.AppendUint16(tiff, 3)
+	entry(0x0100, 3, 1, 4000)
+	entry(0x010F, 2, 6, makeAt)
+	entry(0x8769, 4, 1, exifAt)
+	tiff = le.AppendUint32(tiff, 0)
+	tiff = append(tiff, "Canon\x00"...)
+	tiff = le.AppendUint16(tiff, 1)
+	entry(0x829A, 5, 1, exifAt+2+12+4)
+	tiff = le.AppendUint32(tiff, 0)
+	tiff = le.AppendUint32(tiff, 1)
+	tiff = le.AppendUint32(tiff, 250)
+
+	app1 := append([]byte("Exif\x00\x00"), tiff...)
+	data := []byte{0xFF, 0xD8, 0xFF, 0xE1}
+	data = binary.BigEndian.AppendUint16(data, uint16(2+len(app1)))
+	data = append(data, app1...)
+	data = append(data, 0xFF, 0xDA, 0x00, 0x02)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("failed to create test JPEG: %v", err)
+	}
+}
+
+func Test_commands_ImportExif(t *testing.T) {
+	dir := t.TempDir()
+	photo := filepath.Join(dir, "photo.jpg")
+	createCameraJPEG(t, photo)
+
+	index := filepath.Join(dir, "index.jsonl")
+	cmd := exec.Command("./tinymedia.test", "export", "-v", "exif", "-index", index, photo)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("export failed: %v\noutput: %s", err, output)
+	}
+	data, _ := os.ReadFile(index)
+	if !strings.Contains(string(data), `"ImageWidth":"4000"`) {
+		t.Fatalf("want the camera tags exported, got:\n%s", data)
+	}
+
+	edited := strings.Replace(string(data), `"Make":"Canon"`, `"Make":"Nikon"`, 1)
+	os.WriteFile(index, []byte(edited), 0644)
+	cmd = exec.Command("./tinymedia.test", "import", index)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("import failed: %v\noutput: %s", err, output)
+	}
+	output, _ := exec.Command("./tinymedia.test", "get", "-v", "exif", photo).CombinedOutput()
+	for _, want := range []string{kvQuote("Make", "Nikon"), kvQuote("ImageWidth", "4000"), kvQuote("ExposureTime", "1/250")} {
+		if !strings.Contains(string(output), want) {
+			t.Errorf("missing %s in:\n%s", want, output)
+		}
+	}
+
+	edited = strings.Replace(edited, `"ImageWidth":"4000"`, `"ImageWidth":"10"`, 1)
+	edited = strings.Replace(edited, `"ExposureTime":"1/250"`, `"ExposureTime":"1/60"`, 1)
+	os.WriteFile(index, []byte(edited), 0644)
+	output, err := exec.Command("./tinymedia.test", "import", index).CombinedOutput()
+	if err == nil || !strings.Contains(string(output), "exif fields not writable: ExposureTime, ImageWidth") {
+		t.Errorf("want the unwritable fields reported, got: %v\noutput: %s", err, output)
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	symlinksSkip   = "skip"
+	symlinksFollow = "follow"
+)
+
+// stdinInput reads the image from stdin, a modified one is written
+// to stdout.
+const stdinInput = "-"
+
+var errStdinInput = errors.New("- must be the only input")
+
+// input is a file to process, found ones come from walking a directory
+// and are skipped instead of failing when their type is unsupported.
+type input struct {
+	path  string
+	found bool
+	// err fails the input met while walking, e.g. an unreadable directory
+	err error
+}
+
+type inputOptions struct {
+	recursive bool
+	include   listFlag
+	exclude   listFlag
+	// symlinks is the policy for the links met while walking directories,
+	// the ones given explicitly are always followed.
+	symlinks  string
+	filesFrom string
+	// to are the files given by copy -to, processed before the arguments
+	to listFlag
+}
+
+func (o inputOptions) validate() error {
+	if o.symlinks != symlinksSkip && o.symlinks != symlinksFollow {
+		return errors.New("-symlinks must be either skip or follow")
+	}
+	for _, pattern := range append(o.include, o.exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.New("invalid pattern " + pattern)
+		}
+	}
+	return nil
+}
+
+// given reports whether inputs are given by the flags.
+func (o inputOptions) given() bool {
+	return o.filesFrom != "" || len(o.to) > 0
+}
+
+// expandInputs reads the -files-from list and walks the directories.
+func expandInputs(paths []string, opts inputOptions, stdin io.Reader) ([]input, error) {
+	paths = append(slices.Clone(opts.to), paths...)
+	if opts.filesFrom != "" {
+		listed, err := readFileList(opts.filesFrom, stdin)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, listed...)
+	}
+
+	if slices.Contains(paths, stdinInput) && (len(paths) > 1 || opts.filesFrom == "-") {
+		return nil, errStdinInput
+	}
+
+	var inputs []input
+	for _, p := range paths {
+		if p == stdinInput {
+			inputs = append(inputs, input{path: p})
+			continue
+		}
+
+		info, err := os.Stat(p)
+		if err != nil || !info.IsDir() || !opts.recursive {
+			inputs = append(inputs, input{path: p})
+			continue
+		}
+
+		found, err := walkInputs(p, opts)
+		if err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, found...)
+	}
+	return inputs, nil
+}
+
+// readFileList splits the list by NUL when it has one, by lines otherwise.
+func readFileList(name string, stdin io.Reader) ([]string, error) {
+	var data []byte
+	var err error
+	if name == "-" {
+		data, err = io.ReadAll(stdin)
+	} else {
+		data, err = os.ReadFile(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sep := "\n"
+	if bytes.IndexByte(data, 0) >= 0 {
+		sep = "\x00"
+	}
+
+	var paths []string
+	for p := range strings.SplitSeq(string(data), sep) {
+		p = strings.TrimSuffix(p, "\r")
+		if p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths, nil
+}
+
+func walkInputs(root string, opts inputOptions) ([]input, error) {
+	var inputs []input
+	// real paths of the walked directories, so links can't loop
+	visited := make(map[string]bool)
+
+	// failed records the path as a failed input and walks on
+	failed := func(p string, d fs.DirEntry, err error) error {
+		inputs = append(inputs, input{path: p, err: err})
+		if d != nil && d.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	}
+
+	var walk func(dir, rel string) error
+	walk = func(dir, rel string) error {
+		return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return failed(p, d, err)
+			}
+			relPath := path.Join(rel, filepath.ToSlash(strings.TrimPrefix(p, dir)))
+			relPath = strings.TrimPrefix(relPath, "/")
+
+			if d.Type()&fs.ModeSymlink != 0 {
+				if opts.symlinks == symlinksSkip || excluded(relPath, opts) {
+					return nil
+				}
+				info, err := os.Stat(p)
+				if err != nil {
+					return failed(p, d, err)
+				}
+				if info.IsDir() {
+					return walk(dirRoot(p), relPath)
+				}
+				if included(relPath, opts) {
+					inputs = append(inputs, input{path: p, found: true})
+				}
+				return nil
+			}
+
+			if d.IsDir() {
+				if p != dir && excluded(relPath, opts) {
+					return filepath.SkipDir
+				}
+				if opts.symlinks == symlinksFollow {
+					real, err := filepath.EvalSymlinks(p)
+					if err != nil {
+						return failed(p, d, err)
+					}
+					if visited[real] {
+						return filepath.SkipDir
+					}
+					visited[real] = true
+				}
+				return nil
+			}
+
+			if d.Type().IsRegular() && included(relPath, opts) && !excluded(relPath, opts) {
+				inputs = append(inputs, input{path: p, found: true})
+			}
+			return nil
+		})
+	}
+
+	if err := walk(dirRoot(root), ""); err != nil {
+		return nil, err
+	}
+	return inputs, nil
+}
+
+// dirRoot makes WalkDir descend into the root even when it's a link.
+func dirRoot(dir string) string {
+	if strings.HasSuffix(dir, string(filepath.Separator)) {
+		return dir
+	}
+	return dir + string(filepath.Separator)
+}
+
+func included(relPath string, opts inputOptions) bool {
+	if len(opts.include) == 0 {
+		return true
+	}
+	return matchAny(relPath, opts.include)
+}
+
+func excluded(relPath string, opts inputOptions) bool {
+	return matchAny(relPath, opts.exclude)
+}
+
+// matchAny matches the patterns against both the base name and the path
+// relative to the walked directory.
+func matchAny(relPath string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, path.Base(relPath)); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, relPath); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func testTree(t *testing.T) string {
+	t.Helper()
+
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "sub"), 0755)
+	os.MkdirAll(filepath.Join(root, "skip"), 0755)
+	createTestJPEG(t, filepath.Join(root, "a.jpg"), "tinymeta", nil)
+	createTestJPEG(t, filepath.Join(root, "sub", "c.jpg"), "tinymeta", nil)
+	createTestJPEG(t, filepath.Join(root, "skip", "d.jpg"), "tinymeta", nil)
+	os.WriteFile(filepath.Join(root, "notes.txt"), []byte("plain text"), 0644)
+	os.Symlink(filepath.Join(root, "sub"), filepath.Join(root, "link"))
+	os.Symlink(root, filepath.Join(root, "loop"))
+	return root
+}
+
+func listedFiles(t *testing.T, root string, output []byte) []string {
+	t.Helper()
+
+	var files []string
+	for line := range strings.Lines(string(output)) {
+		var r fileResult
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("invalid json: %v\nline: %s", err, line)
+		}
+		rel, _ := filepath.Rel(root, r.File)
+		files = append(files, filepath.ToSlash(rel))
+	}
+	return files
+}
+
+func Test_expandInputs(t *testing.T) {
+	root := testTree(t)
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{name: "recursive", args: []string{"-r"}, want: []string{"a.jpg", "skip/d.jpg", "sub/c.jpg"}},
+		{name: "exclude", args: []string{"-r", "-exclude", "skip"}, want: []string{"a.jpg", "sub/c.jpg"}},
+		{name: "include", args: []string{"-r", "-include", "sub/*.jpg"}, want: []string{"sub/c.jpg"}},
+		{name: "follow", args: []string{"-r", "-symlinks", "follow"}, want: []string{"a.jpg", "link/c.jpg", "skip/d.jpg"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"list", "-o", "ndjson"}, tt.args...)
+			output, err := exec.Command("./tinymedia.test", append(args, root)...).Output()
+			if err != nil {
+				t.Fatalf("command failed: %v\noutput: %s", err, output)
+			}
+
+			got := listedFiles(t, root, output)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("want: %v, got: %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_expandInputs_Unreadable(t *testing.T) {
+	root := testTree(t)
+	os.Symlink(filepath.Join(root, "missing"), filepath.Join(root, "broken"))
+	locked := filepath.Join(root, "locked")
+	os.Mkdir(locked, 0755)
+	createTestJPEG(t, filepath.Join(locked, "e.jpg"), "tinymeta", nil)
+	os.Chmod(locked, 0)
+	t.Cleanup(func() { os.Chmod(locked, 0755) })
+
+	want := []string{"a.jpg", "broken", "link/c.jpg", "skip/d.jpg"}
+	// root reads the directory despite its mode
+	if _, err := os.ReadDir(locked); err != nil {
+		want = slices.Insert(want, 3, "locked")
+	} else {
+		want = slices.Insert(want, 3, "locked/e.jpg")
+	}
+
+	output, err := exec.Command("./tinymedia.test", "list", "-o", "ndjson", "-r", "-symlinks", "follow", root).Output()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != exitPartial {
+		t.Errorf("want exit code %d, got: %v", exitPartial, err)
+	}
+	if got := listedFiles(t, root, output); !slices.Equal(got, want) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+}
+
+func Test_expandInputs_FilesFrom(t *testing.T) {
+	root := testTree(t)
+
+	cmd := exec.Command("./tinymedia.test", "list", "-o", "ndjson", "-files-from", "-")
+	cmd.Stdin = strings.NewReader(filepath.Join(root, "a.jpg") + "\x00" + filepath.Join(root, "sub", "c.jpg") + "\x00")
+	output, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("command failed: %v\noutput: %s", err, output)
+	}
+
+	want := []string{"a.jpg", "sub/c.jpg"}
+	if got := listedFiles(t, root, output); !slices.Equal(got, want) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+
+	list := filepath.Join(root, "list.txt")
+	os.WriteFile(list, []byte(filepath.Join(root, "notes.txt")+"\n"), 0644)
+	err = exec.Command("./tinymedia.test", "list", "-files-from", list).Run()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != exitUnsupported {
+		t.Errorf("listed files of unsupported types must fail, got: %v", err)
+	}
+}
+
+func Test_stdinInput(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "test.jpg")
+	createTestJPEG(t, testFile, "tinymeta", nil)
+	image, _ := os.ReadFile(testFile)
+
+	cmd := exec.Command("./tinymedia.test", "set", "-v", "tinymeta", "-f", "artist=Piped", "-")
+	cmd.Stdin = strings.NewReader(string(image))
+	updated, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("set failed: %v\noutput: %s", err, updated)
+	}
+	if !strings.HasPrefix(string(updated), "\xFF\xD8") || len(updated) <= len(image) {
+		t.Fatalf("stdout is not the updated image: %q", updated)
+	}
+
+	cmd = exec.Command("./tinymedia.test", "get", "-v", "tinymeta", "-")
+	cmd.Stdin = strings.NewReader(string(updated))
+	output, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("get failed: %v\noutput: %s", err, output)
+	}
+	if want := "File=-\n" + kvQuote("artist", "Piped") + "\n\n"; string(output) != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, output)
+	}
+
+	if after, _ := os.ReadFile(testFile); string(after) != string(image) {
+		t.Errorf("the file must not be touched")
+	}
+
+	err = exec.Command("./tinymedia.test", "get", "-v", "tinymeta", "-", testFile).Run()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != exitUsage {
+		t.Errorf("want exit code %d, got: %v", exitUsage, err)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	manifestCSV   = "csv"
+	manifestJSONL = "jsonl"
+)
+
+var errNoChanges = errors.New("nothing to set or delete")
+
+// manifestRow is a line of a JSON lines manifest, the vendor defaults to
+// the -v one.
+type manifestRow struct {
+	File   string            `json:"file"`
+	Vendor string            `json:"vendor"`
+	Set    map[string]string `json:"set"`
+	Delete []string          `json:"delete"`
+}
+
+// manifestFormat tells the format from the extension unless it's given.
+func manifestFormat(name, format string) (string, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(name)) {
+		case ".csv":
+			format = manifestCSV
+		case ".jsonl", ".ndjson", ".json":
+			format = manifestJSONL
+		}
+	}
+	if format != manifestCSV && format != manifestJSONL {
+		return "", fmt.Errorf("unknown manifest format %q, set -format to csv or jsonl", format)
+	}
+	return format, nil
+}
+
+// readManifest returns a task per row of the manifest. Invalid rows fail
+// their task only, the manifest fails as a whole when it can't be parsed.
+func readManifest(name, format, vendor string, stdin io.Reader) ([]fileTask, error) {
+	r := stdin
+	if name != stdinInput {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	if format == manifestCSV {
+		return readCSVManifest(r, vendor)
+	}
+	return readJSONLManifest(r, vendor)
+}
+
+// readCSVManifest reads a header of file, an optional vendor and the
+// field names, then a row per file. Empty cells are left out.
+func readCSVManifest(r io.Reader, vendor string) ([]fileTask, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the manifest header: %w", err)
+	}
+	if len(header) < 2 || header[0] != "file" {
+		return nil, errors.New("the manifest header must start with file followed by the fields")
+	}
+	fields := header[1:]
+	vendorColumn := fields[0] == "vendor"
+	if vendorColumn {
+		fields = fields[1:]
+	}
+
+	var tasks []fileTask
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return tasks, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+
+		row := manifestRow{File: record[0], Vendor: vendor, Set: make(map[string]string)}
+		values := record[1:]
+		if vendorColumn {
+			if values[0] != "" {
+				row.Vendor = values[0]
+			}
+			values = values[1:]
+		}
+		for i, v := range values {
+			if v != "" {
+				row.Set[fields[i]] = v
+			}
+		}
+		tasks = append(tasks, row.task(line))
+	}
+}
+
+func readJSONLManifest(r io.Reader, vendor string) ([]fileTask, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<24)
+
+	var tasks []fileTask
+	for line := 1; sc.Scan(); line++ {
+		data := bytes.TrimSpace(sc.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		row := manifestRow{Vendor: vendor}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&row); err != nil {
+			tasks = append(tasks, fileTask{in: input{path: row.File}, row: line, err: fmt.Errorf("invalid row: %w", err)})
+			continue
+		}
+		tasks = append(tasks, row.task(line))
+	}
+	return tasks, sc.Err()
+}
+
+func (r manifestRow) task(line int) fileTask {
+	ft := fileTask{
+		in:   input{path: r.File},
+		task: metaTask{vendor: r.Vendor, update: r.Set, delete: r.Delete},
+		row:  line,
+	}
+	switch {
+	case r.File == "":
+		ft.err = errors.New("no file")
+	case r.File == stdinInput:
+		ft.err = errors.New("stdin can't be updated by a manifest")
+	case r.Vendor == "":
+		ft.err = errVendorRequired
+	case !ft.task.modifies():
+		ft.err = errNoChanges
+	}
+	return ft
+}
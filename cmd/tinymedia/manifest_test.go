@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_readCSVManifest(t *testing.T) {
+	manifest := "file,vendor,artist,title\n" +
+		"a.jpg,,A,\n" +
+		"b.jpg,xmp,,B\n" +
+		"c.jpg,,,\n"
+
+	tasks, err := readCSVManifest(strings.NewReader(manifest), "tinymeta")
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if len(tasks) != 3 {
+		t.Fatalf("want 3 tasks, got: %d", len(tasks))
+	}
+
+	tests := []struct {
+		path    string
+		row     int
+		vendor  string
+		update  map[string]string
+		wantErr error
+	}{
+		{path: "a.jpg", row: 2, vendor: "tinymeta", update: map[string]string{"artist": "A"}},
+		{path: "b.jpg", row: 3, vendor: "xmp", update: map[string]string{"title": "B"}},
+		{path: "c.jpg", row: 4, vendor: "tinymeta", update: map[string]string{}, wantErr: errNoChanges},
+	}
+	for i, tt := range tests {
+		got := tasks[i]
+		if got.in.path != tt.path || got.row != tt.row || got.task.vendor != tt.vendor || !maps.Equal(got.task.update, tt.update) {
+			t.Errorf("want: %s:%d %s %v, got: %s:%d %s %v", tt.path, tt.row, tt.vendor, tt.update,
+				got.in.path, got.row, got.task.vendor, got.task.update)
+		}
+		if !errors.Is(got.err, tt.wantErr) {
+			t.Errorf("want error: %v, got: %v", tt.wantErr, got.err)
+		}
+	}
+
+	if _, err := readCSVManifest(strings.NewReader("name,artist\n"), ""); err == nil {
+		t.Errorf("want header error, got: %v", err)
+	}
+}
+
+func Test_commands_Apply(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.jpg")
+	second := filepath.Join(dir, "second.jpg")
+	createTestJPEG(t, first, "tinymeta", map[string]string{"artist": "Old", "note": "n"})
+	createTestJPEG(t, second, "tinymeta", map[string]string{"artist": "Old"})
+
+	manifest := filepath.Join(dir, "manifest.jsonl")
+	os.WriteFile(manifest, []byte(
+		`{"file":"`+first+`","set":{"artist":"First"},"delete":["note"]}`+"\n"+
+			`{"file":"`+second+`","vendor":"tinymeta","set":{"artist":"Second"}}`+"\n"+
+			`{"file":"`+first+`","set":{"title":"T"}}`+"\n"+
+			`{"file":"`+second+`","unknown":1}`+"\n",
+	), 0644)
+
+	cmd := exec.Command("./tinymedia.test", "apply", "-v", "tinymeta", manifest)
+	var stdout, stderr strings.Builder
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	cmd.Run()
+
+	if code := cmd.ProcessState.ExitCode(); code != exitPartial {
+		t.Errorf("want exit code: %d, got: %d\nstderr: %s", exitPartial, code, stderr.String())
+	}
+	want := "File=" + first + "\nRow=1\n\nFile=" + second + "\nRow=2\n\nFile=" + first + "\nRow=3\n\n"
+	if stdout.String() != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, stdout.String())
+	}
+	if !strings.HasPrefix(stderr.String(), "row 4: "+second+": invalid row") {
+		t.Errorf("want row 4 error, got: %s", stderr.String())
+	}
+
+	output, _ := exec.Command("./tinymedia.test", "get", "-v", "tinymeta", first).CombinedOutput()
+	got := string(output)
+	if !strings.Contains(got, kvQuote("artist", "First")) || !strings.Contains(got, kvQuote("title", "T")) || strings.Contains(got, `"note"`) {
+		t.Errorf("first not updated:\n%s", got)
+	}
+	output, _ = exec.Command("./tinymedia.test", "get", "-v", "tinymeta", second).CombinedOutput()
+	if !strings.Contains(string(output), kvQuote("artist", "Second")) {
+		t.Errorf("second not updated:\n%s", output)
+	}
+}
@@ -1,89 +1,404 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"os"
-	"strconv"
+	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	fileUpdate "github.com/zzvanq/tinymedia/internal/file"
+	"github.com/zzvanq/tinymedia/internal/query"
 	"github.com/zzvanq/tinymedia/pkg/file"
 	"github.com/zzvanq/tinymedia/pkg/meta/codec"
 	"github.com/zzvanq/tinymedia/pkg/meta/manager"
 )
 
-func handleMeta(fileNames []string, fields []string, vendor string) {
-	if vendor == "" {
-		fmt.Println("-mv is required when -m is used")
-		return
+// metaTask is the set of operations applied to every input file:
+// strips first, then copies, deletes and updates, then reads.
+type metaTask struct {
+	vendor   string
+	read     []string
+	readAll  bool
+	vendors  bool
+	update   map[string]string
+	delete   []string
+	strip    []string
+	stripAll bool
+	copy     manager.Metadata
+	// copyStrict fails on the copied vendors the file type doesn't support
+	copyStrict bool
+	// replace deletes the fields of the vendor missing from update
+	replace bool
+	// optional reads a missing vendor as no fields instead of failing
+	optional bool
+	// filter is evaluated against the fields read
+	filter query.Expr
+}
+
+func (t metaTask) empty() bool {
+	return !t.reads() && !t.modifies()
+}
+
+func (t metaTask) reads() bool {
+	return len(t.read) > 0 || t.readAll || t.vendors
+}
+
+func (t metaTask) modifies() bool {
+	return len(t.update) > 0 || len(t.delete) > 0 || len(t.strip) > 0 || t.stripAll || len(t.copy.Fields) > 0
+}
+
+// fileTask is a task to run on a single file.
+type fileTask struct {
+	in   input
+	task metaTask
+	// row is the line of the manifest the task comes from
+	row int
+	// err fails the task without opening the file
+	err error
+}
+
+// handleMeta runs the task on the files and returns the exit code.
+func handleMeta(fileNames []string, task metaTask, opts runOptions) int {
+	newWriter, ok := resultWriters[opts.output]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown output format %q\n", opts.output)
+		return exitUsage
+	}
+
+	inputs, err := expandInputs(fileNames, opts.inputs, os.Stdin)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		if errors.Is(err, errStdinInput) {
+			return exitUsage
+		}
+		return exitFailure
+	}
+
+	writer := newWriter(os.Stdout)
+	// the modified image takes stdout over
+	if len(inputs) == 1 && inputs[0].path == stdinInput && task.modifies() && !opts.write.dryRun {
+		writer = newWriter(io.Discard)
+	}
+
+	tasks := make([]fileTask, len(inputs))
+	for i, in := range inputs {
+		tasks[i] = fileTask{in: in, task: task}
+	}
+	return runTasks(tasks, writer, opts)
+}
+
+// runTasks runs the tasks by a pool of opts.jobs workers and returns the
+// exit code. The results are emitted in order unless opts.stream is set.
+// The tasks on the same file run one after the other, by the same worker.
+func runTasks(tasks []fileTask, writer resultWriter, opts runOptions) int {
+	type indexed struct {
+		i      int
+		result fileResult
 	}
 
-	readFields, updateFields := parseFields(fields)
+	var groups [][]int
+	byPath := make(map[string]int)
+	for i, ft := range tasks {
+		p := filepath.Clean(ft.in.path)
+		g, ok := byPath[p]
+		if !ok {
+			g = len(groups)
+			byPath[p] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], i)
+	}
 
-	errCh := make(chan error, len(fileNames))
+	jobs := make(chan []int)
+	out := make(chan indexed)
+	var stop atomic.Bool
 
 	var wg sync.WaitGroup
-	wg.Add(len(fileNames))
-	for _, fn := range fileNames {
+	wg.Add(opts.jobs)
+	for range opts.jobs {
 		go func() {
 			defer wg.Done()
-			if err := processFile(fn, vendor, readFields, updateFields); err != nil {
-				errCh <- err
+			for group := range jobs {
+				for _, i := range group {
+					if stop.Load() {
+						break
+					}
+					result := processFile(tasks[i], opts.write)
+					if result.err != nil && opts.failFast {
+						stop.Store(true)
+					}
+					out <- indexed{i, result}
+				}
 			}
 		}()
 	}
 
+	go func() {
+		defer close(jobs)
+		for _, group := range groups {
+			if stop.Load() {
+				return
+			}
+			jobs <- group
+		}
+	}()
+
 	go func() {
 		wg.Wait()
-		close(errCh)
+		close(out)
 	}()
 
-	for err := range errCh {
-		fmt.Println(err)
+	s := &summary{total: len(tasks), progress: opts.progress}
+	var writeErr error
+	emit := func(r fileResult) {
+		s.add(r)
+		if r.skipped {
+			s.report()
+			return
+		}
+		if r.err != nil {
+			s.clearLine()
+			if r.Row > 0 {
+				fmt.Fprintf(os.Stderr, "row %d: ", r.Row)
+			}
+			fmt.Fprintf(os.Stderr, "%s: %v\n", r.File, r.err)
+		}
+		if writeErr == nil {
+			writeErr = writer.Write(r)
+		}
+		s.report()
 	}
+
+	pending := make(map[int]fileResult)
+	next := 0
+	for res := range out {
+		if opts.stream {
+			emit(res.result)
+			continue
+		}
+		pending[res.i] = res.result
+		for {
+			r, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			emit(r)
+		}
+	}
+	// files skipped after a failure leave gaps
+	for _, i := range slices.Sorted(maps.Keys(pending)) {
+		emit(pending[i])
+	}
+
+	if writeErr == nil {
+		writeErr = writer.Close()
+	}
+	s.finish()
+	if writeErr != nil {
+		fmt.Fprintln(os.Stderr, writeErr)
+		return exitFailure
+	}
+	return s.code()
 }
 
-func processFile(fn string, vendor string, readFields []string, updateFields map[string]string) error {
-	f, err := os.Open(fn)
+// findFiles walks the paths printing the ones whose vendor fields match the
+// filter, the files without the vendor have no fields.
+func findFiles(paths []string, vendor string, filter query.Expr, nul bool, opts runOptions) int {
+	var writer resultWriter = &pathWriter{w: os.Stdout, sep: "\n"}
+	if nul {
+		writer = &pathWriter{w: os.Stdout, sep: "\x00"}
+	}
+	if opts.output != "text" {
+		newWriter, ok := resultWriters[opts.output]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "unknown output format %q\n", opts.output)
+			return exitUsage
+		}
+		writer = matchWriter{newWriter(os.Stdout)}
+	}
+
+	opts.inputs.recursive = true
+	inputs, err := expandInputs(paths, opts.inputs, os.Stdin)
 	if err != nil {
-		return err
+		fmt.Fprintln(os.Stderr, err)
+		if errors.Is(err, errStdinInput) {
+			return exitUsage
+		}
+		return exitFailure
 	}
-	defer f.Close()
 
-	r, ftype, err := file.ReadFileType(f)
+	task := metaTask{vendor: vendor, readAll: true, optional: true, filter: filter}
+	tasks := make([]fileTask, len(inputs))
+	for i, in := range inputs {
+		tasks[i] = fileTask{in: in, task: task}
+	}
+	return runTasks(tasks, writer, opts)
+}
+
+func processFile(ft fileTask, write writeOptions) fileResult {
+	result := fileResult{File: ft.in.path, Vendor: ft.task.vendor, Row: ft.row, read: ft.task.reads()}
+	err := ft.err
+	if err == nil {
+		err = ft.in.err
+	}
+	if err == nil {
+		err = applyTask(&result, ft.task, write)
+	}
 	if err != nil {
-		return err
+		if ft.in.found && errors.Is(err, file.ErrUnsupportedFileType) {
+			result.skipped = true
+			return result
+		}
+		result.err = err
+		result.Error = err.Error()
 	}
+	return result
+}
 
-	metaManager, err := manager.NewMetaManager(r, ftype)
+func applyTask(result *fileResult, task metaTask, write writeOptions) error {
+	f := os.Stdin
+	if result.File != stdinInput {
+		var err error
+		f, err = os.Open(result.File)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+	}
+
+	metaManager, ftype, err := openMeta(f)
 	if err != nil {
 		return err
 	}
+	result.Type = string(ftype)
+
+	var before map[string]map[string]string
+	if write.dryRun && task.modifies() {
+		if before, err = snapshot(metaManager); err != nil {
+			return err
+		}
+	}
 
-	var newReader io.Reader
-	if len(updateFields) > 0 {
-		if err := metaManager.Upsert(codec.MetaCodecVendor(vendor), updateFields); err != nil {
+	vendor := codec.MetaCodecVendor(task.vendor)
+	if task.stripAll {
+		if err := metaManager.StripAll(); err != nil {
+			return err
+		}
+	}
+	if len(task.strip) > 0 {
+		vendors := make([]codec.MetaCodecVendor, len(task.strip))
+		for i, v := range task.strip {
+			vendors[i] = codec.MetaCodecVendor(v)
+		}
+		if err := metaManager.Strip(vendors...); err != nil {
+			return err
+		}
+	}
+	if err := manager.WriteAll(metaManager, task.copy, task.copyStrict); err != nil {
+		return err
+	}
+	if task.replace {
+		if err := replaceFields(metaManager, vendor, &task); err != nil {
+			return err
+		}
+	}
+	if len(task.delete) > 0 {
+		if err := metaManager.Delete(vendor, task.delete...); err != nil {
+			return err
+		}
+	}
+	if len(task.update) > 0 {
+		if err := metaManager.Upsert(vendor, task.update); err != nil {
 			return err
 		}
-		newReader = metaManager.FileReader()
 	}
 
-	if len(readFields) > 0 {
-		result, err := formatMeta(metaManager, vendor, readFields)
+	if task.vendors {
+		vendors, err := metaManager.Vendors()
+		if err != nil {
+			return err
+		}
+		result.Vendors = make([]string, len(vendors))
+		for i, v := range vendors {
+			result.Vendors[i] = string(v)
+		}
+	}
+	if len(task.read) > 0 || task.readAll {
+		result.Fields, err = readMeta(metaManager, vendor, task.read)
+		if task.optional && errorCode(err) == exitMissingVendor {
+			result.Fields, err = map[string]string{}, nil
+		}
 		if err != nil {
 			return err
 		}
-		fmt.Print("File=", fn, "\n", result, "\n")
+	}
+	if task.filter != nil {
+		result.matched = task.filter.Eval(result.Fields)
 	}
 
-	if len(updateFields) > 0 {
-		fileUpdate.UpdateFile(newReader, f.Name())
+	if write.dryRun && task.modifies() {
+		after, err := snapshot(metaManager)
+		if err != nil {
+			return err
+		}
+		result.Changes = diffMeta(before, after)
+		return nil
+	}
+	if task.modifies() {
+		written, err := writeFile(metaManager, f, write)
+		if err != nil {
+			return err
+		}
+		result.written = written
 	}
 	return nil
 }
 
+// writeFile writes the updated file, in place if asked and possible.
+// The reads above may parse the file further, so it's only done last.
+// The backup is a copy of the original when updating in place, a link to
+// it otherwise, as the file is rewritten.
+func writeFile(metaManager manager.MetaManager, f *os.File, write writeOptions) (int64, error) {
+	ipw, canInPlace := metaManager.(manager.InPlaceWriter)
+	if f != os.Stdin && write.inPlace && canInPlace {
+		w := &countingWriterAt{}
+		err := fileUpdate.UpdateFileInPlace(f.Name(), write.update, func(wa io.WriterAt) error {
+			w.w = wa
+			return ipw.WriteInPlace(w)
+		})
+		if err == nil {
+			return w.n, nil
+		}
+		if !errors.Is(err, manager.ErrNoRoomInPlace) {
+			return 0, err
+		}
+	}
+
+	if write.padding > 0 && canInPlace {
+		if err := ipw.Reserve(write.padding); err != nil {
+			return 0, err
+		}
+	}
+
+	r := &countingReader{r: metaManager.FileReader()}
+	if f == os.Stdin {
+		if _, err := io.Copy(os.Stdout, r); err != nil {
+			return 0, err
+		}
+	} else if err := fileUpdate.UpdateFileWith(r, f.Name(), write.update); err != nil {
+		return 0, err
+	}
+	return r.n, nil
+}
+
 func parseFields(fields []string) ([]string, map[string]string) {
 	var readFields []string
 	updateFields := make(map[string]string)
@@ -105,15 +420,96 @@ func parseFields(fields []string) ([]string, map[string]string) {
 	return readFields, updateFields
 }
 
-func formatMeta(metaManager manager.MetaManager, vendor string, fields []string) (string, error) {
-	extracted, err := metaManager.Extract(codec.MetaCodecVendor(vendor), fields...)
+func openMeta(r io.Reader) (manager.MetaManager, file.FileType, error) {
+	r, ftype, err := file.ReadFileType(r)
+	if err != nil {
+		return nil, "", err
+	}
+
+	metaManager, err := manager.NewMetaManager(r, ftype)
+	if err != nil {
+		return nil, "", err
+	}
+	return metaManager, ftype, nil
+}
+
+// readSource reads the metadata of the file selected by opts.
+func readSource(fn string, opts manager.CopyOptions) (manager.Metadata, error) {
+	f, err := os.Open(fn)
 	if err != nil {
-		return "", err
+		return manager.Metadata{}, err
 	}
+	defer f.Close()
 
-	resultBuilder := strings.Builder{}
-	for k, v := range extracted {
-		resultBuilder.WriteString(fmt.Sprintf("%s=%s\n", strconv.Quote(k), strconv.Quote(v)))
+	metaManager, _, err := openMeta(f)
+	if err != nil {
+		return manager.Metadata{}, err
 	}
-	return resultBuilder.String(), nil
+	return manager.ReadAll(metaManager, opts)
+}
+
+// replaceFields turns the task update into deleting the fields of the
+// vendor it misses, the task is left without changes if there are none.
+// Only the changed fields are written, so the ones the codec only reads
+// can be replaced by their current value.
+func replaceFields(metaManager manager.MetaManager, vendor codec.MetaCodecVendor, task *metaTask) error {
+	current, err := metaManager.Fields(vendor)
+	if err != nil && errorCode(err) != exitMissingVendor {
+		return err
+	}
+	if maps.Equal(current, task.update) {
+		task.update = nil
+		return nil
+	}
+	for k := range current {
+		if _, ok := task.update[k]; !ok {
+			task.delete = append(task.delete, k)
+		}
+	}
+
+	update := maps.Clone(task.update)
+	var unwritable []string
+	for k, v := range task.update {
+		if cur, ok := current[k]; ok && cur == v {
+			delete(update, k)
+		} else if !manager.Writable(vendor, k) {
+			unwritable = append(unwritable, k)
+		}
+	}
+	if len(unwritable) > 0 {
+		slices.Sort(unwritable)
+		return fmt.Errorf("%s fields not writable: %s", vendor, strings.Join(unwritable, ", "))
+	}
+	task.update = update
+	return nil
+}
+
+// readMeta returns all the vendor fields when none are given.
+func readMeta(metaManager manager.MetaManager, vendor codec.MetaCodecVendor, fields []string) (map[string]string, error) {
+	if len(fields) > 0 {
+		return metaManager.Extract(vendor, fields...)
+	}
+	return metaManager.Fields(vendor)
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type countingWriterAt struct {
+	w io.WriterAt
+	n int64
+}
+
+func (c *countingWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	n, err := c.w.WriteAt(p, off)
+	c.n += int64(n)
+	return n, err
 }
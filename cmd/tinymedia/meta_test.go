@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -342,20 +343,20 @@ func Test_handleMeta_EmptyMetadataSection(t *testing.T) {
 		"-mv", "tinymeta",
 	)
 
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		t.Fatalf("update failed: %v\noutput: %s", err, output)
-	}
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
 
-	got := string(output)
-	if !strings.Contains(got, "marker not found") {
-		t.Errorf("expected 'marker not found', got:\n%s", got)
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != exitMissingVendor {
+		t.Errorf("want exit code %d, got: %v", exitMissingVendor, err)
 	}
-	if strings.Contains(got, `"artist"=`) {
-		t.Errorf("shouldn't return artist for empty metadata:\n%s", got)
+	if !strings.Contains(stderr.String(), testFile+": marker not found") {
+		t.Errorf("expected 'marker not found' on stderr, got:\n%s", stderr.String())
+	}
+	if strings.Contains(string(output), `"artist"=`) {
+		t.Errorf("shouldn't return artist for empty metadata:\n%s", output)
 	}
-
-	_ = err
 }
 
 func Test_handleMeta_MixedReadAndUpdate(t *testing.T) {
@@ -470,6 +471,117 @@ func Test_handleMeta_EmptyFields(t *testing.T) {
 	}
 }
 
+func Test_handleMeta_Delete(t *testing.T) {
+	testFile := filepath.Join("./", "test.jpg")
+	createTestJPEG(t, testFile, "tinymeta", map[string]string{
+		"artist": "Test Artist",
+		"title":  "Test Title",
+	})
+	defer os.Remove(testFile)
+
+	cmd := exec.Command("./tinymedia.test",
+		"-i", testFile,
+		"-d", "artist",
+		"-mv", "tinymeta",
+	)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("delete failed: %v\noutput: %s", err, output)
+	}
+
+	cmd = exec.Command("./tinymedia.test",
+		"-i", testFile,
+		"-m", "artist,title",
+		"-mv", "tinymeta",
+	)
+
+	output, err = cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("read failed: %v\noutput: %s", err, output)
+	}
+
+	got := string(output)
+	if strings.Contains(got, `"artist"=`) {
+		t.Errorf("artist not deleted:\n%s", got)
+	}
+	if !strings.Contains(got, kvQuote("title", "Test Title")) {
+		t.Errorf("title was deleted:\n%s", got)
+	}
+}
+
+func Test_handleMeta_Strip(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "strip", args: []string{"-strip", "tinymeta,exif"}},
+		{name: "strip all", args: []string{"-strip-all"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testFile := filepath.Join("./", "test.jpg")
+			createTestJPEG(t, testFile, "tinymeta", map[string]string{
+				"artist": "Test Artist",
+			})
+			defer os.Remove(testFile)
+
+			cmd := exec.Command("./tinymedia.test", append([]string{"-i", testFile}, tt.args...)...)
+			output, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("strip failed: %v\noutput: %s", err, output)
+			}
+
+			data, _ := os.ReadFile(testFile)
+			want := []byte{0xFF, 0xD8, 0xFF, 0xDA, 0x00, 0x02}
+			if string(data) != string(want) {
+				t.Errorf("want: %v, got: %v", want, data)
+			}
+		})
+	}
+}
+
+func Test_handleMeta_DeleteMissingVendor(t *testing.T) {
+	cmd := exec.Command("./tinymedia.test",
+		"-i", "test.jpg",
+		"-d", "artist",
+	)
+
+	output, _ := cmd.CombinedOutput()
+	if !strings.Contains(string(output), "-mv is required") {
+		t.Errorf("expected error message about -mv, got:\n%s", output)
+	}
+}
+
+func Test_handleMeta_ListAll(t *testing.T) {
+	testFile := filepath.Join("./", "test.jpg")
+	createTestJPEG(t, testFile, "tinymeta", map[string]string{
+		"artist": "Test Artist",
+		"title":  "Test Title",
+	})
+	defer os.Remove(testFile)
+
+	cmd := exec.Command("./tinymedia.test",
+		"-i", testFile,
+		"-mv", "tinymeta",
+		"-l",
+	)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("list failed: %v\noutput: %s", err, output)
+	}
+
+	want := "File=" + testFile + "\n" +
+		`Vendor="tinymeta"` + "\n" +
+		kvQuote("artist", "Test Artist") + "\n" +
+		kvQuote("title", "Test Title") + "\n"
+	if !strings.Contains(string(output), want) {
+		t.Errorf("want:\n%s\ngot:\n%s", want, output)
+	}
+}
+
 func createTestJPEG(t *testing.T, path string, vendor string, metadata map[string]string) {
 	t.Helper()
 
@@ -517,3 +629,39 @@ func createTestJPEG(t *testing.T, path string, vendor string, metadata map[strin
 func kvQuote(key, value string) string {
 	return fmt.Sprintf(`%s=%s`, strconv.Quote(key), strconv.Quote(value))
 }
+
+func Test_handleMeta_InPlace(t *testing.T) {
+	testFile := filepath.Join("./", "test.jpg")
+	createTestJPEG(t, testFile, "tinymeta", map[string]string{
+		"artist": "Test Artist",
+	})
+	defer os.Remove(testFile)
+
+	cmd := exec.Command("./tinymedia.test", "set", "-pad", "512", "-v", "tinymeta", "-f", "title=Title", testFile)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("padding failed: %v\noutput: %s", err, output)
+	}
+	before, _ := os.Stat(testFile)
+
+	cmd = exec.Command("./tinymedia.test", "set", "-in-place", "-v", "tinymeta", "-f", "title="+strings.Repeat("t", 100), testFile)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("in place update failed: %v\noutput: %s", err, output)
+	}
+	after, _ := os.Stat(testFile)
+
+	if !os.SameFile(before, after) {
+		t.Errorf("file was rewritten instead of updated in place")
+	}
+	if before.Size() != after.Size() {
+		t.Errorf("want size: %d, got: %d", before.Size(), after.Size())
+	}
+
+	cmd = exec.Command("./tinymedia.test", "get", "-v", "tinymeta", testFile)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("read failed: %v\noutput: %s", err, output)
+	}
+	if !strings.Contains(string(output), kvQuote("title", strings.Repeat("t", 100))) {
+		t.Errorf("title not updated:\n%s", output)
+	}
+}
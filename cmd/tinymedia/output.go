@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+)
+
+// fileResult is the outcome of a task on a single file. Encoders sort the
+// fields by key, so the output is stable.
+type fileResult struct {
+	File    string            `json:"file"`
+	Row     int               `json:"row,omitempty"`
+	Type    string            `json:"type,omitempty"`
+	Vendor  string            `json:"vendor,omitempty"`
+	Vendors []string          `json:"vendors,omitempty"`
+	Fields  map[string]string `json:"fields,omitempty"`
+	Changes []fieldChange     `json:"changes,omitempty"`
+	Error   string            `json:"error,omitempty"`
+
+	// read is set when the task reads anything, text output skips the rest
+	read    bool
+	err     error
+	written int64
+	skipped bool
+	matched bool
+}
+
+// resultWriter emits the results one by one as they come.
+type resultWriter interface {
+	Write(r fileResult) error
+	Close() error
+}
+
+var resultWriters = map[string]func(w io.Writer) resultWriter{
+	"text":   func(w io.Writer) resultWriter { return &textWriter{w} },
+	"json":   func(w io.Writer) resultWriter { return &jsonWriter{w: w} },
+	"ndjson": func(w io.Writer) resultWriter { return &ndjsonWriter{json.NewEncoder(w)} },
+	"csv":    func(w io.Writer) resultWriter { return &csvWriter{w: csv.NewWriter(w)} },
+}
+
+type textWriter struct {
+	w io.Writer
+}
+
+func (t *textWriter) Write(r fileResult) error {
+	// errors are reported on stderr
+	if r.err != nil || (!r.read && len(r.Changes) == 0 && r.Row == 0) {
+		return nil
+	}
+
+	if _, err := fmt.Fprint(t.w, "File=", r.File, "\n"); err != nil {
+		return err
+	}
+	if r.Row > 0 {
+		if _, err := fmt.Fprintf(t.w, "Row=%d\n", r.Row); err != nil {
+			return err
+		}
+	}
+	for _, v := range r.Vendors {
+		if _, err := fmt.Fprintf(t.w, "Vendor=%s\n", strconv.Quote(v)); err != nil {
+			return err
+		}
+	}
+	for _, k := range slices.Sorted(maps.Keys(r.Fields)) {
+		if _, err := fmt.Fprintf(t.w, "%s=%s\n", strconv.Quote(k), strconv.Quote(r.Fields[k])); err != nil {
+			return err
+		}
+	}
+	for _, c := range r.Changes {
+		if _, err := fmt.Fprintf(t.w, "Change=%s\n", c); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(t.w)
+	return err
+}
+
+func (t *textWriter) Close() error {
+	return nil
+}
+
+// jsonWriter writes a single indented array.
+type jsonWriter struct {
+	w     io.Writer
+	count int
+}
+
+func (j *jsonWriter) Write(r fileResult) error {
+	data, err := json.MarshalIndent(r, "  ", "  ")
+	if err != nil {
+		return err
+	}
+
+	sep := ",\n  "
+	if j.count == 0 {
+		sep = "[\n  "
+	}
+	j.count++
+	if _, err := io.WriteString(j.w, sep); err != nil {
+		return err
+	}
+	_, err = j.w.Write(data)
+	return err
+}
+
+func (j *jsonWriter) Close() error {
+	end := "\n]\n"
+	if j.count == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(j.w, end)
+	return err
+}
+
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+func (n *ndjsonWriter) Write(r fileResult) error {
+	return n.enc.Encode(r)
+}
+
+func (n *ndjsonWriter) Close() error {
+	return nil
+}
+
+// csvWriter writes a row per field, per listed vendor, per change and per
+// error. The value of a change is its before and after values.
+type csvWriter struct {
+	w      *csv.Writer
+	header bool
+}
+
+func (c *csvWriter) Write(r fileResult) error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+
+	for _, v := range r.Vendors {
+		if err := c.w.Write([]string{r.File, r.Type, v, "", "", ""}); err != nil {
+			return err
+		}
+	}
+	for _, k := range slices.Sorted(maps.Keys(r.Fields)) {
+		if err := c.w.Write([]string{r.File, r.Type, r.Vendor, k, r.Fields[k], ""}); err != nil {
+			return err
+		}
+	}
+	for _, ch := range r.Changes {
+		if err := c.w.Write([]string{r.File, r.Type, ch.Vendor, ch.Field, ch.values(), ""}); err != nil {
+			return err
+		}
+	}
+	if r.Error != "" {
+		if err := c.w.Write([]string{r.File, r.Type, r.Vendor, "", "", r.Error}); err != nil {
+			return err
+		}
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvWriter) Close() error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvWriter) writeHeader() error {
+	if c.header {
+		return nil
+	}
+	c.header = true
+	return c.w.Write([]string{"file", "type", "vendor", "field", "value", "error"})
+}
+
+// pathWriter writes the paths of the matched files, for find.
+type pathWriter struct {
+	w   io.Writer
+	sep string
+}
+
+func (p *pathWriter) Write(r fileResult) error {
+	if r.err != nil || !r.matched {
+		return nil
+	}
+	_, err := io.WriteString(p.w, r.File+p.sep)
+	return err
+}
+
+func (p *pathWriter) Close() error {
+	return nil
+}
+
+// matchWriter passes the matched results on.
+type matchWriter struct {
+	resultWriter
+}
+
+func (m matchWriter) Write(r fileResult) error {
+	if r.err != nil || !r.matched {
+		return nil
+	}
+	return m.resultWriter.Write(r)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func Test_handleMeta_OutputJSON(t *testing.T) {
+	testFile := filepath.Join("./", "test.jpg")
+	createTestJPEG(t, testFile, "tinymeta", map[string]string{
+		"artist": "Test Artist",
+	})
+	defer os.Remove(testFile)
+
+	missing := filepath.Join("./", "missing.jpg")
+	cmd := exec.Command("./tinymedia.test",
+		"-i", testFile,
+		"-i", missing,
+		"-mv", "tinymeta",
+		"-o", "json",
+	)
+
+	output, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != exitPartial {
+		t.Errorf("want exit code %d, got: %v", exitPartial, err)
+	}
+
+	var got []fileResult
+	if err := json.Unmarshal(output, &got); err != nil {
+		t.Fatalf("invalid json: %v\noutput: %s", err, output)
+	}
+	if len(got) != 2 {
+		t.Fatalf("want 2 results, got: %s", output)
+	}
+	if got[0].File != testFile || got[0].Type != "jpeg" || got[0].Vendor != "tinymeta" ||
+		got[0].Fields["artist"] != "Test Artist" || got[0].Error != "" {
+		t.Errorf("wrong result for %s: %+v", testFile, got[0])
+	}
+	if got[1].File != missing || !strings.Contains(got[1].Error, "no such file") {
+		t.Errorf("wrong result for %s: %+v", missing, got[1])
+	}
+}
+
+func Test_handleMeta_OutputNDJSON(t *testing.T) {
+	file1 := filepath.Join("./", "test1.jpg")
+	file2 := filepath.Join("./", "test2.jpg")
+	createTestJPEG(t, file1, "tinymeta", map[string]string{"b": "2", "a": "1"})
+	defer os.Remove(file1)
+	createTestJPEG(t, file2, "tinymeta", map[string]string{"c": "3"})
+	defer os.Remove(file2)
+
+	cmd := exec.Command("./tinymedia.test",
+		"-i", file1,
+		"-i", file2,
+		"-mv", "tinymeta",
+		"-o", "ndjson",
+	)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("command failed: %v\noutput: %s", err, output)
+	}
+
+	want := `{"file":"test1.jpg","type":"jpeg","vendor":"tinymeta","fields":{"a":"1","b":"2"}}` + "\n" +
+		`{"file":"test2.jpg","type":"jpeg","vendor":"tinymeta","fields":{"c":"3"}}` + "\n"
+	if string(output) != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, output)
+	}
+}
+
+func Test_handleMeta_OutputCSV(t *testing.T) {
+	testFile := filepath.Join("./", "test.jpg")
+	createTestJPEG(t, testFile, "tinymeta", map[string]string{
+		"title":  "A \"quoted\" title",
+		"artist": "Test Artist",
+	})
+	defer os.Remove(testFile)
+
+	cmd := exec.Command("./tinymedia.test",
+		"-i", testFile,
+		"-mv", "tinymeta",
+		"-o", "csv",
+	)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("command failed: %v\noutput: %s", err, output)
+	}
+
+	got, err := csv.NewReader(strings.NewReader(string(output))).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid csv: %v\noutput: %s", err, output)
+	}
+	want := [][]string{
+		{"file", "type", "vendor", "field", "value", "error"},
+		{"test.jpg", "jpeg", "tinymeta", "artist", "Test Artist", ""},
+		{"test.jpg", "jpeg", "tinymeta", "title", "A \"quoted\" title", ""},
+	}
+	if !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+}
+
+func Test_handleMeta_UnknownOutput(t *testing.T) {
+	cmd := exec.Command("./tinymedia.test",
+		"-i", "test.jpg",
+		"-mv", "tinymeta",
+		"-o", "yaml",
+	)
+
+	output, _ := cmd.CombinedOutput()
+	if !strings.Contains(string(output), "unknown output format") {
+		t.Errorf("expected unknown output format error, got:\n%s", output)
+	}
+}
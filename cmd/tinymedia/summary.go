@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// summary accounts the emitted results. The walked files of unsupported
+// types count as skipped, the ones never processed after a failure aren't
+// counted.
+type summary struct {
+	total     int
+	processed int
+	skipped   int
+	failed    int
+	written   int64
+	firstErr  error
+	progress  bool
+}
+
+func (s *summary) add(r fileResult) {
+	if r.skipped {
+		s.skipped++
+		return
+	}
+	s.processed++
+	s.written += r.written
+	if r.err != nil {
+		s.failed++
+		if s.firstErr == nil {
+			s.firstErr = r.err
+		}
+	}
+}
+
+func (s *summary) code() int {
+	switch {
+	case s.failed == 0:
+		return exitOK
+	case s.failed < s.processed:
+		return exitPartial
+	}
+	return errorCode(s.firstErr)
+}
+
+func (s *summary) report() {
+	if s.progress {
+		fmt.Fprintf(os.Stderr, "\r%d/%d done, %d failed", s.processed+s.skipped, s.total, s.failed)
+	}
+}
+
+// clearLine erases the progress line before anything else is written
+// to stderr.
+func (s *summary) clearLine() {
+	if s.progress {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+	}
+}
+
+func (s *summary) finish() {
+	if !s.progress {
+		return
+	}
+	s.clearLine()
+	fmt.Fprintf(os.Stderr, "processed: %d, skipped: %d, failed: %d, rewritten: %d bytes\n",
+		s.processed, s.skipped, s.failed, s.written)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func Test_handleMeta_Jobs(t *testing.T) {
+	var files []string
+	for i := range 20 {
+		fn := filepath.Join("./", fmt.Sprintf("test%d.jpg", i))
+		createTestJPEG(t, fn, "tinymeta", map[string]string{"n": fmt.Sprint(i)})
+		defer os.Remove(fn)
+		files = append(files, fn)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		ordered bool
+	}{
+		{name: "ordered", args: []string{"-j", "3"}, ordered: true},
+		{name: "stream", args: []string{"-j", "3", "-stream"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"get", "-v", "tinymeta", "-o", "ndjson"}, tt.args...)
+			output, err := exec.Command("./tinymedia.test", append(args, files...)...).Output()
+			if err != nil {
+				t.Fatalf("command failed: %v\noutput: %s", err, output)
+			}
+
+			var got []string
+			for line := range strings.Lines(string(output)) {
+				var r fileResult
+				if err := json.Unmarshal([]byte(line), &r); err != nil {
+					t.Fatalf("invalid json: %v\nline: %s", err, line)
+				}
+				got = append(got, r.File)
+			}
+			if tt.ordered && !slices.Equal(got, files) {
+				t.Errorf("want: %v, got: %v", files, got)
+			}
+			slices.Sort(got)
+			want := slices.Sorted(slices.Values(files))
+			if !slices.Equal(got, want) {
+				t.Errorf("want: %v, got: %v", want, got)
+			}
+		})
+	}
+}
+
+func Test_handleMeta_Progress(t *testing.T) {
+	file1 := filepath.Join("./", "test1.jpg")
+	file2 := filepath.Join("./", "test2.jpg")
+	createTestJPEG(t, file1, "tinymeta", nil)
+	defer os.Remove(file1)
+	createTestJPEG(t, file2, "tinymeta", nil)
+	defer os.Remove(file2)
+	info, _ := os.Stat(file1)
+
+	cmd := exec.Command("./tinymedia.test", "set", "-v", "tinymeta", "-f", "a=b", "-progress",
+		file1, file2, "missing.jpg")
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	cmd.Run()
+
+	updated, _ := os.Stat(file1)
+	want := fmt.Sprintf("processed: 3, skipped: 0, failed: 1, rewritten: %d bytes\n", 2*updated.Size())
+	if updated.Size() <= info.Size() || !strings.HasSuffix(stderr.String(), want) {
+		t.Errorf("want summary: %q, got:\n%q", want, stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "missing.jpg: ") {
+		t.Errorf("missing error, got:\n%q", stderr.String())
+	}
+}
+
+func Test_handleMeta_ProgressSkipped(t *testing.T) {
+	dir := t.TempDir()
+	createTestJPEG(t, filepath.Join(dir, "test.jpg"), "tinymeta", nil)
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("plain text"), 0644); err != nil {
+		t.Fatalf("failed to write the text file: %v", err)
+	}
+
+	cmd := exec.Command("./tinymedia.test", "list", "-r", "-progress", dir)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	cmd.Run()
+
+	if want := "processed: 1, skipped: 1, failed: 0, rewritten: 0 bytes\n"; !strings.HasSuffix(stderr.String(), want) {
+		t.Errorf("want summary: %q, got:\n%q", want, stderr.String())
+	}
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"os"
 	"strings"
 )
 
@@ -17,17 +19,128 @@ func (i *listFlag) Set(value string) error {
 	return nil
 }
 
+// backupFlag is a suffix that can be set as a bool flag, to the default one.
+type backupFlag string
+
+const defaultBackupSuffix = ".bak"
+
+func (b *backupFlag) String() string {
+	return string(*b)
+}
+
+func (b *backupFlag) Set(value string) error {
+	switch value {
+	case "true":
+		*b = defaultBackupSuffix
+	case "false":
+		*b = ""
+	case "":
+		return errors.New("empty suffix")
+	default:
+		*b = backupFlag(value)
+	}
+	return nil
+}
+
+func (b *backupFlag) IsBoolFlag() bool {
+	return true
+}
+
 func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return runLegacy(args)
+	}
+
+	name := args[0]
+	if name == "help" {
+		if len(args) > 1 {
+			if cmd, ok := commands[args[1]]; ok {
+				fs, _, _ := cmd.parser(args[1])
+				fs.Usage()
+				return exitOK
+			}
+		}
+		usage()
+		return exitOK
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", name)
+		usage()
+		return exitUsage
+	}
+	return cmd.run(name, args[1:])
+}
+
+// runLegacy handles the flags predating the subcommands.
+func runLegacy(args []string) int {
+	fs := flag.NewFlagSet("tinymedia", flag.ExitOnError)
+	fs.Usage = usage
+
 	var inputs listFlag
 
-	var meta = flag.String("m", "", "-m=field1=value1,field2=value2")
-	var metaVendor = flag.String("mv", "", "-mv=tinymeta")
-	flag.Var(&inputs, "i", "input files")
+	var meta = fs.String("m", "", "-m=field1=value1,field2=value2")
+	var metaVendor = fs.String("mv", "", "-mv=tinymeta")
+	var deleteMeta = fs.String("d", "", "-d=field1,field2")
+	var strip = fs.String("strip", "", "-strip=exif,xmp")
+	var stripAll = fs.Bool("strip-all", false, "remove all metadata not needed for rendering")
+	var listVendors = fs.Bool("l", false, "list the vendors present in the files")
+	opts := addRunFlags(fs)
+	fs.Var(&inputs, "i", "input files")
+
+	fs.Parse(args)
+
+	task := metaTask{
+		vendor:   *metaVendor,
+		delete:   splitList(*deleteMeta),
+		strip:    splitList(*strip),
+		stripAll: *stripAll,
+		vendors:  *listVendors,
+	}
+	task.read, task.update = parseFields(strings.Split(*meta, ","))
+	// a vendor alone dumps all of its fields
+	task.readAll = *meta == "" && *metaVendor != "" && len(task.delete) == 0
+	if task.empty() {
+		return exitOK
+	}
 
-	flag.Parse()
+	if task.vendor == "" && (len(task.read) > 0 || len(task.update) > 0) {
+		return usageError(fs, errors.New("-mv is required when -m is used"))
+	}
+	if task.vendor == "" && len(task.delete) > 0 {
+		return usageError(fs, errors.New("-mv is required when -d is used"))
+	}
+	if err := opts.validate(); err != nil {
+		return usageError(fs, err)
+	}
+	return handleMeta(inputs, task, *opts)
+}
+
+func usage() {
+	w := flag.CommandLine.Output()
+	fmt.Fprintln(w, "Usage: tinymedia <command> [flags] files...")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, name := range commandNames {
+		fmt.Fprintf(w, "  %-8s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "A single - file reads the image from stdin, a modified one is written to stdout.")
+	fmt.Fprintln(w, `Run "tinymedia help <command>" for the command flags.`)
+	fmt.Fprintln(w, "The legacy -i, -m and -mv flags are still accepted in place of a command.")
+}
 
-	metaFields := strings.Split(*meta, ",")
-	if len(metaFields) > 1 || metaFields[0] != "" {
-		handleMeta(inputs, metaFields, *metaVendor)
+func splitList(value string) []string {
+	var items []string
+	for item := range strings.SplitSeq(value, ",") {
+		if item != "" {
+			items = append(items, item)
+		}
 	}
+	return items
 }
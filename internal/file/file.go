@@ -1,31 +1,204 @@
 package file
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 )
 
+var (
+	ErrSymlink    = errors.New("file is a symlink")
+	ErrNotRegular = errors.New("not a regular file")
+)
+
+type UpdateOptions struct {
+	// FollowSymlinks replaces the file the link points to, instead of failing.
+	FollowSymlinks bool
+	// PreserveTimes keeps the modification time of the original file.
+	PreserveTimes bool
+	// Backup is the suffix of the copy of the original file kept beside it,
+	// none is kept if empty.
+	Backup string
+}
+
 func UpdateFile(r io.Reader, fileName string) error {
+	return UpdateFileWith(r, fileName, UpdateOptions{})
+}
+
+// UpdateFileWith atomically replaces the file with the content of r.
+// The new file keeps the mode, owner and extended attributes of the
+// original, and is synced to disk along with its directory before
+// UpdateFileWith returns.
+func UpdateFileWith(r io.Reader, fileName string, opts UpdateOptions) (err error) {
+	fileName, info, err := resolve(fileName, opts)
+	if err != nil {
+		return err
+	}
+
 	dir := filepath.Dir(fileName)
 	base := filepath.Base(fileName)
 
-	tmpFile, err := os.CreateTemp(dir, base)
+	tmpFile, err := os.CreateTemp(dir, "."+base+".tmp")
 	if err != nil {
 		return fmt.Errorf("failed to create temp file: %w", err)
 	}
-	defer tmpFile.Close()
+	defer func() {
+		if err != nil {
+			tmpFile.Close()
+			os.Remove(tmpFile.Name())
+		}
+	}()
 
 	if _, err := io.Copy(tmpFile, r); err != nil {
 		return fmt.Errorf("failed to copy file: %w", err)
 	}
 
-	if err := os.Rename(tmpFile.Name(), fileName); err != nil {
-		if errRemove := os.Remove(tmpFile.Name()); errRemove != nil {
-			err = errRemove
+	// the owner goes first, chown clears the setuid and setgid bits
+	if err := preserveOwner(tmpFile, info); err != nil {
+		return fmt.Errorf("failed to set file owner: %w", err)
+	}
+	if err := tmpFile.Chmod(info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)); err != nil {
+		return fmt.Errorf("failed to set file mode: %w", err)
+	}
+	if err := copyXattrs(fileName, tmpFile.Name()); err != nil {
+		return fmt.Errorf("failed to copy extended attributes: %w", err)
+	}
+
+	if err := tmpFile.Sync(); err != nil {
+		return fmt.Errorf("failed to sync temp file: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+
+	if opts.PreserveTimes {
+		// the zero access time is left as is
+		if err := os.Chtimes(tmpFile.Name(), info.ModTime(), info.ModTime()); err != nil {
+			return fmt.Errorf("failed to set file times: %w", err)
 		}
+	}
+
+	// the original is kept by linking it, its inode is left alone by the rename
+	if opts.Backup != "" {
+		if err := backup(fileName, opts.Backup, true); err != nil {
+			return fmt.Errorf("failed to back up file: %w", err)
+		}
+	}
+
+	if err := os.Rename(tmpFile.Name(), fileName); err != nil {
 		return fmt.Errorf("failed to rename temp file: %w", err)
 	}
+	return syncDir(dir)
+}
+
+// UpdateFileInPlace lets write overwrite parts of the file. Unlike
+// UpdateFileWith it isn't atomic, but the untouched parts are not copied.
+func UpdateFileInPlace(fileName string, opts UpdateOptions, write func(w io.WriterAt) error) error {
+	fileName, info, err := resolve(fileName, opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.Backup != "" {
+		if err := backup(fileName, opts.Backup, false); err != nil {
+			return fmt.Errorf("failed to back up file: %w", err)
+		}
+	}
+
+	f, err := os.OpenFile(fileName, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := write(f); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if opts.PreserveTimes {
+		if err := os.Chtimes(fileName, info.ModTime(), info.ModTime()); err != nil {
+			return fmt.Errorf("failed to set file times: %w", err)
+		}
+	}
 	return nil
 }
+
+// resolve applies the symlink policy, returning the regular file to update.
+func resolve(fileName string, opts UpdateOptions) (string, os.FileInfo, error) {
+	info, err := os.Lstat(fileName)
+	if err != nil {
+		return "", nil, err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		if !opts.FollowSymlinks {
+			return "", nil, ErrSymlink
+		}
+		if fileName, err = filepath.EvalSymlinks(fileName); err != nil {
+			return "", nil, err
+		}
+		if info, err = os.Stat(fileName); err != nil {
+			return "", nil, err
+		}
+	}
+	if !info.Mode().IsRegular() {
+		return "", nil, ErrNotRegular
+	}
+	return fileName, info, nil
+}
+
+// backup replaces the file suffixed with the copy of the original,
+// hard-linked to it if link is set and the file system allows.
+func backup(fileName, suffix string, link bool) error {
+	name := fileName + suffix
+	if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if link && os.Link(fileName, name) == nil {
+		return nil
+	}
+	return copyFile(fileName, name)
+}
+
+func copyFile(src, dst string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			out.Close()
+			os.Remove(dst)
+		}
+	}()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
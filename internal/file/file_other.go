@@ -0,0 +1,13 @@
+//go:build !unix
+
+package file
+
+import "os"
+
+func preserveOwner(f *os.File, info os.FileInfo) error {
+	return nil
+}
+
+func syncDir(dir string) error {
+	return nil
+}
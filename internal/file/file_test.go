@@ -2,8 +2,12 @@ package file
 
 import (
 	"bytes"
+	"errors"
+	"io"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func Test_UpdateFile(t *testing.T) {
@@ -30,3 +34,103 @@ func Test_UpdateFile(t *testing.T) {
 	}
 	defer f.Close()
 }
+
+func Test_UpdateFileWith(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target.jpg")
+	link := filepath.Join(dir, "link.jpg")
+	if err := os.WriteFile(target, []byte{0x01}, 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	os.Chtimes(target, mtime, mtime)
+
+	want := []byte{0xFF, 0xD8}
+	if err := UpdateFileWith(bytes.NewReader(want), link, UpdateOptions{}); err != ErrSymlink {
+		t.Errorf("want error: %v, got: %v", ErrSymlink, err)
+	}
+
+	opts := UpdateOptions{FollowSymlinks: true, PreserveTimes: true}
+	if err := UpdateFileWith(bytes.NewReader(want), link, opts); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+
+	if info, _ := os.Lstat(link); info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("link replaced by a file")
+	}
+	got, _ := os.ReadFile(target)
+	if !bytes.Equal(got, want) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+	info, _ := os.Stat(target)
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("want mode: %v, got: %v", os.FileMode(0640), info.Mode().Perm())
+	}
+	if !info.ModTime().Equal(mtime) {
+		t.Errorf("want mtime: %v, got: %v", mtime, info.ModTime())
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("read failed")
+}
+
+func Test_UpdateFileWith_Cleanup(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "test.jpg")
+	os.WriteFile(name, []byte{0x01}, 0644)
+
+	if err := UpdateFile(failingReader{}, name); err == nil {
+		t.Errorf("want error, got: %v", err)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("temp file left behind: %v", entries)
+	}
+	if got, _ := os.ReadFile(name); !bytes.Equal(got, []byte{0x01}) {
+		t.Errorf("original file changed: %v", got)
+	}
+
+	if err := UpdateFile(bytes.NewReader(nil), dir); err != ErrNotRegular {
+		t.Errorf("want error: %v, got: %v", ErrNotRegular, err)
+	}
+}
+
+func Test_UpdateFileWith_Backup(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "test.jpg")
+	original := []byte{0x01}
+	os.WriteFile(name, original, 0644)
+
+	want := []byte{0xFF, 0xD8}
+	if err := UpdateFileWith(bytes.NewReader(want), name, UpdateOptions{Backup: ".bak"}); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if got, _ := os.ReadFile(name); !bytes.Equal(got, want) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+	if got, _ := os.ReadFile(name + ".bak"); !bytes.Equal(got, original) {
+		t.Errorf("want backup: %v, got: %v", original, got)
+	}
+
+	// the backup of an in place update can't share the inode
+	err := UpdateFileInPlace(name, UpdateOptions{Backup: ".bak"}, func(w io.WriterAt) error {
+		_, err := w.WriteAt([]byte{0xD9}, 1)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if got, _ := os.ReadFile(name + ".bak"); !bytes.Equal(got, want) {
+		t.Errorf("want backup: %v, got: %v", want, got)
+	}
+	if got, _ := os.ReadFile(name); !bytes.Equal(got, []byte{0xFF, 0xD9}) {
+		t.Errorf("want: %v, got: %v", []byte{0xFF, 0xD9}, got)
+	}
+}
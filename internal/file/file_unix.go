@@ -0,0 +1,44 @@
+//go:build unix
+
+package file
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// preserveOwner gives f the owner of the original file. It's best effort,
+// as only root can give files away, the updated file of a user writing a
+// shared file they don't own is theirs.
+func preserveOwner(f *os.File, info os.FileInfo) error {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	if current, err := f.Stat(); err == nil {
+		if s, ok := current.Sys().(*syscall.Stat_t); ok && s.Uid == stat.Uid && s.Gid == stat.Gid {
+			return nil
+		}
+	}
+
+	err := f.Chown(int(stat.Uid), int(stat.Gid))
+	if errors.Is(err, syscall.EPERM) {
+		return nil
+	}
+	return err
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	// some file systems can't sync directories
+	if err := d.Sync(); err != nil && !errors.Is(err, syscall.EINVAL) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+//go:build unix
+
+package file
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func Test_UpdateFile_SetuidOwner(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("only root can give files away")
+	}
+
+	target := filepath.Join(t.TempDir(), "target")
+	os.WriteFile(target, []byte("old"), 0755)
+	if err := os.Chown(target, 65534, 65534); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	os.Chmod(target, 0755|os.ModeSetuid|os.ModeSetgid)
+
+	if err := UpdateFile(bytes.NewReader([]byte("new")), target); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+
+	info, err := os.Stat(target)
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if want := 0755 | os.ModeSetuid | os.ModeSetgid; info.Mode() != want {
+		t.Errorf("want mode: %v, got: %v", want, info.Mode())
+	}
+	if stat := info.Sys().(*syscall.Stat_t); stat.Uid != 65534 || stat.Gid != 65534 {
+		t.Errorf("want owner: %d:%d, got: %d:%d", 65534, 65534, stat.Uid, stat.Gid)
+	}
+}
@@ -5,6 +5,25 @@ type FileTypeMagic []byte
 var (
 	JPEGMagic = FileTypeMagic{0xFF, 0xD8}
 	PNGMagic  = FileTypeMagic{0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A}
+	// GIF87aMagic and GIF89aMagic are the two versions of the GIF header
+	GIF87aMagic = FileTypeMagic("GIF87a")
+	GIF89aMagic = FileTypeMagic("GIF89a")
+	// TIFFLEMagic and TIFFBEMagic are the little and big endian TIFF headers
+	TIFFLEMagic = FileTypeMagic("II*\x00")
+	TIFFBEMagic = FileTypeMagic("MM\x00*")
+	// FTYPMagic is the type of the first box of ISO-BMFF files, after its size
+	FTYPMagic = FileTypeMagic("ftyp")
+	// ID3Magic starts the ID3v2 tag in front of the MP3 frames
+	ID3Magic = FileTypeMagic("ID3")
+	// RIFFMagic is followed by the RIFF size, then WEBPMagic
+	RIFFMagic = FileTypeMagic("RIFF")
+	WEBPMagic = FileTypeMagic("WEBP")
 )
 
-const MagicPrefixMaxLength = 2
+const MagicPrefixMaxLength = 12
+
+// IsMPEGAudioSync reports whether the prefix starts with the frame sync of
+// an MPEG Layer III frame, as MP3 files without a tag do.
+func IsMPEGAudioSync(prefix []byte) bool {
+	return len(prefix) >= 2 && prefix[0] == 0xFF && prefix[1]&0xE6 == 0xE2
+}
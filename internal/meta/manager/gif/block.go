@@ -0,0 +1,218 @@
+package gif
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/zzvanq/tinymedia/pkg/meta/codec"
+)
+
+const (
+	extensionIntroducer = 0x21
+	imageSeparator      = 0x2C
+	trailer             = 0x3B
+
+	applicationLabel    = 0xFF
+	commentLabel        = 0xFE
+	graphicControlLabel = 0xF9
+
+	identifierSize  = 11
+	subBlockMaxSize = 255
+	// introducer, label and the identifier sub-block size
+	applicationHeaderSize = 3 + identifierSize
+)
+
+// rawTrailer follows the raw payloads, so a decoder skipping the
+// sub-blocks lands on the block terminator wherever it starts.
+var rawTrailer = func() []byte {
+	t := []byte{0x01}
+	for i := 0xFF; i >= 0; i-- {
+		t = append(t, byte(i))
+	}
+	return t
+}()
+
+// identifier derives the Application Extension identifier of a vendor
+// from its name: the first 8 bytes, then 3 more as the authentication code,
+// both padded with spaces.
+func identifier(vendor codec.MetaCodecVendor) []byte {
+	name := string(vendor) + strings.Repeat(" ", identifierSize)
+	return []byte(name[:identifierSize])
+}
+
+// readBlocks parses the extensions up to the first image or the trailer.
+func (m *GifMetaManager) readBlocks() error {
+	for !m.done {
+		b, err := m.nextBlock()
+		if err != nil {
+			return err
+		}
+		if b != nil {
+			m.blocks = append(m.blocks, b)
+		}
+	}
+	return nil
+}
+
+// nextBlock returns the next extension block, or nil once an image or the
+// trailer is reached, leaving it in r.
+func (m *GifMetaManager) nextBlock() ([]byte, error) {
+	introducer := make([]byte, 1)
+	if _, err := io.ReadFull(m.r, introducer); err != nil {
+		return nil, ErrCorruptedBlock
+	}
+
+	switch introducer[0] {
+	case imageSeparator, trailer:
+		m.done = true
+		m.r = io.MultiReader(bytes.NewReader(introducer), m.r)
+		return nil, nil
+	case extensionIntroducer:
+	default:
+		return nil, ErrCorruptedBlock
+	}
+
+	block := make([]byte, 2, 64)
+	block[0] = extensionIntroducer
+	if _, err := io.ReadFull(m.r, block[1:]); err != nil {
+		return nil, ErrCorruptedBlock
+	}
+
+	size := make([]byte, 1)
+	for {
+		if _, err := io.ReadFull(m.r, size); err != nil {
+			return nil, ErrCorruptedBlock
+		}
+		block = append(block, size[0])
+		if size[0] == 0 {
+			return block, nil
+		}
+
+		start := len(block)
+		block = append(block, make([]byte, size[0])...)
+		if _, err := io.ReadFull(m.r, block[start:]); err != nil {
+			return nil, ErrCorruptedBlock
+		}
+	}
+}
+
+func (m *GifMetaManager) findBlock(c CodecVendor) (int, error) {
+	if err := m.readBlocks(); err != nil {
+		return 0, err
+	}
+
+	for i, b := range m.blocks {
+		if c.matches(b) {
+			return i, nil
+		}
+	}
+	return 0, ErrBlockNotFound
+}
+
+func (c CodecVendor) matches(block []byte) bool {
+	if c.Identifier == nil {
+		return block[1] == commentLabel
+	}
+	return bytes.Equal(blockIdentifier(block), c.Identifier)
+}
+
+// headerSize returns the size of the block before its data sub-blocks.
+func (c CodecVendor) headerSize() int {
+	if c.Identifier == nil {
+		return 2
+	}
+	return applicationHeaderSize
+}
+
+// payload joins the data sub-blocks of the block.
+func (c CodecVendor) payload(block []byte) ([]byte, error) {
+	if c.Raw {
+		end := len(block) - len(rawTrailer) - 1
+		if end < applicationHeaderSize || !bytes.Equal(block[end:len(block)-1], rawTrailer) {
+			return nil, ErrCorruptedBlock
+		}
+		return block[applicationHeaderSize:end], nil
+	}
+
+	var data []byte
+	for i := c.headerSize(); i < len(block); {
+		size := int(block[i])
+		if size == 0 {
+			return data, nil
+		}
+		if i+1+size > len(block) {
+			return nil, ErrCorruptedBlock
+		}
+		data = append(data, block[i+1:i+1+size]...)
+		i += 1 + size
+	}
+	return nil, ErrCorruptedBlock
+}
+
+// createBlock chains the payload in sub-blocks of up to 255 bytes.
+func (c CodecVendor) createBlock(data []byte) []byte {
+	block := []byte{extensionIntroducer, commentLabel}
+	if c.Identifier != nil {
+		block = []byte{extensionIntroducer, applicationLabel, identifierSize}
+		block = append(block, c.Identifier...)
+	}
+
+	if c.Raw {
+		block = append(block, data...)
+		block = append(block, rawTrailer...)
+		return append(block, 0)
+	}
+
+	for len(data) > 0 {
+		n := min(len(data), subBlockMaxSize)
+		block = append(block, byte(n))
+		block = append(block, data[:n]...)
+		data = data[n:]
+	}
+	return append(block, 0)
+}
+
+func blockIdentifier(block []byte) []byte {
+	if len(block) < applicationHeaderSize || block[1] != applicationLabel || block[2] != identifierSize {
+		return nil
+	}
+	return block[3:applicationHeaderSize]
+}
+
+func blockVendor(block []byte) (codec.MetaCodecVendor, bool) {
+	if block[1] == commentLabel {
+		return codec.CommentVendor, true
+	}
+
+	id := blockIdentifier(block)
+	if id == nil {
+		return "", false
+	}
+	for vendor, c := range GifVendorsCodec {
+		if c.matches(block) {
+			return vendor, true
+		}
+	}
+	return codec.MetaCodecVendor(bytes.TrimRight(id, " \x00")), true
+}
+
+// commentField is the single field of the comment vendor.
+const commentField = "text"
+
+// commentCodec maps the text of a Comment Extension to its single field.
+type commentCodec struct{}
+
+func (commentCodec) Encode(fields map[string]string) ([]byte, error) {
+	for field := range fields {
+		if field != commentField {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownField, field)
+		}
+	}
+	return []byte(fields[commentField]), nil
+}
+
+func (commentCodec) Decode(data []byte) (map[string]string, error) {
+	return map[string]string{commentField: string(data)}, nil
+}
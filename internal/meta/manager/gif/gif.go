@@ -0,0 +1,287 @@
+package gif
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/zzvanq/tinymedia/internal/file/magic"
+	"github.com/zzvanq/tinymedia/pkg/meta"
+	"github.com/zzvanq/tinymedia/pkg/meta/codec"
+	"github.com/zzvanq/tinymedia/pkg/meta/codec/tinymeta"
+	"github.com/zzvanq/tinymedia/pkg/meta/codec/xmp"
+)
+
+var (
+	ErrVendorNotSupported = meta.ErrVendorNotSupported
+	ErrBlockNotFound      = fmt.Errorf("block %w", meta.ErrNotFound)
+	ErrCorruptedBlock     = fmt.Errorf("%w block", meta.ErrCorrupted)
+	ErrInvalidSignature   = fmt.Errorf("%w gif signature", meta.ErrInvalid)
+	ErrUnknownField       = errors.New("unknown comment field")
+)
+
+// CodecVendor is stored in an Application Extension named by the 8-byte
+// application identifier and the 3-byte authentication code, or in a
+// Comment Extension when there's no identifier. Raw payloads are written
+// as is, followed by the magic trailer making them look like sub-blocks,
+// as XMP is.
+type CodecVendor struct {
+	Codec      codec.Codec
+	Identifier []byte
+	Raw        bool
+}
+
+var GifVendorsCodec = map[codec.MetaCodecVendor]CodecVendor{
+	codec.TinyMetaVendor:     {tinymeta.TinyMeta, identifier(codec.TinyMetaVendor), false},
+	codec.TinyMetaGzipVendor: {tinymeta.TinyMetaGzip, identifier(codec.TinyMetaGzipVendor), false},
+	codec.XMPVendor:          {xmp.XMP, []byte("XMP DataXMP"), true},
+	codec.CommentVendor:      {commentCodec{}, nil, false},
+}
+
+// renderingApplications are the Application Extensions affecting how the
+// image plays.
+var renderingApplications = [][]byte{
+	[]byte("NETSCAPE2.0"),
+	[]byte("ANIMEXTS1.0"),
+}
+
+// GifMetaManager parses the extension blocks before the first image,
+// the image data is streamed untouched.
+type GifMetaManager struct {
+	prefix []byte
+	r      io.Reader
+	blocks [][]byte
+	// done is set once the first image or the trailer is reached
+	done bool
+}
+
+func NewGifMetaManager(r io.Reader) (*GifMetaManager, error) {
+	// the header and the logical screen descriptor
+	prefix := make([]byte, len(magic.GIF89aMagic)+7)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, fmt.Errorf("failed to read the magic bytes")
+	}
+
+	if !bytes.HasPrefix(prefix, magic.GIF87aMagic) && !bytes.HasPrefix(prefix, magic.GIF89aMagic) {
+		return nil, ErrInvalidSignature
+	}
+
+	// global color table
+	if flags := prefix[10]; flags&0x80 != 0 {
+		table := make([]byte, 3<<(flags&0x07+1))
+		if _, err := io.ReadFull(r, table); err != nil {
+			return nil, ErrCorruptedBlock
+		}
+		prefix = append(prefix, table...)
+	}
+
+	return &GifMetaManager{
+		prefix: prefix,
+		r:      r,
+		blocks: [][]byte{},
+	}, nil
+}
+
+func (m *GifMetaManager) Insert(vendor codec.MetaCodecVendor, fields map[string]string) error {
+	c, ok := GifVendorsCodec[vendor]
+	if !ok {
+		return ErrVendorNotSupported
+	}
+
+	encoded, err := c.Codec.Encode(fields)
+	if err != nil {
+		return err
+	}
+	return m.insert(c, encoded)
+}
+
+func (m *GifMetaManager) insert(c CodecVendor, encoded []byte) error {
+	if err := m.readBlocks(); err != nil {
+		return err
+	}
+	// the graphic control extension must stay right before its image
+	at := slices.IndexFunc(m.blocks, func(b []byte) bool { return b[1] == graphicControlLabel })
+	if at < 0 {
+		at = len(m.blocks)
+	}
+	m.blocks = slices.Insert(m.blocks, at, m.createBlock(c, encoded))
+	return nil
+}
+
+func (m *GifMetaManager) Upsert(vendor codec.MetaCodecVendor, fields map[string]string) error {
+	c, ok := GifVendorsCodec[vendor]
+	if !ok {
+		return ErrVendorNotSupported
+	}
+	return m.UpsertPayload(vendor, func(data []byte) ([]byte, error) {
+		return codec.Update(c.Codec, data, fields)
+	})
+}
+
+// UpsertPayload replaces the payload of the vendor with the one update
+// returns for it, given nil when there's none.
+func (m *GifMetaManager) UpsertPayload(vendor codec.MetaCodecVendor, update func(data []byte) ([]byte, error)) error {
+	c, ok := GifVendorsCodec[vendor]
+	if !ok {
+		return ErrVendorNotSupported
+	}
+
+	i, err := m.findBlock(c)
+	if err != nil {
+		if err == ErrBlockNotFound {
+			encoded, err := update(nil)
+			if err != nil {
+				return err
+			}
+			return m.insert(c, encoded)
+		}
+		return err
+	}
+
+	data, err := c.payload(m.blocks[i])
+	if err != nil {
+		return err
+	}
+
+	encoded, err := update(data)
+	if err != nil {
+		return err
+	}
+	m.blocks[i] = m.createBlock(c, encoded)
+	return nil
+}
+
+func (m *GifMetaManager) Extract(vendor codec.MetaCodecVendor, fields ...string) (map[string]string, error) {
+	decoded, err := m.Fields(vendor)
+	if err != nil {
+		return nil, err
+	}
+
+	return codec.Extract(GifVendorsCodec[vendor].Codec, decoded, fields...), nil
+}
+
+func (m *GifMetaManager) Fields(vendor codec.MetaCodecVendor) (map[string]string, error) {
+	c, ok := GifVendorsCodec[vendor]
+	if !ok {
+		return nil, ErrVendorNotSupported
+	}
+
+	data, err := m.Payload(vendor)
+	if err != nil {
+		return nil, err
+	}
+	return c.Codec.Decode(data)
+}
+
+// Payload returns the encoded payload of the vendor.
+func (m *GifMetaManager) Payload(vendor codec.MetaCodecVendor) ([]byte, error) {
+	c, ok := GifVendorsCodec[vendor]
+	if !ok {
+		return nil, ErrVendorNotSupported
+	}
+
+	i, err := m.findBlock(c)
+	if err != nil {
+		return nil, err
+	}
+	return c.payload(m.blocks[i])
+}
+
+// Vendors lists the vendors of the Application Extensions, the unknown
+// ones are named after their identifier, and of the Comment Extensions.
+func (m *GifMetaManager) Vendors() ([]codec.MetaCodecVendor, error) {
+	if err := m.readBlocks(); err != nil {
+		return nil, err
+	}
+
+	var vendors []codec.MetaCodecVendor
+	for _, b := range m.blocks {
+		vendor, ok := blockVendor(b)
+		if ok && !slices.Contains(vendors, vendor) {
+			vendors = append(vendors, vendor)
+		}
+	}
+	return vendors, nil
+}
+
+func (m *GifMetaManager) Delete(vendor codec.MetaCodecVendor, fields ...string) error {
+	c, ok := GifVendorsCodec[vendor]
+	if !ok {
+		return ErrVendorNotSupported
+	}
+
+	i, err := m.findBlock(c)
+	if err != nil {
+		return err
+	}
+
+	data, err := c.payload(m.blocks[i])
+	if err != nil {
+		return err
+	}
+
+	updated, err := codec.Delete(c.Codec, data, fields...)
+	if err != nil {
+		return err
+	}
+	if updated == nil {
+		m.blocks = slices.Delete(m.blocks, i, i+1)
+		return nil
+	}
+	m.blocks[i] = m.createBlock(c, updated)
+	return nil
+}
+
+func (m *GifMetaManager) Strip(vendors ...codec.MetaCodecVendor) error {
+	for _, vendor := range vendors {
+		c, ok := GifVendorsCodec[vendor]
+		if !ok {
+			return ErrVendorNotSupported
+		}
+
+		if err := m.readBlocks(); err != nil {
+			return err
+		}
+		m.blocks = slices.DeleteFunc(m.blocks, c.matches)
+	}
+	return nil
+}
+
+// StripAll removes the Comment Extensions and the Application Extensions
+// not needed to play the image, before the first image.
+func (m *GifMetaManager) StripAll() error {
+	if err := m.readBlocks(); err != nil {
+		return err
+	}
+
+	m.blocks = slices.DeleteFunc(m.blocks, func(b []byte) bool {
+		switch b[1] {
+		case commentLabel:
+			return true
+		case applicationLabel:
+			id := blockIdentifier(b)
+			return !slices.ContainsFunc(renderingApplications, func(r []byte) bool { return bytes.Equal(r, id) })
+		}
+		return false
+	})
+	return nil
+}
+
+// createBlock returns the extension block of the data, marking the file as
+// GIF89a since GIF87a has no extensions.
+func (m *GifMetaManager) createBlock(c CodecVendor, data []byte) []byte {
+	copy(m.prefix[3:6], "89a")
+	return c.createBlock(data)
+}
+
+func (m *GifMetaManager) FileReader() io.Reader {
+	readers := make([]io.Reader, 0, len(m.blocks)+2)
+	readers = append(readers, bytes.NewReader(m.prefix))
+	for _, b := range m.blocks {
+		readers = append(readers, bytes.NewReader(b))
+	}
+	readers = append(readers, m.r)
+	return io.MultiReader(readers...)
+}
@@ -0,0 +1,195 @@
+package gif
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/zzvanq/tinymedia/pkg/meta/codec"
+)
+
+var (
+	netscapeBlock = []byte{0x21, 0xFF, 0x0B, 'N', 'E', 'T', 'S', 'C', 'A', 'P', 'E', '2', '.', '0', 0x03, 0x01, 0x00, 0x00, 0x00}
+	commentBlock  = []byte{0x21, 0xFE, 0x02, 'h', 'i', 0x00}
+	gceBlock      = []byte{0x21, 0xF9, 0x04, 0x00, 0x0A, 0x00, 0x00, 0x00}
+	imageData     = []byte{0x2C, 0, 0, 0, 0, 1, 0, 1, 0, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3B}
+)
+
+// testGIF returns a 1x1 GIF with a 2 colors global table.
+func testGIF(blocks ...[]byte) []byte {
+	data := []byte("GIF89a")
+	data = append(data, 1, 0, 1, 0, 0x80, 0, 0)
+	data = append(data, 0, 0, 0, 0xFF, 0xFF, 0xFF)
+	for _, b := range blocks {
+		data = append(data, b...)
+	}
+	return append(data, imageData...)
+}
+
+func Test_NewGifMetaManager(t *testing.T) {
+	if _, err := NewGifMetaManager(bytes.NewReader([]byte("GIF90a\x01\x00\x01\x00\x00\x00\x00"))); err != ErrInvalidSignature {
+		t.Errorf("want error: %v, got: %v", ErrInvalidSignature, err)
+	}
+	if _, err := NewGifMetaManager(bytes.NewReader([]byte("GIF87a\x01\x00\x01\x00\x80\x00\x00"))); err != ErrCorruptedBlock {
+		t.Errorf("want error: %v, got: %v", ErrCorruptedBlock, err)
+	}
+}
+
+func Test_GifMetaManager_UpsertExtract(t *testing.T) {
+	tests := []struct {
+		name   string
+		vendor codec.MetaCodecVendor
+		field  string
+	}{
+		{name: "tinymeta", vendor: codec.TinyMetaVendor, field: "artist"},
+		{name: "tinymetagzip", vendor: codec.TinyMetaGzipVendor, field: "artist"},
+		{name: "xmp", vendor: codec.XMPVendor, field: "dc:creator"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := testGIF(netscapeBlock, gceBlock)
+			m, err := NewGifMetaManager(bytes.NewReader(file))
+			if err != nil {
+				t.Fatalf("want error: %v, got: %v", nil, err)
+			}
+			// chained in several sub-blocks
+			long := strings.Repeat("a", 3*subBlockMaxSize)
+			if err := m.Upsert(tt.vendor, map[string]string{tt.field: long}); err != nil {
+				t.Fatalf("want error: %v, got: %v", nil, err)
+			}
+
+			data, _ := io.ReadAll(m.FileReader())
+			m, _ = NewGifMetaManager(bytes.NewReader(data))
+			if err := m.Upsert(tt.vendor, map[string]string{tt.field: "b"}); err != nil {
+				t.Fatalf("want error: %v, got: %v", nil, err)
+			}
+
+			data, _ = io.ReadAll(m.FileReader())
+			m, _ = NewGifMetaManager(bytes.NewReader(data))
+			got, err := m.Extract(tt.vendor, tt.field)
+			if err != nil {
+				t.Fatalf("want error: %v, got: %v", nil, err)
+			}
+			if want := map[string]string{tt.field: "b"}; !maps.Equal(got, want) {
+				t.Errorf("want: %v, got: %v", want, got)
+			}
+
+			if !bytes.HasSuffix(data, append(gceBlock, imageData...)) {
+				t.Errorf("graphic control extension or image data moved: %v", data)
+			}
+		})
+	}
+}
+
+func Test_GifMetaManager_Upgrade87a(t *testing.T) {
+	file := testGIF()
+	copy(file[3:6], "87a")
+	m, err := NewGifMetaManager(bytes.NewReader(file))
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if err := m.Upsert(codec.TinyMetaVendor, map[string]string{"artist": "a"}); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+
+	data, _ := io.ReadAll(m.FileReader())
+	if !bytes.HasPrefix(data, []byte("GIF89a")) {
+		t.Errorf("want a GIF89a header, got: %q", data[:6])
+	}
+	if !bytes.Equal(data[6:len(testGIF())-len(imageData)], file[6:len(file)-len(imageData)]) || !bytes.HasSuffix(data, imageData) {
+		t.Errorf("want the screen and the image unchanged, got: %v", data)
+	}
+}
+
+func Test_GifMetaManager_Delete(t *testing.T) {
+	m, _ := NewGifMetaManager(bytes.NewReader(testGIF()))
+	m.Upsert(codec.TinyMetaVendor, map[string]string{"artist": "a", "title": "t"})
+
+	if err := m.Delete(codec.TinyMetaVendor, "artist"); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	got, _ := m.Fields(codec.TinyMetaVendor)
+	if want := map[string]string{"title": "t"}; !maps.Equal(got, want) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+
+	if err := m.Delete(codec.TinyMetaVendor, "title"); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if _, err := m.Fields(codec.TinyMetaVendor); err != ErrBlockNotFound {
+		t.Errorf("want error: %v, got: %v", ErrBlockNotFound, err)
+	}
+}
+
+func Test_GifMetaManager_Comment(t *testing.T) {
+	m, _ := NewGifMetaManager(bytes.NewReader(testGIF(netscapeBlock, commentBlock, gceBlock)))
+	got, err := m.Fields(codec.CommentVendor)
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if want := map[string]string{"text": "hi"}; !maps.Equal(got, want) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+
+	text := strings.Repeat("c", 300)
+	if err := m.Upsert(codec.CommentVendor, map[string]string{"text": text}); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if err := m.Upsert(codec.CommentVendor, map[string]string{"artist": "a"}); !errors.Is(err, ErrUnknownField) {
+		t.Errorf("want error: %v, got: %v", ErrUnknownField, err)
+	}
+
+	data, _ := io.ReadAll(m.FileReader())
+	m, _ = NewGifMetaManager(bytes.NewReader(data))
+	got, _ = m.Fields(codec.CommentVendor)
+	if want := map[string]string{"text": text}; !maps.Equal(got, want) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+
+	if err := m.Delete(codec.CommentVendor, "text"); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	data, _ = io.ReadAll(m.FileReader())
+	if want := testGIF(netscapeBlock, gceBlock); !bytes.Equal(data, want) {
+		t.Errorf("want: %v, got: %v", want, data)
+	}
+}
+
+func Test_GifMetaManager_StripVendors(t *testing.T) {
+	m, _ := NewGifMetaManager(bytes.NewReader(testGIF(netscapeBlock, commentBlock, gceBlock)))
+	m.Upsert(codec.TinyMetaVendor, map[string]string{"artist": "a"})
+	m.Upsert(codec.XMPVendor, map[string]string{"dc:title": "t"})
+
+	vendors, err := m.Vendors()
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	want := []codec.MetaCodecVendor{"NETSCAPE2.0", codec.CommentVendor, codec.TinyMetaVendor, codec.XMPVendor}
+	if !slices.Equal(vendors, want) {
+		t.Errorf("want: %v, got: %v", want, vendors)
+	}
+
+	if err := m.Strip(codec.XMPVendor); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if err := m.StripAll(); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	data, _ := io.ReadAll(m.FileReader())
+	if want := testGIF(netscapeBlock, gceBlock); !bytes.Equal(data, want) {
+		t.Errorf("want: %v, got: %v", want, data)
+	}
+}
+
+func Test_GifMetaManager_Corrupted(t *testing.T) {
+	file := testGIF(netscapeBlock)
+	m, _ := NewGifMetaManager(bytes.NewReader(file[:len(file)-len(imageData)-3]))
+	if _, err := m.Fields(codec.TinyMetaVendor); err != ErrCorruptedBlock {
+		t.Errorf("want error: %v, got: %v", ErrCorruptedBlock, err)
+	}
+}
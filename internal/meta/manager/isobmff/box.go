@@ -0,0 +1,294 @@
+package isobmff
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"math"
+	"slices"
+
+	"github.com/zzvanq/tinymedia/pkg/meta/codec"
+)
+
+const (
+	headerSize    = 8
+	largeSizeSize = 8
+	uuidSize      = 16
+	// sizeLarge tells the size follows the type as 64 bits
+	sizeLarge = 1
+	// sizeToEnd tells the box extends to the end of the file
+	sizeToEnd = 0
+)
+
+const (
+	typeFTYP = "ftyp"
+	typeUUID = "uuid"
+	typeFREE = "free"
+	typeMDAT = "mdat"
+	typeMOOV = "moov"
+	typeMOOF = "moof"
+	typeSIDX = "sidx"
+	typeMFRA = "mfra"
+	typeMETA = "meta"
+	typeHDLR = "hdlr"
+	typeILOC = "iloc"
+	typeSTCO = "stco"
+	typeCO64 = "co64"
+)
+
+// boxUUID derives the uuid of a vendor from its name, as a name-based
+// UUID so it never changes.
+func boxUUID(vendor codec.MetaCodecVendor) []byte {
+	sum := sha1.Sum([]byte("tinymedia:" + vendor))
+	id := sum[:uuidSize]
+	id[6] = id[6]&0x0F | 0x50
+	id[8] = id[8]&0x3F | 0x80
+	return id
+}
+
+// fileBox is a top-level box. The body of the media data boxes is left in the
+// file when it can be seeked, data is only their header then.
+type fileBox struct {
+	data []byte
+	body *io.SectionReader
+}
+
+func (b fileBox) size() uint64 {
+	if b.body == nil {
+		return uint64(len(b.data))
+	}
+	return uint64(len(b.data)) + uint64(b.body.Size())
+}
+
+func (b fileBox) reader() io.Reader {
+	if b.body == nil {
+		return bytes.NewReader(b.data)
+	}
+	return io.MultiReader(bytes.NewReader(b.data), io.NewSectionReader(b.body, 0, b.body.Size()))
+}
+
+type readSeekerAt interface {
+	io.ReadSeeker
+	io.ReaderAt
+}
+
+// readBoxes parses the top-level boxes of the file.
+func (m *IsobmffMetaManager) readBoxes() error {
+	if m.parsed {
+		return m.err
+	}
+	m.parsed = true
+
+	for {
+		b, err := m.readBox()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			m.err = err
+			return err
+		}
+		m.boxes = append(m.boxes, b)
+	}
+	return nil
+}
+
+// readBox returns the next box with its header, io.EOF at the end.
+func (m *IsobmffMetaManager) readBox() (fileBox, error) {
+	header := make([]byte, headerSize, headerSize+largeSizeSize)
+	if n, err := io.ReadFull(m.r, header); err != nil {
+		if n == 0 && err == io.EOF {
+			return fileBox{}, io.EOF
+		}
+		return fileBox{}, ErrCorruptedBox
+	}
+
+	size := uint64(binary.BigEndian.Uint32(header))
+	if size == sizeLarge {
+		header = header[:headerSize+largeSizeSize]
+		if _, err := io.ReadFull(m.r, header[headerSize:]); err != nil {
+			return fileBox{}, ErrCorruptedBox
+		}
+		size = binary.BigEndian.Uint64(header[headerSize:])
+	}
+	if size != sizeToEnd && size < uint64(len(header)) {
+		return fileBox{}, ErrCorruptedBox
+	}
+
+	if rs, ok := m.r.(readSeekerAt); ok && boxType(header) == typeMDAT {
+		return skipBody(rs, header, size)
+	}
+
+	if size == sizeToEnd {
+		rest, err := io.ReadAll(m.r)
+		if err != nil {
+			return fileBox{}, err
+		}
+		return fileBox{data: append(header, rest...)}, nil
+	}
+
+	// limited so a corrupted size doesn't allocate it all at once
+	bodySize := size - uint64(len(header))
+	body, err := io.ReadAll(io.LimitReader(m.r, int64(min(bodySize, math.MaxInt64))))
+	if err != nil {
+		return fileBox{}, err
+	}
+	if uint64(len(body)) != bodySize {
+		return fileBox{}, ErrCorruptedBox
+	}
+	return fileBox{data: append(header, body...)}, nil
+}
+
+// skipBody seeks past the body of the box, keeping it as a section of rs.
+func skipBody(rs readSeekerAt, header []byte, size uint64) (fileBox, error) {
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fileBox{}, err
+	}
+	end, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fileBox{}, err
+	}
+
+	bodySize := uint64(end - start)
+	if size != sizeToEnd {
+		if size-uint64(len(header)) > bodySize {
+			return fileBox{}, ErrCorruptedBox
+		}
+		bodySize = size - uint64(len(header))
+	}
+	if _, err := rs.Seek(start+int64(bodySize), io.SeekStart); err != nil {
+		return fileBox{}, err
+	}
+	return fileBox{data: header, body: io.NewSectionReader(rs, start, int64(bodySize))}, nil
+}
+
+// children splits the body of a container box in its boxes.
+func children(body []byte) ([][]byte, error) {
+	var boxes [][]byte
+	for len(body) > 0 {
+		if len(body) < headerSize {
+			return nil, ErrCorruptedBox
+		}
+		size := uint64(binary.BigEndian.Uint32(body))
+		switch size {
+		case sizeToEnd:
+			size = uint64(len(body))
+		case sizeLarge:
+			if len(body) < headerSize+largeSizeSize {
+				return nil, ErrCorruptedBox
+			}
+			size = binary.BigEndian.Uint64(body[headerSize:])
+		}
+		if size < headerSize || size > uint64(len(body)) {
+			return nil, ErrCorruptedBox
+		}
+		boxes = append(boxes, body[:size])
+		body = body[size:]
+	}
+	return boxes, nil
+}
+
+// findBoxes returns the boxes at the path of box types.
+func findBoxes(boxes [][]byte, path ...string) ([][]byte, error) {
+	var found [][]byte
+	for _, box := range boxes {
+		if boxType(box) != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			found = append(found, box)
+			continue
+		}
+		kids, err := children(boxBody(box))
+		if err != nil {
+			return nil, err
+		}
+		nested, err := findBoxes(kids, path[1:]...)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, nested...)
+	}
+	return found, nil
+}
+
+func createUUIDBox(id, data []byte) []byte {
+	return createBox(typeUUID, id, data)
+}
+
+// createBox returns the box of the body parts, with a 64 bits size when
+// it's too large for 32.
+func createBox(typ string, body ...[]byte) []byte {
+	size := uint64(headerSize)
+	for _, part := range body {
+		size += uint64(len(part))
+	}
+
+	var box []byte
+	if size > math.MaxUint32 {
+		box = binary.BigEndian.AppendUint32(nil, sizeLarge)
+		box = append(box, typ...)
+		box = binary.BigEndian.AppendUint64(box, size+largeSizeSize)
+	} else {
+		box = binary.BigEndian.AppendUint32(nil, uint32(size))
+		box = append(box, typ...)
+	}
+	for _, part := range body {
+		box = append(box, part...)
+	}
+	return box
+}
+
+// freeBox returns a zero-filled free box of the size of the box.
+func freeBox(box []byte) []byte {
+	free := slices.Clone(box)
+	copy(free[4:headerSize], typeFREE)
+	clear(free[boxHeaderSize(free):])
+	return free
+}
+
+func boxType(box []byte) string {
+	return string(box[4:headerSize])
+}
+
+func boxHeaderSize(box []byte) int {
+	if binary.BigEndian.Uint32(box) == sizeLarge {
+		return headerSize + largeSizeSize
+	}
+	return headerSize
+}
+
+// boxBody returns the box without its header, and without the version and
+// flags of an ISO meta box, which QuickTime leaves out.
+func boxBody(box []byte) []byte {
+	body := box[boxHeaderSize(box):]
+	if boxType(box) == typeMETA && len(body) >= 8 && string(body[4:8]) != typeHDLR {
+		return body[4:]
+	}
+	return body
+}
+
+// boxID returns the extended type of a uuid box.
+func boxID(box []byte) ([]byte, bool) {
+	body := box[boxHeaderSize(box):]
+	if boxType(box) != typeUUID || len(body) < uuidSize {
+		return nil, false
+	}
+	return body[:uuidSize], true
+}
+
+func boxVendor(box []byte) (codec.MetaCodecVendor, bool) {
+	id, ok := boxID(box)
+	if !ok {
+		return "", false
+	}
+	for vendor, c := range IsobmffVendorsCodec {
+		if bytes.Equal(c.UUID, id) {
+			return vendor, true
+		}
+	}
+	return codec.MetaCodecVendor(hex.EncodeToString(id)), true
+}
@@ -0,0 +1,365 @@
+package isobmff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/zzvanq/tinymedia/internal/file/magic"
+	"github.com/zzvanq/tinymedia/pkg/meta"
+	"github.com/zzvanq/tinymedia/pkg/meta/codec"
+	"github.com/zzvanq/tinymedia/pkg/meta/codec/tinymeta"
+	"github.com/zzvanq/tinymedia/pkg/meta/codec/xmp"
+)
+
+var (
+	ErrVendorNotSupported = meta.ErrVendorNotSupported
+	ErrBoxNotFound        = fmt.Errorf("box %w", meta.ErrNotFound)
+	ErrCorruptedBox       = fmt.Errorf("%w box", meta.ErrCorrupted)
+	ErrInvalidSignature   = fmt.Errorf("%w iso-bmff signature", meta.ErrInvalid)
+	ErrOffsetOverflow     = fmt.Errorf("overflowing offsets %w", meta.ErrNotSupported)
+	ErrFragmented         = fmt.Errorf("moving fragments %w", meta.ErrNotSupported)
+)
+
+// UUID is the extended type of the top-level uuid box the payload is
+// stored in.
+type CodecVendor struct {
+	Codec codec.Codec
+	UUID  []byte
+}
+
+var IsobmffVendorsCodec = map[codec.MetaCodecVendor]CodecVendor{
+	codec.TinyMetaVendor:     {tinymeta.TinyMeta, boxUUID(codec.TinyMetaVendor)},
+	codec.TinyMetaGzipVendor: {tinymeta.TinyMetaGzip, boxUUID(codec.TinyMetaGzipVendor)},
+	// the uuid of the XMP box Adobe defines
+	codec.XMPVendor: {xmp.XMP, []byte{
+		0xBE, 0x7A, 0xCF, 0xCB, 0x97, 0xA9, 0x42, 0xE8,
+		0x9C, 0x71, 0x99, 0x94, 0x91, 0xE3, 0xAF, 0xAC,
+	}},
+}
+
+// IsobmffMetaManager reads all the top-level boxes on the first access,
+// the media data is only buffered when the reader can't be seeked.
+// The boxes are inserted before the media data when the offsets pointing
+// in it are in a movie box preceding it, after the media data otherwise,
+// so the offsets of fragmented files never move.
+type IsobmffMetaManager struct {
+	r      io.Reader
+	boxes  []fileBox
+	parsed bool
+	err    error
+}
+
+func NewIsobmffMetaManager(r io.Reader) (*IsobmffMetaManager, error) {
+	prefix := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, fmt.Errorf("failed to read the magic bytes")
+	}
+
+	if !bytes.Equal(prefix[4:], magic.FTYPMagic) {
+		return nil, ErrInvalidSignature
+	}
+
+	if rs, ok := r.(io.Seeker); ok {
+		if _, err := rs.Seek(-headerSize, io.SeekCurrent); err != nil {
+			return nil, err
+		}
+		return &IsobmffMetaManager{r: r}, nil
+	}
+	return &IsobmffMetaManager{
+		r: io.MultiReader(bytes.NewReader(prefix), r),
+	}, nil
+}
+
+func (m *IsobmffMetaManager) Insert(vendor codec.MetaCodecVendor, fields map[string]string) error {
+	c, ok := IsobmffVendorsCodec[vendor]
+	if !ok {
+		return ErrVendorNotSupported
+	}
+
+	encoded, err := c.Codec.Encode(fields)
+	if err != nil {
+		return err
+	}
+	return m.insert(c, encoded)
+}
+
+func (m *IsobmffMetaManager) insert(c CodecVendor, encoded []byte) error {
+	if err := m.readBoxes(); err != nil {
+		return err
+	}
+
+	return m.insertBox(m.insertIndex(), createUUIDBox(c.UUID, encoded))
+}
+
+// insertIndex returns where a box goes: after the last media data when no
+// offset would move that way, before the first one otherwise. The
+// fragment random access box stays last, and a box extending to the end
+// of the file can't be followed.
+func (m *IsobmffMetaManager) insertIndex() int {
+	first, last := -1, -1
+	for i, b := range m.boxes {
+		if boxType(b.data) == typeMDAT {
+			last = i
+			if first < 0 {
+				first = i
+			}
+		}
+	}
+	if last < 0 {
+		first = len(m.boxes)
+	}
+
+	end := len(m.boxes)
+	if end > 0 && boxType(m.boxes[end-1].data) == typeMFRA {
+		end--
+	}
+	if end > 0 && binary.BigEndian.Uint32(m.boxes[end-1].data) == sizeToEnd {
+		return min(first, end-1)
+	}
+
+	after := slices.ContainsFunc(m.boxes[last+1:], func(b fileBox) bool {
+		return boxType(b.data) == typeMOOV
+	})
+	if after || m.fragmented() {
+		return end
+	}
+	return first
+}
+
+// fragmented tells the file stores its media in movie fragments.
+func (m *IsobmffMetaManager) fragmented() bool {
+	return slices.ContainsFunc(m.boxes, func(b fileBox) bool {
+		return boxType(b.data) == typeMOOF
+	})
+}
+
+func (m *IsobmffMetaManager) Upsert(vendor codec.MetaCodecVendor, fields map[string]string) error {
+	c, ok := IsobmffVendorsCodec[vendor]
+	if !ok {
+		return ErrVendorNotSupported
+	}
+	return m.UpsertPayload(vendor, func(data []byte) ([]byte, error) {
+		return codec.Update(c.Codec, data, fields)
+	})
+}
+
+// UpsertPayload replaces the payload of the vendor with the one update
+// returns for it, given nil when there's none.
+func (m *IsobmffMetaManager) UpsertPayload(vendor codec.MetaCodecVendor, update func(data []byte) ([]byte, error)) error {
+	c, ok := IsobmffVendorsCodec[vendor]
+	if !ok {
+		return ErrVendorNotSupported
+	}
+
+	i, err := m.findBox(c)
+	if err != nil {
+		if err == ErrBoxNotFound {
+			encoded, err := update(nil)
+			if err != nil {
+				return err
+			}
+			return m.insert(c, encoded)
+		}
+		return err
+	}
+
+	encoded, err := update(c.payload(m.boxes[i].data))
+	if err != nil {
+		return err
+	}
+	return m.replaceBox(i, createUUIDBox(c.UUID, encoded))
+}
+
+func (m *IsobmffMetaManager) Extract(vendor codec.MetaCodecVendor, fields ...string) (map[string]string, error) {
+	decoded, err := m.Fields(vendor)
+	if err != nil {
+		return nil, err
+	}
+
+	return codec.Extract(IsobmffVendorsCodec[vendor].Codec, decoded, fields...), nil
+}
+
+func (m *IsobmffMetaManager) Fields(vendor codec.MetaCodecVendor) (map[string]string, error) {
+	c, ok := IsobmffVendorsCodec[vendor]
+	if !ok {
+		return nil, ErrVendorNotSupported
+	}
+
+	data, err := m.Payload(vendor)
+	if err != nil {
+		return nil, err
+	}
+	return c.Codec.Decode(data)
+}
+
+// Payload returns the encoded payload of the vendor.
+func (m *IsobmffMetaManager) Payload(vendor codec.MetaCodecVendor) ([]byte, error) {
+	c, ok := IsobmffVendorsCodec[vendor]
+	if !ok {
+		return nil, ErrVendorNotSupported
+	}
+
+	i, err := m.findBox(c)
+	if err != nil {
+		return nil, err
+	}
+	return c.payload(m.boxes[i].data), nil
+}
+
+// Vendors lists the vendors of the top-level uuid boxes, the unknown ones
+// are named after their hex encoded uuid.
+func (m *IsobmffMetaManager) Vendors() ([]codec.MetaCodecVendor, error) {
+	if err := m.readBoxes(); err != nil {
+		return nil, err
+	}
+
+	var vendors []codec.MetaCodecVendor
+	for _, b := range m.boxes {
+		vendor, ok := boxVendor(b.data)
+		if ok && !slices.Contains(vendors, vendor) {
+			vendors = append(vendors, vendor)
+		}
+	}
+	return vendors, nil
+}
+
+func (m *IsobmffMetaManager) Delete(vendor codec.MetaCodecVendor, fields ...string) error {
+	c, ok := IsobmffVendorsCodec[vendor]
+	if !ok {
+		return ErrVendorNotSupported
+	}
+
+	i, err := m.findBox(c)
+	if err != nil {
+		return err
+	}
+
+	updated, err := codec.Delete(c.Codec, c.payload(m.boxes[i].data), fields...)
+	if err != nil {
+		return err
+	}
+	if updated == nil {
+		return m.removeBox(i)
+	}
+	return m.replaceBox(i, createUUIDBox(c.UUID, updated))
+}
+
+func (m *IsobmffMetaManager) Strip(vendors ...codec.MetaCodecVendor) error {
+	for _, vendor := range vendors {
+		c, ok := IsobmffVendorsCodec[vendor]
+		if !ok {
+			return ErrVendorNotSupported
+		}
+
+		if err := m.removeBoxes(c.matches); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StripAll removes every top-level uuid box.
+func (m *IsobmffMetaManager) StripAll() error {
+	return m.removeBoxes(func(box []byte) bool { return boxType(box) == typeUUID })
+}
+
+func (m *IsobmffMetaManager) FileReader() io.Reader {
+	if !m.parsed {
+		return m.r
+	}
+
+	readers := make([]io.Reader, 0, len(m.boxes))
+	for _, b := range m.boxes {
+		readers = append(readers, b.reader())
+	}
+	return io.MultiReader(readers...)
+}
+
+func (m *IsobmffMetaManager) findBox(c CodecVendor) (int, error) {
+	if err := m.readBoxes(); err != nil {
+		return 0, err
+	}
+
+	i := slices.IndexFunc(m.boxes, func(b fileBox) bool { return c.matches(b.data) })
+	if i < 0 {
+		return 0, ErrBoxNotFound
+	}
+	return i, nil
+}
+
+// offset returns the position of the box in the file.
+func (m *IsobmffMetaManager) offset(i int) uint64 {
+	var offset uint64
+	for _, b := range m.boxes[:i] {
+		offset += b.size()
+	}
+	return offset
+}
+
+func (m *IsobmffMetaManager) insertBox(i int, box []byte) error {
+	if err := m.shift(i, int64(len(box))); err != nil {
+		return err
+	}
+	m.boxes = slices.Insert(m.boxes, i, fileBox{data: box})
+	return nil
+}
+
+// replaceBox replaces the box in place. When that would move movie
+// fragments, the new box is inserted where boxes go and the old one is
+// turned into a zero-filled free box of the same size instead.
+func (m *IsobmffMetaManager) replaceBox(i int, box []byte) error {
+	old := m.boxes[i].data
+	err := m.shift(i+1, int64(len(box))-int64(len(old)))
+	if err == ErrFragmented {
+		if err := m.insertBox(m.insertIndex(), box); err != nil {
+			return err
+		}
+		m.boxes[i] = fileBox{data: freeBox(old)}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	m.boxes[i] = fileBox{data: box}
+	return nil
+}
+
+func (m *IsobmffMetaManager) removeBox(i int) error {
+	old := m.boxes[i].data
+	if err := m.shift(i+1, -int64(len(old))); err != nil {
+		return err
+	}
+	m.boxes = slices.Delete(m.boxes, i, i+1)
+	return nil
+}
+
+// removeBoxes removes the matching boxes from the last one, so the
+// indexes of the others don't move.
+func (m *IsobmffMetaManager) removeBoxes(match func([]byte) bool) error {
+	if err := m.readBoxes(); err != nil {
+		return err
+	}
+
+	for i := len(m.boxes) - 1; i >= 0; i-- {
+		if !match(m.boxes[i].data) {
+			continue
+		}
+		if err := m.removeBox(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c CodecVendor) matches(box []byte) bool {
+	id, ok := boxID(box)
+	return ok && bytes.Equal(id, c.UUID)
+}
+
+// payload returns the data after the uuid.
+func (c CodecVendor) payload(box []byte) []byte {
+	return box[boxHeaderSize(box)+uuidSize:]
+}
@@ -0,0 +1,291 @@
+package isobmff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/zzvanq/tinymedia/pkg/meta/codec"
+)
+
+var (
+	ftypBox = box("ftyp", []byte("isom\x00\x00\x00\x00"))
+	media   = []byte("media")
+)
+
+func box(typ string, body ...[]byte) []byte {
+	data := slices.Concat(body...)
+	b := binary.BigEndian.AppendUint32(nil, uint32(headerSize+len(data)))
+	b = append(b, typ...)
+	return append(b, data...)
+}
+
+// largeBox returns the box with a 64 bits size.
+func largeBox(typ string, body []byte) []byte {
+	b := binary.BigEndian.AppendUint32(nil, sizeLarge)
+	b = append(b, typ...)
+	b = binary.BigEndian.AppendUint64(b, uint64(headerSize+largeSizeSize+len(body)))
+	return append(b, body...)
+}
+
+// movie returns a moov box with a track whose single chunk is at offset.
+func movie(table string, offset uint64) []byte {
+	entries := binary.BigEndian.AppendUint32(make([]byte, fullBoxSize), 1)
+	if table == typeSTCO {
+		entries = binary.BigEndian.AppendUint32(entries, uint32(offset))
+	} else {
+		entries = binary.BigEndian.AppendUint64(entries, offset)
+	}
+	stbl := box("stbl", box(table, entries))
+	return box("moov", box("trak", box("mdia", box("minf", stbl))))
+}
+
+// itemMeta returns a HEIF meta box with an item at offset.
+func itemMeta(offset uint32) []byte {
+	// version 1, 4 bytes offsets, lengths and base offsets
+	iloc := []byte{1, 0, 0, 0, 0x44, 0x40, 0, 1}
+	// item 1 in the file, base offset 0 and a single extent
+	iloc = append(iloc, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1)
+	iloc = binary.BigEndian.AppendUint32(iloc, offset)
+	iloc = binary.BigEndian.AppendUint32(iloc, uint32(len(media)))
+	hdlr := box("hdlr", make([]byte, fullBoxSize), []byte("\x00\x00\x00\x00pict"), make([]byte, 13))
+	return box("meta", make([]byte, fullBoxSize), hdlr, box("iloc", iloc))
+}
+
+func Test_NewIsobmffMetaManager(t *testing.T) {
+	if _, err := NewIsobmffMetaManager(bytes.NewReader(box("moov"))); err != ErrInvalidSignature {
+		t.Errorf("want error: %v, got: %v", ErrInvalidSignature, err)
+	}
+}
+
+func Test_IsobmffMetaManager_Offsets(t *testing.T) {
+	mdat := box("mdat", media)
+	// the media starts after the mdat header
+	offset := uint64(len(ftypBox) + headerSize)
+	tests := []struct {
+		name string
+		file []byte
+	}{
+		{
+			name: "stco after mdat",
+			file: slices.Concat(ftypBox, mdat, movie(typeSTCO, offset)),
+		},
+		{
+			name: "co64 before mdat",
+			file: slices.Concat(ftypBox, movie(typeCO64, offset+uint64(len(movie(typeCO64, 0)))), mdat),
+		},
+		{
+			name: "iloc",
+			file: slices.Concat(ftypBox, itemMeta(uint32(offset+uint64(len(itemMeta(0))))), mdat),
+		},
+		{
+			name: "large mdat",
+			file: slices.Concat(ftypBox, largeBox("mdat", media), movie(typeSTCO, offset+largeSizeSize)),
+		},
+	}
+
+	for _, tt := range tests {
+		for _, stream := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s stream %t", tt.name, stream), func(t *testing.T) {
+				testOffsets(t, tt.file, stream)
+			})
+		}
+	}
+}
+
+func testOffsets(t *testing.T, file []byte, stream bool) {
+	m, err := NewIsobmffMetaManager(reader(file, stream))
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if err := m.Upsert(codec.TinyMetaVendor, map[string]string{"artist": "a"}); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	data, _ := io.ReadAll(m.FileReader())
+	checkOffsets(t, data)
+
+	m, _ = NewIsobmffMetaManager(reader(data, stream))
+	if err := m.Upsert(codec.TinyMetaVendor, map[string]string{"title": "a longer title"}); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	data, _ = io.ReadAll(m.FileReader())
+	checkOffsets(t, data)
+
+	m, _ = NewIsobmffMetaManager(reader(data, stream))
+	got, err := m.Fields(codec.TinyMetaVendor)
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if want := map[string]string{"artist": "a", "title": "a longer title"}; !maps.Equal(got, want) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+
+	if err := m.StripAll(); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	data, _ = io.ReadAll(m.FileReader())
+	if !bytes.Equal(data, file) {
+		t.Errorf("want: %v, got: %v", file, data)
+	}
+}
+
+// reader returns a reader of data, one that can't be seeked for a stream.
+func reader(data []byte, stream bool) io.Reader {
+	if stream {
+		return io.MultiReader(bytes.NewReader(data))
+	}
+	return bytes.NewReader(data)
+}
+
+// checkOffsets fails unless every offset of the file points to the media.
+func checkOffsets(t *testing.T, data []byte) {
+	t.Helper()
+
+	m, _ := NewIsobmffMetaManager(bytes.NewReader(data))
+	m.readBoxes()
+	chunks, items, err := m.offsetFields()
+	fields := slices.Concat(chunks, items)
+	if err != nil || len(fields) != 1 {
+		t.Fatalf("want a single offset, got: %v, error: %v", fields, err)
+	}
+	offset := fields[0].get()
+	if offset+uint64(len(media)) > uint64(len(data)) || !bytes.Equal(data[offset:offset+uint64(len(media))], media) {
+		t.Errorf("offset %d doesn't point to the media: %v", offset, data)
+	}
+}
+
+func Test_IsobmffMetaManager_DeleteStrip(t *testing.T) {
+	file := slices.Concat(ftypBox, box("mdat", media))
+	m, _ := NewIsobmffMetaManager(bytes.NewReader(file))
+	m.Upsert(codec.TinyMetaVendor, map[string]string{"artist": "a", "title": "t"})
+	m.Upsert(codec.XMPVendor, map[string]string{"dc:title": "t"})
+
+	if err := m.Delete(codec.TinyMetaVendor, "artist"); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	got, _ := m.Fields(codec.TinyMetaVendor)
+	if want := map[string]string{"title": "t"}; !maps.Equal(got, want) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+
+	vendors, err := m.Vendors()
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if want := []codec.MetaCodecVendor{codec.TinyMetaVendor, codec.XMPVendor}; !slices.Equal(vendors, want) {
+		t.Errorf("want: %v, got: %v", want, vendors)
+	}
+
+	if err := m.Delete(codec.TinyMetaVendor, "title"); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if _, err := m.Fields(codec.TinyMetaVendor); err != ErrBoxNotFound {
+		t.Errorf("want error: %v, got: %v", ErrBoxNotFound, err)
+	}
+	if err := m.Strip(codec.XMPVendor); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	data, _ := io.ReadAll(m.FileReader())
+	if !bytes.Equal(data, file) {
+		t.Errorf("want: %v, got: %v", file, data)
+	}
+}
+
+func Test_IsobmffMetaManager_Corrupted(t *testing.T) {
+	file := slices.Concat(ftypBox, box("mdat", media))
+	m, _ := NewIsobmffMetaManager(bytes.NewReader(file[:len(file)-1]))
+	if _, err := m.Fields(codec.TinyMetaVendor); err != ErrCorruptedBox {
+		t.Errorf("want error: %v, got: %v", ErrCorruptedBox, err)
+	}
+}
+
+func Test_IsobmffMetaManager_MediaDataStreamed(t *testing.T) {
+	mdat := box("mdat", media)
+	file := slices.Concat(ftypBox, mdat, movie(typeSTCO, uint64(len(ftypBox)+headerSize)))
+	m, _ := NewIsobmffMetaManager(bytes.NewReader(file))
+	if err := m.Upsert(codec.TinyMetaVendor, map[string]string{"artist": "a"}); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if b := m.boxes[1]; boxType(b.data) != typeMDAT || len(b.data) != headerSize || b.body == nil {
+		t.Errorf("want the media data left in the file, got: %v", b.data)
+	}
+
+	// after the movie box, nothing moves
+	data, _ := io.ReadAll(m.FileReader())
+	uuid := m.boxes[len(m.boxes)-1].data
+	if want := slices.Concat(file, uuid); boxType(uuid) != typeUUID || !bytes.Equal(data, want) {
+		t.Errorf("want: %v, got: %v", want, data)
+	}
+}
+
+func Test_IsobmffMetaManager_Fragmented(t *testing.T) {
+	moof := box("moof", box("mfhd", make([]byte, fullBoxSize+4)))
+	mfra := box("mfra", box("mfro", make([]byte, fullBoxSize+4)))
+	file := slices.Concat(ftypBox, box("moov"), moof, box("mdat", media), mfra)
+
+	m, _ := NewIsobmffMetaManager(bytes.NewReader(file))
+	if err := m.Upsert(codec.TinyMetaVendor, map[string]string{"artist": "a"}); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	data, _ := io.ReadAll(m.FileReader())
+	prefix := file[:len(file)-len(mfra)]
+	if !bytes.HasPrefix(data, prefix) || !bytes.HasSuffix(data, mfra) {
+		t.Errorf("want the box between the fragments and mfra, got: %v", data)
+	}
+
+	uuid := data[len(prefix) : len(data)-len(mfra)]
+	file = slices.Concat(ftypBox, box("moov"), uuid, moof, box("mdat", media))
+	m, _ = NewIsobmffMetaManager(bytes.NewReader(file))
+	if err := m.StripAll(); err != ErrFragmented {
+		t.Errorf("want error: %v, got: %v", ErrFragmented, err)
+	}
+
+	// the box before the fragments is freed, the new one appended
+	m, _ = NewIsobmffMetaManager(bytes.NewReader(file))
+	if err := m.Upsert(codec.TinyMetaVendor, map[string]string{"title": "t"}); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	data, _ = io.ReadAll(m.FileReader())
+	free := slices.Concat(uuid[:4], []byte(typeFREE), make([]byte, len(uuid)-headerSize))
+	prefix = slices.Concat(ftypBox, box("moov"), free, moof, box("mdat", media))
+	if !bytes.HasPrefix(data, prefix) {
+		t.Errorf("want the fragments unmoved, got: %v", data)
+	}
+
+	m, _ = NewIsobmffMetaManager(bytes.NewReader(data))
+	got, err := m.Fields(codec.TinyMetaVendor)
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if want := map[string]string{"artist": "a", "title": "t"}; !maps.Equal(got, want) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+}
+
+func Test_IsobmffMetaManager_WidenChunkOffsets(t *testing.T) {
+	offset := uint64(math.MaxUint32 - 4)
+	file := slices.Concat(ftypBox, movie(typeSTCO, offset), box("mdat", media))
+	m, _ := NewIsobmffMetaManager(bytes.NewReader(file))
+	if err := m.Upsert(codec.TinyMetaVendor, map[string]string{"artist": "a"}); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+
+	data, _ := io.ReadAll(m.FileReader())
+	m, _ = NewIsobmffMetaManager(bytes.NewReader(data))
+	m.readBoxes()
+	chunks, _, err := m.offsetFields()
+	if err != nil || len(chunks) != 1 || len(chunks[0]) != 8 {
+		t.Fatalf("want a single 64 bits offset, got: %v, error: %v", chunks, err)
+	}
+	if want := offset + uint64(len(data)-len(file)); chunks[0].get() != want {
+		t.Errorf("want offset: %d, got: %d", want, chunks[0].get())
+	}
+	if !bytes.HasSuffix(data, box("mdat", media)) {
+		t.Errorf("want the media data last, got: %v", data)
+	}
+}
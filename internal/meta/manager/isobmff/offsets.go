@@ -0,0 +1,318 @@
+package isobmff
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/zzvanq/tinymedia/pkg/meta"
+)
+
+// fullBoxSize is the size of the version and flags of a full box
+const fullBoxSize = 4
+
+// offsetField is an absolute file offset of 4 or 8 bytes in a box.
+type offsetField []byte
+
+func (f offsetField) get() uint64 {
+	if len(f) == 4 {
+		return uint64(binary.BigEndian.Uint32(f))
+	}
+	return binary.BigEndian.Uint64(f)
+}
+
+func (f offsetField) set(v uint64) {
+	if len(f) == 4 {
+		binary.BigEndian.PutUint32(f, uint32(v))
+		return
+	}
+	binary.BigEndian.PutUint64(f, v)
+}
+
+func (f offsetField) max() uint64 {
+	if len(f) == 4 {
+		return math.MaxUint32
+	}
+	return math.MaxUint64
+}
+
+// chunkTablePath is the path of the chunk offset tables of the tracks.
+var chunkTablePath = []string{typeMOOV, "trak", "mdia", "minf", "stbl"}
+
+// errNarrowOffset tells a 32 bits chunk offset overflows.
+var errNarrowOffset = fmt.Errorf("overflowing chunk offsets %w", meta.ErrNotSupported)
+
+// shift moves the offsets pointing in the boxes from i on by delta, as
+// they move when a box is inserted, resized or removed before them. The
+// chunk offsets are widened to 64 bits when one overflows. The absolute
+// offsets of movie fragments aren't handled, so fragments are never moved.
+func (m *IsobmffMetaManager) shift(i int, delta int64) error {
+	if delta == 0 {
+		return nil
+	}
+	if slices.ContainsFunc(m.boxes[i:], func(b fileBox) bool {
+		return boxType(b.data) == typeMOOF || boxType(b.data) == typeSIDX
+	}) {
+		return ErrFragmented
+	}
+
+	err := m.move(m.offset(i), delta)
+	if err != errNarrowOffset {
+		return err
+	}
+	if err := m.widenChunkOffsets(); err != nil {
+		return err
+	}
+	// the movie box may precede the box
+	return m.move(m.offset(i), delta)
+}
+
+// move moves the offsets from pos on by delta, nothing is changed when an
+// offset overflows.
+func (m *IsobmffMetaManager) move(pos uint64, delta int64) error {
+	chunks, items, err := m.offsetFields()
+	if err != nil {
+		return err
+	}
+
+	var moved []offsetField
+	narrow := false
+	for j, f := range slices.Concat(items, chunks) {
+		v := f.get()
+		if v < pos {
+			continue
+		}
+		if delta > 0 && f.max()-v < uint64(delta) {
+			// only the chunk offsets have a wider table
+			if j < len(items) || len(f) == 8 {
+				return ErrOffsetOverflow
+			}
+			narrow = true
+		}
+		moved = append(moved, f)
+	}
+	if narrow {
+		return errNarrowOffset
+	}
+
+	for _, f := range moved {
+		f.set(uint64(int64(f.get()) + delta))
+	}
+	return nil
+}
+
+// widenChunkOffsets turns the stco boxes of the movie box into co64 ones,
+// moving the offsets past it as it grows.
+func (m *IsobmffMetaManager) widenChunkOffsets() error {
+	i := slices.IndexFunc(m.boxes, func(b fileBox) bool {
+		return boxType(b.data) == typeMOOV
+	})
+	if i < 0 {
+		return ErrOffsetOverflow
+	}
+
+	old := m.boxes[i].data
+	box, err := widen(old, chunkTablePath)
+	if err != nil {
+		return err
+	}
+	pos := m.offset(i + 1)
+	m.boxes[i].data = box
+	if err := m.move(pos, int64(len(box))-int64(len(old))); err != nil {
+		m.boxes[i].data = old
+		if err == errNarrowOffset {
+			return ErrOffsetOverflow
+		}
+		return err
+	}
+	return nil
+}
+
+// widen returns the box at the path with its stco children turned into
+// co64 ones, the box itself when there is none.
+func widen(box []byte, path []string) ([]byte, error) {
+	if len(path) == 0 {
+		if boxType(box) != typeSTCO {
+			return box, nil
+		}
+		body := boxBody(box)
+		fields, err := chunkOffsets(body, 4)
+		if err != nil {
+			return nil, err
+		}
+		wide := slices.Clone(body[:fullBoxSize+4])
+		for _, f := range fields {
+			wide = binary.BigEndian.AppendUint64(wide, f.get())
+		}
+		return createBox(typeCO64, wide), nil
+	}
+	if boxType(box) != path[0] {
+		return box, nil
+	}
+
+	kids, err := children(boxBody(box))
+	if err != nil {
+		return nil, err
+	}
+	changed := false
+	for i, kid := range kids {
+		if kids[i], err = widen(kid, path[1:]); err != nil {
+			return nil, err
+		}
+		changed = changed || len(kids[i]) != len(kid)
+	}
+	if !changed {
+		return box, nil
+	}
+	return createBox(path[0], kids...), nil
+}
+
+// offsetFields returns the chunk offsets of the tracks and the item
+// offsets of the file-level meta box.
+func (m *IsobmffMetaManager) offsetFields() (chunks, items []offsetField, err error) {
+	boxes := make([][]byte, len(m.boxes))
+	for i, b := range m.boxes {
+		boxes[i] = b.data
+	}
+
+	for _, table := range []struct {
+		typ  string
+		size int
+	}{{typeSTCO, 4}, {typeCO64, 8}} {
+		found, err := findBoxes(boxes, append(slices.Clone(chunkTablePath), table.typ)...)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, box := range found {
+			f, err := chunkOffsets(boxBody(box), table.size)
+			if err != nil {
+				return nil, nil, err
+			}
+			chunks = append(chunks, f...)
+		}
+	}
+
+	found, err := findBoxes(boxes, typeMETA, typeILOC)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, box := range found {
+		f, err := itemOffsets(boxBody(box))
+		if err != nil {
+			return nil, nil, err
+		}
+		items = append(items, f...)
+	}
+	return chunks, items, nil
+}
+
+// chunkOffsets parses the body of a stco or co64 box.
+func chunkOffsets(body []byte, size int) ([]offsetField, error) {
+	if len(body) < fullBoxSize+4 {
+		return nil, ErrCorruptedBox
+	}
+	count := uint64(binary.BigEndian.Uint32(body[fullBoxSize:]))
+	entries := body[fullBoxSize+4:]
+	if count*uint64(size) > uint64(len(entries)) {
+		return nil, ErrCorruptedBox
+	}
+
+	fields := make([]offsetField, count)
+	for i := range fields {
+		fields[i] = offsetField(entries[i*size : (i+1)*size])
+	}
+	return fields, nil
+}
+
+// itemOffsets parses the body of an iloc box, returning the offsets of
+// the items stored in the file: the base offset when set, the extents
+// offsets otherwise.
+func itemOffsets(body []byte) ([]offsetField, error) {
+	r := &fieldReader{b: body}
+	version := r.next(1)
+	r.next(3)
+	sizes := r.next(2)
+	if r.err {
+		return nil, ErrCorruptedBox
+	}
+	v := version[0]
+	offsetSize, lengthSize := int(sizes[0]>>4), int(sizes[0]&0x0F)
+	baseSize, indexSize := int(sizes[1]>>4), int(sizes[1]&0x0F)
+	if v == 0 {
+		indexSize = 0
+	}
+	for _, size := range []int{offsetSize, lengthSize, baseSize, indexSize} {
+		if size != 0 && size != 4 && size != 8 {
+			return nil, ErrCorruptedBox
+		}
+	}
+
+	idSize := 2
+	if v == 2 {
+		idSize = 4
+	}
+	count := r.number(idSize)
+
+	var fields []offsetField
+	for range count {
+		r.next(idSize)
+		method := 0
+		if v == 1 || v == 2 {
+			method = int(r.number(2) & 0x0F)
+		}
+		reference := r.number(2)
+		base := r.next(baseSize)
+		extents := r.number(2)
+		if r.err {
+			return nil, ErrCorruptedBox
+		}
+
+		// only the offsets in this file, not in idat or other files
+		file := method == 0 && reference == 0
+		if file && baseSize > 0 && offsetField(base).get() > 0 {
+			fields = append(fields, offsetField(base))
+			file = false
+		}
+		for range extents {
+			r.next(indexSize)
+			offset := r.next(offsetSize)
+			r.next(lengthSize)
+			if file && offsetSize > 0 {
+				fields = append(fields, offsetField(offset))
+			}
+		}
+		if r.err {
+			return nil, ErrCorruptedBox
+		}
+	}
+	return fields, nil
+}
+
+// fieldReader reads the variable sized fields of a box, err is set once
+// the body is too short.
+type fieldReader struct {
+	b   []byte
+	err bool
+}
+
+func (r *fieldReader) next(size int) []byte {
+	if r.err || size > len(r.b) {
+		r.err = true
+		return nil
+	}
+	f := r.b[:size]
+	r.b = r.b[size:]
+	return f
+}
+
+func (r *fieldReader) number(size int) uint64 {
+	f := r.next(size)
+	switch len(f) {
+	case 2:
+		return uint64(binary.BigEndian.Uint16(f))
+	case 4, 8:
+		return offsetField(f).get()
+	}
+	return 0
+}
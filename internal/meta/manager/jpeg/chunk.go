@@ -0,0 +1,108 @@
+package jpeg
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// A payload too large for one segment is spread over consecutive segments,
+// each one starting with the vendor magic and a chunk header: a zero byte,
+// then the chunk index and the chunks count as big-endian uint16.
+// Payloads fitting into a single segment are written without the header,
+// the zero byte tells them apart since the tinymeta codecs never start with it.
+const (
+	chunkHeaderSize = 5
+	chunksMaxCount  = 1<<16 - 1
+)
+
+func (m *JpegMetaManager) readChunks(c CodecVendor, i int, data []byte) ([]byte, []int, error) {
+	index, count, ok := chunkHeader(data)
+	if !ok {
+		return data, []int{i}, nil
+	}
+	if index != 0 {
+		return nil, nil, ErrCorruptedSegment
+	}
+
+	var payload bytes.Buffer
+	payload.Write(data[chunkHeaderSize:])
+	indices := []int{i}
+	for k := 1; k < count; k++ {
+		s, err := m.segmentAt(i + k)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if binary.BigEndian.Uint16(s[:headerSize]) != c.Marker || !bytes.HasPrefix(s[2*headerSize:], c.VendorMagic) {
+			return nil, nil, ErrCorruptedSegment
+		}
+		chunk := s[2*headerSize+len(c.VendorMagic):]
+		chunkIndex, chunkCount, ok := chunkHeader(chunk)
+		if !ok || chunkIndex != k || chunkCount != count {
+			return nil, nil, ErrCorruptedSegment
+		}
+
+		payload.Write(chunk[chunkHeaderSize:])
+		indices = append(indices, i+k)
+	}
+	return payload.Bytes(), indices, nil
+}
+
+// segmentAt returns the i-th segment, parsing the file up to it if needed.
+func (m *JpegMetaManager) segmentAt(i int) ([]byte, error) {
+	for len(m.segments) <= i {
+		if m.scanned() {
+			return nil, ErrCorruptedSegment
+		}
+		s, err := m.nextSegment()
+		if err != nil {
+			return nil, err
+		}
+		m.segments = append(m.segments, s)
+	}
+	return m.segments[i], nil
+}
+
+func createChunks(c CodecVendor, data []byte) ([][]byte, error) {
+	if headerSize+len(c.VendorMagic)+len(data) <= dataMaxSize {
+		s, err := createSegment(c.Marker, c.VendorMagic, data)
+		if err != nil {
+			return nil, err
+		}
+		return [][]byte{s}, nil
+	}
+
+	chunkMaxSize := dataMaxSize - headerSize - len(c.VendorMagic) - chunkHeaderSize
+	count := (len(data) + chunkMaxSize - 1) / chunkMaxSize
+	if count > chunksMaxCount {
+		return nil, ErrDataSizeTooLarge
+	}
+
+	segments := make([][]byte, 0, count)
+	for index := range count {
+		chunk := data[index*chunkMaxSize : min((index+1)*chunkMaxSize, len(data))]
+
+		header := make([]byte, chunkHeaderSize)
+		binary.BigEndian.PutUint16(header[1:3], uint16(index))
+		binary.BigEndian.PutUint16(header[3:5], uint16(count))
+
+		s, err := createSegment(c.Marker, append(bytes.Clone(c.VendorMagic), header...), chunk)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, s)
+	}
+	return segments, nil
+}
+
+func chunkHeader(data []byte) (int, int, bool) {
+	if len(data) < chunkHeaderSize || data[0] != 0 {
+		return 0, 0, false
+	}
+	index := int(binary.BigEndian.Uint16(data[1:3]))
+	count := int(binary.BigEndian.Uint16(data[3:5]))
+	if count == 0 || index >= count {
+		return 0, 0, false
+	}
+	return index, count, true
+}
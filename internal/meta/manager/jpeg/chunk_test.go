@@ -0,0 +1,79 @@
+package jpeg
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/zzvanq/tinymedia/pkg/meta/codec"
+)
+
+func Test_JpegMetaManager_Chunks(t *testing.T) {
+	sosSegment := []byte{0xFF, 0xDA, 0x00, 0x02}
+	jpeg := append([]byte{0xFF, 0xD8}, sosSegment...)
+	transcript := strings.Repeat("t", 3*dataMaxSize)
+
+	m, _ := NewJpegMetaManager(bytes.NewReader(jpeg))
+	if err := m.Insert(codec.TinyMetaVendor, map[string]string{"transcript": transcript}); err != nil {
+		t.Fatalf("Insert error = %v", err)
+	}
+	if len(m.segments) != 4 {
+		t.Fatalf("want segments: %d, got: %d", 4, len(m.segments))
+	}
+
+	data, _ := io.ReadAll(m.FileReader())
+	m, _ = NewJpegMetaManager(bytes.NewReader(data))
+	if err := m.Upsert(codec.TinyMetaVendor, map[string]string{"title": "t"}); err != nil {
+		t.Fatalf("Upsert error = %v", err)
+	}
+	if len(m.segments) != 4 {
+		t.Fatalf("want segments: %d, got: %d", 4, len(m.segments))
+	}
+
+	data, _ = io.ReadAll(m.FileReader())
+	m, _ = NewJpegMetaManager(bytes.NewReader(data))
+	got, err := m.Extract(codec.TinyMetaVendor, "transcript", "title")
+	if err != nil {
+		t.Fatalf("Extract error = %v", err)
+	}
+	if got["transcript"] != transcript || got["title"] != "t" {
+		t.Errorf("wrong fields: title=%q transcript length=%d", got["title"], len(got["transcript"]))
+	}
+
+	// shrinking back to one segment drops the chunk header
+	if err := m.Upsert(codec.TinyMetaVendor, map[string]string{"transcript": ""}); err != nil {
+		t.Fatalf("Upsert error = %v", err)
+	}
+	c := JpegVendorsCodec[codec.TinyMetaVendor]
+	want, _ := createSegment(c.Marker, c.VendorMagic, []byte(`{"title":"t","transcript":""}`))
+	if len(m.segments) != 1 || !bytes.Equal(m.segments[0], want) {
+		t.Errorf("want: %q, got: %q", want, m.segments[0])
+	}
+}
+
+func Test_JpegMetaManager_readChunks_Errors(t *testing.T) {
+	c := JpegVendorsCodec[codec.TinyMetaVendor]
+	sosSegment := []byte{0xFF, 0xDA, 0x00, 0x02}
+	chunks, _ := createChunks(c, bytes.Repeat([]byte("a"), 2*dataMaxSize))
+	other, _ := createSegment(0xFFE2, []byte("other\x00"), nil)
+
+	tests := []struct {
+		name     string
+		segments [][]byte
+	}{
+		{name: "missing chunk", segments: [][]byte{chunks[0], chunks[2], sosSegment}},
+		{name: "not consecutive", segments: [][]byte{chunks[0], other, chunks[1], chunks[2], sosSegment}},
+		{name: "starts at the second chunk", segments: [][]byte{chunks[1], chunks[2], sosSegment}},
+		{name: "truncated file", segments: [][]byte{chunks[0], chunks[1]}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &JpegMetaManager{r: bytes.NewReader(bytes.Join(tt.segments, nil))}
+			if _, err := m.Extract(codec.TinyMetaVendor, "a"); err != ErrCorruptedSegment {
+				t.Errorf("want error: %v, got: %v", ErrCorruptedSegment, err)
+			}
+		})
+	}
+}
@@ -6,46 +6,74 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"maps"
+	"slices"
 
 	"github.com/zzvanq/tinymedia/internal/file/magic"
+	"github.com/zzvanq/tinymedia/pkg/meta"
 	"github.com/zzvanq/tinymedia/pkg/meta/codec"
+	"github.com/zzvanq/tinymedia/pkg/meta/codec/exif"
 	"github.com/zzvanq/tinymedia/pkg/meta/codec/tinymeta"
+	"github.com/zzvanq/tinymedia/pkg/meta/codec/xmp"
 )
 
 const (
 	sosMarker   = 0xFFDA
+	comMarker   = 0xFFFE
+	app0Marker  = 0xFFE0
+	app15Marker = 0xFFEF
 	headerSize  = 2
 	dataMaxSize = 1<<16 - 1
 )
 
+var renderingSegments = []struct {
+	marker uint16
+	magic  []byte
+}{
+	{0xFFE0, []byte("JFIF\x00")},
+	{0xFFE0, []byte("JFXX\x00")},
+	{0xFFE2, []byte("ICC_PROFILE\x00")},
+	{0xFFEE, []byte("Adobe")},
+}
+
 var (
-	ErrVendorNotSupported = errors.New("vendor not supported")
-	ErrMarkerNotFound     = errors.New("marker not found")
+	ErrVendorNotSupported = meta.ErrVendorNotSupported
+	ErrMarkerNotFound     = fmt.Errorf("marker %w", meta.ErrNotFound)
 	ErrDataSizeTooLarge   = errors.New("data size too large")
-	ErrCorruptedSegment   = errors.New("corrupted segment")
+	ErrCorruptedSegment   = fmt.Errorf("%w segment", meta.ErrCorrupted)
+	ErrNoRoomInPlace      = errors.New("not enough padding to write in place")
 )
 
-type Codec interface {
-	Encode(map[string]string) ([]byte, error)
-	Decode([]byte) (map[string]string, error)
-}
+type layout int
+
+const (
+	// the payload is stored in a single segment
+	layoutSingle layout = iota
+	// the payload overflowing a segment is split into sequenced chunks
+	layoutChunked
+	// the payload overflowing a segment is stored as an ExtendedXMP
+	layoutExtendedXMP
+)
 
 type CodecVendor struct {
-	Codec       Codec
+	Codec       codec.Codec
 	Marker      uint16
 	VendorMagic []byte
+	Layout      layout
 }
 
 var JpegVendorsCodec = map[codec.MetaCodecVendor]CodecVendor{
-	codec.TinyMetaVendor:     {tinymeta.TinyMeta, 0xFFE0, append([]byte(codec.TinyMetaVendor), 0)},
-	codec.TinyMetaGzipVendor: {tinymeta.TinyMetaGzip, 0xFFE1, append([]byte(codec.TinyMetaGzipVendor), 0)},
+	codec.TinyMetaVendor:     {tinymeta.TinyMeta, 0xFFE0, append([]byte(codec.TinyMetaVendor), 0), layoutChunked},
+	codec.TinyMetaGzipVendor: {tinymeta.TinyMetaGzip, 0xFFE1, append([]byte(codec.TinyMetaGzipVendor), 0), layoutChunked},
+	codec.ExifVendor:         {exif.Exif, 0xFFE1, []byte("Exif\x00\x00"), layoutSingle},
+	codec.XMPVendor:          {xmp.XMP, 0xFFE1, []byte("http://ns.adobe.com/xap/1.0/\x00"), layoutExtendedXMP},
 }
 
 type JpegMetaManager struct {
 	prefix   []byte
 	r        io.Reader
 	segments [][]byte
+	// read is the size of the segments parsed from r
+	read int
 }
 
 // no filler bytes before the marker
@@ -76,84 +104,150 @@ func (m *JpegMetaManager) Insert(vendor codec.MetaCodecVendor, fields map[string
 	if err != nil {
 		return err
 	}
+	return m.writePayload(c, nil, encoded)
+}
 
-	s, err := createSegment(c.Marker, c.VendorMagic, encoded)
-	if err != nil {
-		return err
+func (m *JpegMetaManager) Upsert(vendor codec.MetaCodecVendor, fields map[string]string) error {
+	c, ok := JpegVendorsCodec[vendor]
+	if !ok {
+		return ErrVendorNotSupported
 	}
-	m.segments = append([][]byte{s}, m.segments...)
-	return nil
+	return m.UpsertPayload(vendor, func(data []byte) ([]byte, error) {
+		return codec.Update(c.Codec, data, fields)
+	})
 }
 
-func (m *JpegMetaManager) Upsert(vendor codec.MetaCodecVendor, fields map[string]string) error {
+// UpsertPayload replaces the payload of the vendor with the one update
+// returns for it, given nil when there's none.
+func (m *JpegMetaManager) UpsertPayload(vendor codec.MetaCodecVendor, update func(data []byte) ([]byte, error)) error {
 	c, ok := JpegVendorsCodec[vendor]
 	if !ok {
 		return ErrVendorNotSupported
 	}
 
-	i, err := m.findSegment(c.Marker, c.VendorMagic)
-	if err != nil {
-		if err == ErrMarkerNotFound {
-			return m.Insert(vendor, fields)
-		}
+	data, indices, err := m.readPayload(c)
+	if err != nil && err != ErrMarkerNotFound {
 		return err
 	}
-	s := m.segments[i]
-	dataOffset := 2*headerSize + len(c.VendorMagic)
-	decoded := make(map[string]string)
-	if len(s[dataOffset:]) > 0 {
-		decoded, err = c.Codec.Decode(s[dataOffset:])
-		if err != nil {
-			return err
-		}
-	}
-
-	maps.Copy(decoded, fields)
 
-	encoded, err := c.Codec.Encode(decoded)
+	encoded, err := update(data)
 	if err != nil {
 		return err
 	}
+	return m.writePayload(c, indices, encoded)
+}
 
-	newDataSize := headerSize + len(c.VendorMagic) + len(encoded)
-	if newDataSize > dataMaxSize {
-		return ErrDataSizeTooLarge
+func (m *JpegMetaManager) Extract(vendor codec.MetaCodecVendor, fields ...string) (map[string]string, error) {
+	decoded, err := m.Fields(vendor)
+	if err != nil {
+		return nil, err
 	}
 
-	newSegment := append(s[:dataOffset], encoded...)
-	binary.BigEndian.PutUint16(newSegment[headerSize:2*headerSize], uint16(newDataSize))
-	m.segments[i] = newSegment
-	return nil
+	return codec.Extract(JpegVendorsCodec[vendor].Codec, decoded, fields...), nil
 }
 
-func (m *JpegMetaManager) Extract(vendor codec.MetaCodecVendor, fields ...string) (map[string]string, error) {
-	codecVendor, ok := JpegVendorsCodec[vendor]
+func (m *JpegMetaManager) Fields(vendor codec.MetaCodecVendor) (map[string]string, error) {
+	c, ok := JpegVendorsCodec[vendor]
 	if !ok {
 		return nil, ErrVendorNotSupported
 	}
 
-	i, err := m.findSegment(codecVendor.Marker, codecVendor.VendorMagic)
+	data, err := m.Payload(vendor)
 	if err != nil {
-		if err == ErrMarkerNotFound {
-			return nil, ErrMarkerNotFound
-		}
 		return nil, err
 	}
-	segment := m.segments[i]
-	dataOffset := 2*headerSize + len(codecVendor.VendorMagic)
-	decoded, err := codecVendor.Codec.Decode(segment[dataOffset:])
-	if err != nil {
+	return c.Codec.Decode(data)
+}
+
+// Payload returns the encoded payload of the vendor.
+func (m *JpegMetaManager) Payload(vendor codec.MetaCodecVendor) ([]byte, error) {
+	c, ok := JpegVendorsCodec[vendor]
+	if !ok {
+		return nil, ErrVendorNotSupported
+	}
+
+	data, _, err := m.readPayload(c)
+	return data, err
+}
+
+// Vendors lists the vendors of all the APPn segments in order of appearance,
+// the unknown ones are named after their identifier.
+func (m *JpegMetaManager) Vendors() ([]codec.MetaCodecVendor, error) {
+	if err := m.readSegments(); err != nil {
 		return nil, err
 	}
 
-	result := make(map[string]string, len(fields))
-	for _, field := range fields {
-		df, ok := decoded[field]
-		if ok {
-			result[field] = df
+	var vendors []codec.MetaCodecVendor
+	for _, s := range m.segments {
+		vendor, ok := segmentVendor(s)
+		if ok && !slices.Contains(vendors, vendor) {
+			vendors = append(vendors, vendor)
+		}
+	}
+	return vendors, nil
+}
+
+func (m *JpegMetaManager) Delete(vendor codec.MetaCodecVendor, fields ...string) error {
+	c, ok := JpegVendorsCodec[vendor]
+	if !ok {
+		return ErrVendorNotSupported
+	}
+
+	data, indices, err := m.readPayload(c)
+	if err != nil {
+		return err
+	}
+
+	updated, err := codec.Delete(c.Codec, data, fields...)
+	if err != nil {
+		return err
+	}
+	if updated == nil {
+		m.replaceSegments(indices, nil)
+		return nil
+	}
+	return m.writePayload(c, indices, updated)
+}
+
+func (m *JpegMetaManager) Strip(vendors ...codec.MetaCodecVendor) error {
+	for _, vendor := range vendors {
+		c, ok := JpegVendorsCodec[vendor]
+		if !ok {
+			return ErrVendorNotSupported
+		}
+
+		_, indices, err := m.readPayload(c)
+		if err != nil {
+			if err == ErrMarkerNotFound {
+				continue
+			}
+			return err
 		}
+		m.replaceSegments(indices, nil)
+	}
+	return nil
+}
+
+// StripAll removes every APPn and COM segment except the ones needed
+// to render the image.
+func (m *JpegMetaManager) StripAll() error {
+	if err := m.readSegments(); err != nil {
+		return err
 	}
-	return result, nil
+
+	m.segments = slices.DeleteFunc(m.segments, func(s []byte) bool {
+		marker := binary.BigEndian.Uint16(s[:headerSize])
+		if marker != comMarker && (marker < app0Marker || marker > app15Marker) {
+			return false
+		}
+		for _, r := range renderingSegments {
+			if marker == r.marker && bytes.HasPrefix(s[2*headerSize:], r.magic) {
+				return false
+			}
+		}
+		return true
+	})
+	return nil
 }
 
 func (m *JpegMetaManager) FileReader() io.Reader {
@@ -165,3 +259,55 @@ func (m *JpegMetaManager) FileReader() io.Reader {
 	readers = append(readers, m.r)
 	return io.MultiReader(readers...)
 }
+
+// readPayload returns the vendor data and the indices of the segments
+// holding it, in ascending order.
+func (m *JpegMetaManager) readPayload(c CodecVendor) ([]byte, []int, error) {
+	i, err := m.findSegment(c.Marker, c.VendorMagic)
+	if err != nil {
+		return nil, nil, err
+	}
+	data := m.segments[i][2*headerSize+len(c.VendorMagic):]
+
+	switch c.Layout {
+	case layoutChunked:
+		return m.readChunks(c, i, data)
+	case layoutExtendedXMP:
+		return m.readExtendedXMP(i, data)
+	}
+	return data, []int{i}, nil
+}
+
+// writePayload replaces the segments at indices with the ones holding data,
+// new segments go right after SOI.
+func (m *JpegMetaManager) writePayload(c CodecVendor, indices []int, data []byte) error {
+	var segments [][]byte
+	var err error
+	switch c.Layout {
+	case layoutChunked:
+		segments, err = createChunks(c, data)
+	case layoutExtendedXMP:
+		segments, err = createExtendedXMP(c, data)
+	default:
+		var s []byte
+		s, err = createSegment(c.Marker, c.VendorMagic, data)
+		segments = [][]byte{s}
+	}
+	if err != nil {
+		return err
+	}
+
+	m.replaceSegments(indices, segments)
+	return nil
+}
+
+func (m *JpegMetaManager) replaceSegments(indices []int, segments [][]byte) {
+	at := 0
+	if len(indices) > 0 {
+		at = indices[0]
+	}
+	for _, i := range slices.Backward(indices) {
+		m.segments = slices.Delete(m.segments, i, i+1)
+	}
+	m.segments = slices.Insert(m.segments, at, segments...)
+}
@@ -2,6 +2,9 @@ package jpeg
 
 import (
 	"bytes"
+	"io"
+	"maps"
+	"slices"
 	"strings"
 	"testing"
 
@@ -23,8 +26,8 @@ func Test_JpegMetaManager_Insert_Errors(t *testing.T) {
 		},
 		{
 			name:    "data size too large",
-			vendor:  codec.TinyMetaVendor,
-			fields:  map[string]string{"key": strings.Repeat("a", dataMaxSize)},
+			vendor:  codec.ExifVendor,
+			fields:  map[string]string{"Artist": strings.Repeat("a", dataMaxSize)},
 			wantErr: ErrDataSizeTooLarge,
 		},
 	}
@@ -60,3 +63,177 @@ func Test_JpegMetaManager_Insert(t *testing.T) {
 		t.Errorf("wrong segment at 0:\nsegment: %v\nm.segments[0]: %v\n", s, m.segments[0])
 	}
 }
+
+func Test_JpegMetaManager_Exif(t *testing.T) {
+	sosSegment := []byte{0xFF, 0xDA, 0x00, 0x02}
+	m, err := NewJpegMetaManager(bytes.NewReader(append([]byte{0xFF, 0xD8}, sosSegment...)))
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+
+	if err := m.Upsert(codec.ExifVendor, map[string]string{"Artist": "a", "Orientation": "6"}); err != nil {
+		t.Fatalf("Upsert error = %v", err)
+	}
+	if err := m.Upsert(codec.ExifVendor, map[string]string{"0x8298": "c"}); err != nil {
+		t.Fatalf("Upsert error = %v", err)
+	}
+
+	data, _ := io.ReadAll(m.FileReader())
+	if !bytes.HasPrefix(data[2*headerSize+2:], []byte("Exif\x00\x00MM")) {
+		t.Errorf("wrong exif segment: %v", data)
+	}
+
+	m, _ = NewJpegMetaManager(bytes.NewReader(data))
+	got, err := m.Extract(codec.ExifVendor, "Artist", "274", "Copyright")
+	if err != nil {
+		t.Fatalf("Extract error = %v", err)
+	}
+	want := map[string]string{"Artist": "a", "274": "6", "Copyright": "c"}
+	if !maps.Equal(got, want) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+}
+
+func Test_JpegMetaManager_XMP(t *testing.T) {
+	sosSegment := []byte{0xFF, 0xDA, 0x00, 0x02}
+	m, _ := NewJpegMetaManager(bytes.NewReader(append([]byte{0xFF, 0xD8}, sosSegment...)))
+	if err := m.Upsert(codec.XMPVendor, map[string]string{"dc:title": "t", "xmp:Rating": "5"}); err != nil {
+		t.Fatalf("Upsert error = %v", err)
+	}
+
+	data, _ := io.ReadAll(m.FileReader())
+	m, _ = NewJpegMetaManager(bytes.NewReader(data))
+	got, err := m.Extract(codec.XMPVendor, "dc:title", "xmp:Rating")
+	if err != nil {
+		t.Fatalf("Extract error = %v", err)
+	}
+	want := map[string]string{"dc:title": "t", "xmp:Rating": "5"}
+	if !maps.Equal(got, want) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+}
+
+func Test_JpegMetaManager_Delete(t *testing.T) {
+	sosSegment := []byte{0xFF, 0xDA, 0x00, 0x02}
+	m, _ := NewJpegMetaManager(bytes.NewReader(append([]byte{0xFF, 0xD8}, sosSegment...)))
+	if err := m.Upsert(codec.TinyMetaVendor, map[string]string{"artist": "a", "title": "t"}); err != nil {
+		t.Fatalf("Upsert error = %v", err)
+	}
+
+	data, _ := io.ReadAll(m.FileReader())
+	m, _ = NewJpegMetaManager(bytes.NewReader(data))
+	if err := m.Delete(codec.TinyMetaVendor, "artist"); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	got, _ := m.Extract(codec.TinyMetaVendor, "artist", "title")
+	if want := map[string]string{"title": "t"}; !maps.Equal(got, want) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+
+	if err := m.Delete(codec.TinyMetaVendor, "title"); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if err := m.Delete(codec.TinyMetaVendor, "title"); err != ErrMarkerNotFound {
+		t.Errorf("want error: %v, got: %v", ErrMarkerNotFound, err)
+	}
+
+	data, _ = io.ReadAll(m.FileReader())
+	want := append([]byte{0xFF, 0xD8}, sosSegment...)
+	if !bytes.Equal(data, want) {
+		t.Errorf("empty segment not dropped:\nwant: %v\ngot: %v", want, data)
+	}
+}
+
+func Test_JpegMetaManager_Strip(t *testing.T) {
+	jfif, _ := createSegment(0xFFE0, []byte("JFIF\x00"), []byte{1, 2})
+	icc, _ := createSegment(0xFFE2, []byte("ICC_PROFILE\x00"), []byte{1, 1, 3})
+	comment, _ := createSegment(comMarker, nil, []byte("comment"))
+	dqt, _ := createSegment(0xFFDB, nil, []byte{0})
+	sosSegment := []byte{0xFF, 0xDA, 0x00, 0x02}
+
+	var file []byte
+	file = append(file, 0xFF, 0xD8)
+	for _, s := range [][]byte{jfif, icc, comment, dqt, sosSegment} {
+		file = append(file, s...)
+	}
+
+	m, _ := NewJpegMetaManager(bytes.NewReader(file))
+	for vendor, field := range map[codec.MetaCodecVendor]string{
+		codec.TinyMetaVendor: "Artist",
+		codec.ExifVendor:     "Artist",
+		codec.XMPVendor:      "dc:title",
+	} {
+		if err := m.Upsert(vendor, map[string]string{field: "a"}); err != nil {
+			t.Fatalf("Upsert error = %v", err)
+		}
+	}
+
+	data, _ := io.ReadAll(m.FileReader())
+	m, _ = NewJpegMetaManager(bytes.NewReader(data))
+	if err := m.Strip(codec.ExifVendor, codec.XMPVendor); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if _, err := m.Extract(codec.ExifVendor, "Artist"); err != ErrMarkerNotFound {
+		t.Errorf("want error: %v, got: %v", ErrMarkerNotFound, err)
+	}
+	if got, _ := m.Extract(codec.TinyMetaVendor, "Artist"); got["Artist"] != "a" {
+		t.Errorf("tinymeta stripped: %v", got)
+	}
+	if err := m.Strip("unsupported"); err != ErrVendorNotSupported {
+		t.Errorf("want error: %v, got: %v", ErrVendorNotSupported, err)
+	}
+
+	if err := m.StripAll(); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	data, _ = io.ReadAll(m.FileReader())
+	var want []byte
+	want = append(want, 0xFF, 0xD8)
+	for _, s := range [][]byte{jfif, icc, dqt, sosSegment} {
+		want = append(want, s...)
+	}
+	if !bytes.Equal(data, want) {
+		t.Errorf("want: %v\ngot: %v", want, data)
+	}
+}
+
+func Test_JpegMetaManager_Vendors(t *testing.T) {
+	jfif, _ := createSegment(0xFFE0, []byte("JFIF\x00"), []byte{1, 2})
+	adobe, _ := createSegment(0xFFEE, []byte("Adobe"), []byte{0, 0x64})
+	raw, _ := createSegment(0xFFE5, nil, []byte{0xFE, 0x01})
+	sosSegment := []byte{0xFF, 0xDA, 0x00, 0x02}
+
+	var file []byte
+	file = append(file, 0xFF, 0xD8)
+	for _, s := range [][]byte{jfif, adobe, raw, sosSegment} {
+		file = append(file, s...)
+	}
+
+	m, _ := NewJpegMetaManager(bytes.NewReader(file))
+	if err := m.Upsert(codec.TinyMetaVendor, map[string]string{"artist": "a", "title": "t"}); err != nil {
+		t.Fatalf("Upsert error = %v", err)
+	}
+	if err := m.Upsert(codec.ExifVendor, map[string]string{"Artist": "a"}); err != nil {
+		t.Fatalf("Upsert error = %v", err)
+	}
+
+	got, err := m.Vendors()
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	want := []codec.MetaCodecVendor{codec.ExifVendor, codec.TinyMetaVendor, "JFIF", "Adobe", "app5"}
+	if !slices.Equal(got, want) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+
+	fields, err := m.Fields(codec.TinyMetaVendor)
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if want := map[string]string{"artist": "a", "title": "t"}; !maps.Equal(fields, want) {
+		t.Errorf("want: %v, got: %v", want, fields)
+	}
+	if _, err := m.Fields("JFIF"); err != ErrVendorNotSupported {
+		t.Errorf("want error: %v, got: %v", ErrVendorNotSupported, err)
+	}
+}
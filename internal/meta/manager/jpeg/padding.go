@@ -0,0 +1,90 @@
+package jpeg
+
+import (
+	"encoding/binary"
+	"io"
+	"slices"
+)
+
+// The padding is a COM segment of zeros reserved for the metadata to grow
+// into, so the file can be updated in place instead of being rewritten.
+var paddingMagic = []byte("tinymedia:padding\x00")
+
+var paddingMinSize = 2*headerSize + len(paddingMagic)
+
+// PaddingMaxSize is the size of the largest padding segment, the marker
+// included.
+const PaddingMaxSize = headerSize + dataMaxSize
+
+// Reserve sets the size of the padding segment, adding it after the
+// APPn and COM segments if there's none.
+func (m *JpegMetaManager) Reserve(size int) error {
+	if err := m.readSegments(); err != nil {
+		return err
+	}
+
+	s, err := paddingSegment(size)
+	if err != nil {
+		return err
+	}
+
+	if i, err := m.findParsed(comMarker, paddingMagic); err == nil {
+		m.segments[i] = s
+		return nil
+	}
+
+	at := slices.IndexFunc(m.segments, func(s []byte) bool {
+		marker := binary.BigEndian.Uint16(s[:headerSize])
+		return marker != comMarker && (marker < app0Marker || marker > app15Marker)
+	})
+	m.segments = slices.Insert(m.segments, at, s)
+	return nil
+}
+
+// WriteInPlace overwrites the segments of the original file with the
+// updated ones, resizing the padding so the image data doesn't move.
+// It fails with ErrNoRoomInPlace if the padding can't absorb the change,
+// the file has to be rewritten through FileReader then. The write isn't
+// atomic, a failure in the middle leaves the file corrupted.
+func (m *JpegMetaManager) WriteInPlace(w io.WriterAt) error {
+	if err := m.readSegments(); err != nil {
+		return err
+	}
+
+	size := len(m.prefix)
+	for _, s := range m.segments {
+		size += len(s)
+	}
+	original := len(m.prefix) + m.read
+
+	if size != original {
+		i, err := m.findParsed(comMarker, paddingMagic)
+		if err != nil {
+			return ErrNoRoomInPlace
+		}
+		padding := len(m.segments[i]) + original - size
+		if padding < paddingMinSize {
+			return ErrNoRoomInPlace
+		}
+		s, err := paddingSegment(padding)
+		if err != nil {
+			return ErrNoRoomInPlace
+		}
+		m.segments[i] = s
+	}
+
+	offset := int64(0)
+	for _, b := range append([][]byte{m.prefix}, m.segments...) {
+		if _, err := w.WriteAt(b, offset); err != nil {
+			return err
+		}
+		offset += int64(len(b))
+	}
+	return nil
+}
+
+// paddingSegment returns a padding segment of the size, the marker included.
+func paddingSegment(size int) ([]byte, error) {
+	size = max(size, paddingMinSize)
+	return createSegment(comMarker, paddingMagic, make([]byte, size-paddingMinSize))
+}
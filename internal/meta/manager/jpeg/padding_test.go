@@ -0,0 +1,74 @@
+package jpeg
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"maps"
+	"strings"
+	"testing"
+
+	"github.com/zzvanq/tinymedia/pkg/meta/codec"
+)
+
+type bufferAt []byte
+
+func (b bufferAt) WriteAt(p []byte, off int64) (int, error) {
+	if int(off)+len(p) > len(b) {
+		return 0, errors.New("write past the end")
+	}
+	return copy(b[off:], p), nil
+}
+
+func Test_JpegMetaManager_WriteInPlace(t *testing.T) {
+	sosSegment := []byte{0xFF, 0xDA, 0x00, 0x02, 0x01, 0x02}
+	m, _ := NewJpegMetaManager(bytes.NewReader(append([]byte{0xFF, 0xD8}, sosSegment...)))
+	if err := m.Upsert(codec.TinyMetaVendor, map[string]string{"k": "v"}); err != nil {
+		t.Fatalf("Upsert error = %v", err)
+	}
+	if err := m.Reserve(256); err != nil {
+		t.Fatalf("Reserve error = %v", err)
+	}
+	data, _ := io.ReadAll(m.FileReader())
+
+	m, _ = NewJpegMetaManager(bytes.NewReader(data))
+	if err := m.Upsert(codec.TinyMetaVendor, map[string]string{"k": strings.Repeat("v", 100)}); err != nil {
+		t.Fatalf("Upsert error = %v", err)
+	}
+	file := bytes.Clone(data)
+	if err := m.WriteInPlace(bufferAt(file)); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if !bytes.HasSuffix(file, sosSegment) {
+		t.Errorf("image data moved: %v", file)
+	}
+
+	m, _ = NewJpegMetaManager(bytes.NewReader(file))
+	got, err := m.Extract(codec.TinyMetaVendor, "k")
+	if err != nil {
+		t.Fatalf("Extract error = %v", err)
+	}
+	want := map[string]string{"k": strings.Repeat("v", 100)}
+	if !maps.Equal(got, want) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+
+	m, _ = NewJpegMetaManager(bytes.NewReader(file))
+	if err := m.Upsert(codec.TinyMetaVendor, map[string]string{"k": strings.Repeat("v", 300)}); err != nil {
+		t.Fatalf("Upsert error = %v", err)
+	}
+	if err := m.WriteInPlace(bufferAt(bytes.Clone(file))); err != ErrNoRoomInPlace {
+		t.Errorf("want error: %v, got: %v", ErrNoRoomInPlace, err)
+	}
+}
+
+func Test_JpegMetaManager_WriteInPlace_NoPadding(t *testing.T) {
+	sosSegment := []byte{0xFF, 0xDA, 0x00, 0x02}
+	m, _ := NewJpegMetaManager(bytes.NewReader(append([]byte{0xFF, 0xD8}, sosSegment...)))
+	if err := m.Upsert(codec.TinyMetaVendor, map[string]string{"k": "v"}); err != nil {
+		t.Fatalf("Upsert error = %v", err)
+	}
+	if err := m.WriteInPlace(bufferAt(make([]byte, 64))); err != ErrNoRoomInPlace {
+		t.Errorf("want error: %v, got: %v", ErrNoRoomInPlace, err)
+	}
+}
@@ -3,7 +3,10 @@ package jpeg
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"io"
+
+	"github.com/zzvanq/tinymedia/pkg/meta/codec"
 )
 
 func (m *JpegMetaManager) findSegment(marker uint16, vendorMagic []byte) (int, error) {
@@ -11,6 +14,9 @@ func (m *JpegMetaManager) findSegment(marker uint16, vendorMagic []byte) (int, e
 	if err == nil {
 		return i, nil
 	}
+	if m.scanned() {
+		return 0, ErrMarkerNotFound
+	}
 
 	var segMarker uint16
 	for segMarker != sosMarker {
@@ -33,6 +39,26 @@ func (m *JpegMetaManager) findSegment(marker uint16, vendorMagic []byte) (int, e
 	return 0, ErrMarkerNotFound
 }
 
+// readSegments parses the rest of the segments up to SOS.
+func (m *JpegMetaManager) readSegments() error {
+	for !m.scanned() {
+		segment, err := m.nextSegment()
+		if err != nil {
+			return err
+		}
+		m.segments = append(m.segments, segment)
+	}
+	return nil
+}
+
+func (m *JpegMetaManager) scanned() bool {
+	if len(m.segments) == 0 {
+		return false
+	}
+	last := m.segments[len(m.segments)-1]
+	return binary.BigEndian.Uint16(last[:headerSize]) == sosMarker
+}
+
 func (m *JpegMetaManager) nextSegment() ([]byte, error) {
 	headers := make([]byte, 2*headerSize)
 	if _, err := io.ReadFull(m.r, headers); err != nil {
@@ -51,6 +77,7 @@ func (m *JpegMetaManager) nextSegment() ([]byte, error) {
 		return nil, ErrCorruptedSegment
 	}
 
+	m.read += len(segment)
 	return segment, nil
 }
 
@@ -73,6 +100,50 @@ func (m *JpegMetaManager) findParsed(marker uint16, vendorMagic []byte) (int, er
 	return 0, ErrMarkerNotFound
 }
 
+func (m *JpegMetaManager) findAllParsed(marker uint16, vendorMagic []byte) []int {
+	var indices []int
+	for i, s := range m.segments {
+		if binary.BigEndian.Uint16(s[:headerSize]) != marker {
+			continue
+		}
+		if bytes.HasPrefix(s[2*headerSize:], vendorMagic) {
+			indices = append(indices, i)
+		}
+	}
+	return indices
+}
+
+func segmentVendor(s []byte) (codec.MetaCodecVendor, bool) {
+	marker := binary.BigEndian.Uint16(s[:headerSize])
+	if marker < app0Marker || marker > app15Marker {
+		return "", false
+	}
+
+	data := s[2*headerSize:]
+	for vendor, c := range JpegVendorsCodec {
+		if marker == c.Marker && bytes.HasPrefix(data, c.VendorMagic) {
+			return vendor, true
+		}
+	}
+	if marker == 0xFFE1 && bytes.HasPrefix(data, xmpExtensionMagic) {
+		return codec.XMPVendor, true
+	}
+
+	if end := bytes.IndexByte(data, 0); end > 0 && isIdentifier(data[:end]) {
+		return codec.MetaCodecVendor(data[:end]), true
+	}
+	return codec.MetaCodecVendor(fmt.Sprintf("app%d", marker-app0Marker)), true
+}
+
+func isIdentifier(b []byte) bool {
+	for _, c := range b {
+		if c < 0x20 || c > 0x7E {
+			return false
+		}
+	}
+	return true
+}
+
 func createSegment(marker uint16, vendor []byte, data []byte) ([]byte, error) {
 	dataSize := headerSize + len(vendor) + len(data)
 	if dataSize > dataMaxSize {
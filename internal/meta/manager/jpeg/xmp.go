@@ -0,0 +1,106 @@
+package jpeg
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/zzvanq/tinymedia/pkg/meta/codec/xmp"
+)
+
+const (
+	xmpGUIDSize = xmp.GUIDSize
+	// GUID, full length and offset of the chunk
+	xmpExtensionHeaderSize = xmpGUIDSize + 4 + 4
+)
+
+var xmpExtensionMagic = []byte("http://ns.adobe.com/xmp/extension/\x00")
+
+// readExtendedXMP reassembles the ExtendedXMP the standard packet refers
+// to and merges it back, so callers only deal with a single packet.
+func (m *JpegMetaManager) readExtendedXMP(i int, standard []byte) ([]byte, []int, error) {
+	guid, ok := xmp.ExtendedGUID(standard)
+	if !ok {
+		return standard, []int{i}, nil
+	}
+
+	if err := m.readSegments(); err != nil {
+		return nil, nil, err
+	}
+
+	indices := []int{i}
+	var extended []byte
+	var received int
+	for _, j := range m.findAllParsed(0xFFE1, xmpExtensionMagic) {
+		chunk := m.segments[j][2*headerSize+len(xmpExtensionMagic):]
+		if len(chunk) < xmpExtensionHeaderSize || string(chunk[:xmpGUIDSize]) != guid {
+			continue
+		}
+
+		fullLength := binary.BigEndian.Uint32(chunk[xmpGUIDSize:])
+		offset := binary.BigEndian.Uint32(chunk[xmpGUIDSize+4:])
+		data := chunk[xmpExtensionHeaderSize:]
+		if extended == nil {
+			extended = make([]byte, fullLength)
+		}
+		if int(fullLength) != len(extended) || uint64(offset)+uint64(len(data)) > uint64(fullLength) {
+			return nil, nil, ErrCorruptedSegment
+		}
+		copy(extended[offset:], data)
+		received += len(data)
+		indices = append(indices, j)
+	}
+
+	// the extension segments are gone, the standard packet is still valid
+	if extended == nil {
+		return standard, []int{i}, nil
+	}
+	if received != len(extended) {
+		return nil, nil, ErrCorruptedSegment
+	}
+
+	merged, err := xmp.Merge(standard, extended)
+	if err != nil {
+		return nil, nil, err
+	}
+	return merged, indices, nil
+}
+
+func createExtendedXMP(c CodecVendor, packet []byte) ([][]byte, error) {
+	standardMaxSize := dataMaxSize - headerSize - len(c.VendorMagic)
+	if len(packet) <= standardMaxSize {
+		s, err := createSegment(c.Marker, c.VendorMagic, packet)
+		if err != nil {
+			return nil, err
+		}
+		return [][]byte{s}, nil
+	}
+
+	standard, extended, guid, err := xmp.Split(packet, standardMaxSize)
+	if err != nil {
+		return nil, ErrDataSizeTooLarge
+	}
+
+	s, err := createSegment(c.Marker, c.VendorMagic, standard)
+	if err != nil {
+		return nil, err
+	}
+	segments := [][]byte{s}
+
+	chunkMaxSize := dataMaxSize - headerSize - len(xmpExtensionMagic) - xmpExtensionHeaderSize
+	for offset := 0; offset < len(extended); offset += chunkMaxSize {
+		chunk := extended[offset:min(offset+chunkMaxSize, len(extended))]
+
+		var header bytes.Buffer
+		header.Write(xmpExtensionMagic)
+		header.WriteString(guid)
+		binary.Write(&header, binary.BigEndian, uint32(len(extended)))
+		binary.Write(&header, binary.BigEndian, uint32(offset))
+
+		s, err := createSegment(c.Marker, header.Bytes(), chunk)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, s)
+	}
+	return segments, nil
+}
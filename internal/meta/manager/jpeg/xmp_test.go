@@ -0,0 +1,74 @@
+package jpeg
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/zzvanq/tinymedia/pkg/meta/codec"
+)
+
+func Test_JpegMetaManager_ExtendedXMP(t *testing.T) {
+	sosSegment := []byte{0xFF, 0xDA, 0x00, 0x02}
+	jpeg := append([]byte{0xFF, 0xD8}, sosSegment...)
+	caption := strings.Repeat("caption ", 20000)
+
+	m, _ := NewJpegMetaManager(bytes.NewReader(jpeg))
+	if err := m.Upsert(codec.XMPVendor, map[string]string{"dc:title": "t", "dc:description": caption}); err != nil {
+		t.Fatalf("Upsert error = %v", err)
+	}
+
+	// standard packet, three extension chunks and SOS
+	if len(m.segments) != 5 {
+		t.Fatalf("want segments: %d, got: %d", 5, len(m.segments))
+	}
+	for _, s := range m.segments[1:4] {
+		if !bytes.HasPrefix(s[2*headerSize:], xmpExtensionMagic) {
+			t.Errorf("not an extension segment: %q", s[:2*headerSize+len(xmpExtensionMagic)])
+		}
+	}
+
+	data, _ := io.ReadAll(m.FileReader())
+	m, _ = NewJpegMetaManager(bytes.NewReader(data))
+	if err := m.Upsert(codec.XMPVendor, map[string]string{"xmp:Rating": "1"}); err != nil {
+		t.Fatalf("Upsert error = %v", err)
+	}
+	if len(m.segments) != 5 {
+		t.Fatalf("want segments: %d, got: %d", 5, len(m.segments))
+	}
+
+	data, _ = io.ReadAll(m.FileReader())
+	m, _ = NewJpegMetaManager(bytes.NewReader(data))
+	got, err := m.Extract(codec.XMPVendor, "dc:title", "dc:description", "xmp:Rating")
+	if err != nil {
+		t.Fatalf("Extract error = %v", err)
+	}
+	if got["dc:title"] != "t" || got["dc:description"] != caption || got["xmp:Rating"] != "1" {
+		t.Errorf("wrong fields: title=%q rating=%q description length=%d", got["dc:title"], got["xmp:Rating"], len(got["dc:description"]))
+	}
+
+	// shrinking the packet drops the extension segments
+	m, _ = NewJpegMetaManager(bytes.NewReader(data))
+	if err := m.Upsert(codec.XMPVendor, map[string]string{"dc:description": "short"}); err != nil {
+		t.Fatalf("Upsert error = %v", err)
+	}
+	if len(m.segments) != 2 {
+		t.Errorf("want segments: %d, got: %d", 2, len(m.segments))
+	}
+}
+
+func Test_JpegMetaManager_ExtendedXMP_MissingChunk(t *testing.T) {
+	sosSegment := []byte{0xFF, 0xDA, 0x00, 0x02}
+	m, _ := NewJpegMetaManager(bytes.NewReader(append([]byte{0xFF, 0xD8}, sosSegment...)))
+	if err := m.Upsert(codec.XMPVendor, map[string]string{"dc:description": strings.Repeat("x", 1<<17)}); err != nil {
+		t.Fatalf("Upsert error = %v", err)
+	}
+	m.segments = append(m.segments[:1], m.segments[2:]...)
+
+	data, _ := io.ReadAll(m.FileReader())
+	m, _ = NewJpegMetaManager(bytes.NewReader(data))
+	if _, err := m.Extract(codec.XMPVendor, "dc:description"); err != ErrCorruptedSegment {
+		t.Errorf("want error: %v, got: %v", ErrCorruptedSegment, err)
+	}
+}
@@ -0,0 +1,354 @@
+package mp3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"slices"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	tagHeaderSize   = 10
+	frameHeaderSize = 10
+	idSize          = 4
+	// synchsafe integers keep the high bit of each byte clear
+	synchsafeMax = 1<<28 - 1
+)
+
+// tag header flags
+const (
+	flagUnsync         = 0x80
+	flagExtendedHeader = 0x40
+	flagFooter         = 0x10
+)
+
+// frame format flags, the second flags byte
+const (
+	v3FlagCompression = 0x80
+	v3FlagEncryption  = 0x40
+	v3FlagGrouping    = 0x20
+	v4FlagGrouping    = 0x40
+	v4FlagCompression = 0x08
+	v4FlagEncryption  = 0x04
+	v4FlagUnsync      = 0x02
+	v4FlagDataLength  = 0x01
+)
+
+// text encodings
+const (
+	encodingLatin1  = 0x00
+	encodingUTF16   = 0x01
+	encodingUTF16BE = 0x02
+	encodingUTF8    = 0x03
+)
+
+const (
+	idTXXX = "TXXX"
+	idPRIV = "PRIV"
+)
+
+type frame struct {
+	id    string
+	flags [2]byte
+	body  []byte
+}
+
+// readTag reads the tag and parses its frames, the audio is left in r.
+func (m *Mp3MetaManager) readTag() error {
+	if m.parsed {
+		return m.err
+	}
+	m.parsed = true
+	if m.header == nil {
+		return nil
+	}
+	m.err = m.parseTag()
+	return m.err
+}
+
+func (m *Mp3MetaManager) parseTag() error {
+	m.version = m.header[3]
+	if m.version != 3 && m.version != 4 {
+		return ErrVersionNotSupported
+	}
+	m.flags = m.header[5]
+
+	size, ok := synchsafe(m.header[6:])
+	if !ok {
+		return ErrCorruptedTag
+	}
+	if m.version == 4 && m.flags&flagFooter != 0 {
+		size += tagHeaderSize
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(m.r, body); err != nil {
+		return ErrCorruptedTag
+	}
+	m.raw = append(m.header, body...)
+	m.size = len(body)
+	if m.version == 4 && m.flags&flagFooter != 0 {
+		body = body[:len(body)-tagHeaderSize]
+	}
+
+	if m.version == 3 && m.flags&flagUnsync != 0 {
+		body = unsync(body)
+	}
+	if m.flags&flagExtendedHeader != 0 {
+		if len(body) < 4 {
+			return ErrCorruptedTag
+		}
+		// the v2.4 size includes itself, the v2.3 one doesn't
+		extSize := int(binary.BigEndian.Uint32(body)) + 4
+		if m.version == 4 {
+			s, ok := synchsafe(body)
+			if !ok {
+				return ErrCorruptedTag
+			}
+			extSize = s
+		}
+		if extSize > len(body) {
+			return ErrCorruptedTag
+		}
+		body = body[extSize:]
+	}
+
+	for len(body) >= frameHeaderSize && body[0] != 0 {
+		f, n, err := m.parseFrame(body)
+		if err != nil {
+			return err
+		}
+		m.frames = append(m.frames, f)
+		body = body[n:]
+	}
+	m.padding = len(body)
+	return nil
+}
+
+// parseFrame returns the frame at the start of data and its size.
+func (m *Mp3MetaManager) parseFrame(data []byte) (frame, int, error) {
+	id := string(data[:idSize])
+	for _, c := range id {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return frame{}, 0, ErrCorruptedTag
+		}
+	}
+
+	size := int(binary.BigEndian.Uint32(data[idSize:]))
+	if m.version == 4 {
+		var ok bool
+		if size, ok = synchsafe(data[idSize:]); !ok {
+			return frame{}, 0, ErrCorruptedTag
+		}
+	}
+	if size > len(data)-frameHeaderSize {
+		return frame{}, 0, ErrCorruptedTag
+	}
+
+	f := frame{id: id, body: data[frameHeaderSize : frameHeaderSize+size]}
+	copy(f.flags[:], data[8:frameHeaderSize])
+	// the tag unsynchronisation of v2.4 applies to every frame
+	if m.version == 4 && m.flags&flagUnsync != 0 {
+		f.flags[1] |= v4FlagUnsync
+	}
+	return f, frameHeaderSize + size, nil
+}
+
+// content returns the data of the frame without the format bytes, false
+// when it's compressed or encrypted.
+func (m *Mp3MetaManager) content(f frame) ([]byte, bool) {
+	data := f.body
+	if m.version == 3 {
+		if f.flags[1]&(v3FlagCompression|v3FlagEncryption) != 0 {
+			return nil, false
+		}
+		if f.flags[1]&v3FlagGrouping != 0 {
+			if len(data) < 1 {
+				return nil, false
+			}
+			data = data[1:]
+		}
+		return data, true
+	}
+
+	if f.flags[1]&(v4FlagCompression|v4FlagEncryption) != 0 {
+		return nil, false
+	}
+	if f.flags[1]&v4FlagGrouping != 0 {
+		if len(data) < 1 {
+			return nil, false
+		}
+		data = data[1:]
+	}
+	if f.flags[1]&v4FlagDataLength != 0 {
+		if len(data) < 4 {
+			return nil, false
+		}
+		data = data[4:]
+	}
+	if f.flags[1]&v4FlagUnsync != 0 {
+		data = unsync(data)
+	}
+	return data, true
+}
+
+// encodeFrame writes the frame with its header.
+func (m *Mp3MetaManager) encodeFrame(f frame) []byte {
+	data := []byte(f.id)
+	if m.version == 4 {
+		data = append(data, putSynchsafe(len(f.body))...)
+	} else {
+		data = binary.BigEndian.AppendUint32(data, uint32(len(f.body)))
+	}
+	data = append(data, f.flags[:]...)
+	return append(data, f.body...)
+}
+
+func synchsafe(b []byte) (int, bool) {
+	var v int
+	for _, c := range b[:4] {
+		if c&0x80 != 0 {
+			return 0, false
+		}
+		v = v<<7 | int(c)
+	}
+	return v, true
+}
+
+func putSynchsafe(v int) []byte {
+	return []byte{byte(v >> 21 & 0x7F), byte(v >> 14 & 0x7F), byte(v >> 7 & 0x7F), byte(v & 0x7F)}
+}
+
+// unsync reverts the unsynchronisation, which inserts a zero after every
+// 0xFF so the data has no false MPEG sync.
+func unsync(data []byte) []byte {
+	return bytes.ReplaceAll(data, []byte{0xFF, 0x00}, []byte{0xFF})
+}
+
+// textIDs are the standard text frames of ID3v2.3 and ID3v2.4, with the
+// iTunes sort order ones.
+var textIDs = []string{
+	"TALB", "TBPM", "TCOM", "TCON", "TCOP", "TDAT", "TDEN", "TDLY", "TDOR",
+	"TDRC", "TDRL", "TDTG", "TENC", "TEXT", "TFLT", "TIME", "TIPL", "TIT1",
+	"TIT2", "TIT3", "TKEY", "TLAN", "TLEN", "TMCL", "TMED", "TMOO", "TOAL",
+	"TOFN", "TOLY", "TOPE", "TORY", "TOWN", "TPE1", "TPE2", "TPE3", "TPE4",
+	"TPOS", "TPRO", "TPUB", "TRCK", "TRDA", "TRSN", "TRSO", "TSIZ", "TSO2",
+	"TSOA", "TSOC", "TSOP", "TSOT", "TSRC", "TSSE", "TSST", "TYER",
+}
+
+// isTextID reports whether the field names a standard text frame.
+func isTextID(field string) bool {
+	return slices.Contains(textIDs, field)
+}
+
+// txxxPrefix names the TXXX frames whose description would read as
+// a standard text frame, e.g. "TXXX:TIT2".
+const txxxPrefix = idTXXX + ":"
+
+// txxxField returns the field of a TXXX frame of the description.
+func txxxField(description string) string {
+	if isTextID(description) || strings.HasPrefix(description, txxxPrefix) {
+		return txxxPrefix + description
+	}
+	return description
+}
+
+// splitText returns the first terminated string of the encoding and what
+// follows it.
+func splitText(encoding byte, data []byte) (string, []byte) {
+	if encoding == encodingUTF16 || encoding == encodingUTF16BE {
+		for i := 0; i+1 < len(data); i += 2 {
+			if data[i] == 0 && data[i+1] == 0 {
+				return decodeText(encoding, data[:i]), data[i+2:]
+			}
+		}
+		return decodeText(encoding, data), nil
+	}
+
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return decodeText(encoding, data[:i]), data[i+1:]
+	}
+	return decodeText(encoding, data), nil
+}
+
+func decodeText(encoding byte, data []byte) string {
+	switch encoding {
+	case encodingLatin1:
+		runes := make([]rune, len(data))
+		for i, c := range data {
+			runes[i] = rune(c)
+		}
+		return string(runes)
+	case encodingUTF16, encodingUTF16BE:
+		var order binary.ByteOrder = binary.BigEndian
+		if encoding == encodingUTF16 && len(data) >= 2 {
+			if data[0] == 0xFF && data[1] == 0xFE {
+				order = binary.LittleEndian
+			}
+			if data[0] == 0xFF && data[1] == 0xFE || data[0] == 0xFE && data[1] == 0xFF {
+				data = data[2:]
+			}
+		}
+		units := make([]uint16, len(data)/2)
+		for i := range units {
+			units[i] = order.Uint16(data[2*i:])
+		}
+		return string(utf16.Decode(units))
+	}
+	return string(data)
+}
+
+// textValue joins the null separated values of a text frame.
+func textValue(data []byte) (string, bool) {
+	if len(data) < 1 {
+		return "", false
+	}
+
+	var values []string
+	encoding, rest := data[0], data[1:]
+	for len(rest) > 0 {
+		var value string
+		value, rest = splitText(encoding, rest)
+		values = append(values, value)
+	}
+	return strings.Join(values, "/"), true
+}
+
+// encodeText encodes the strings, terminating all but the last one. Only
+// v2.4 has UTF-8, v2.3 uses UTF-16 unless Latin-1 is enough.
+func (m *Mp3MetaManager) encodeText(values ...string) []byte {
+	encoding := byte(encodingUTF8)
+	if m.version == 3 {
+		encoding = encodingLatin1
+		for _, v := range values {
+			if strings.ContainsFunc(v, func(r rune) bool { return r > 0xFF }) {
+				encoding = encodingUTF16
+			}
+		}
+	}
+
+	data := []byte{encoding}
+	for i, v := range values {
+		switch encoding {
+		case encodingLatin1:
+			for _, r := range v {
+				data = append(data, byte(r))
+			}
+		case encodingUTF16:
+			data = append(data, 0xFF, 0xFE)
+			for _, u := range utf16.Encode([]rune(v)) {
+				data = binary.LittleEndian.AppendUint16(data, u)
+			}
+		default:
+			data = append(data, v...)
+		}
+		if i < len(values)-1 {
+			data = append(data, 0)
+			if encoding == encodingUTF16 {
+				data = append(data, 0)
+			}
+		}
+	}
+	return data
+}
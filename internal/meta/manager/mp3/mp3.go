@@ -0,0 +1,432 @@
+package mp3
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/zzvanq/tinymedia/internal/file/magic"
+	"github.com/zzvanq/tinymedia/pkg/meta"
+	"github.com/zzvanq/tinymedia/pkg/meta/codec"
+	"github.com/zzvanq/tinymedia/pkg/meta/codec/tinymeta"
+	"github.com/zzvanq/tinymedia/pkg/meta/codec/xmp"
+)
+
+var (
+	ErrVendorNotSupported  = meta.ErrVendorNotSupported
+	ErrFrameNotFound       = fmt.Errorf("frame %w", meta.ErrNotFound)
+	ErrDataSizeTooLarge    = errors.New("data size too large")
+	ErrCorruptedTag        = fmt.Errorf("%w id3 tag", meta.ErrCorrupted)
+	ErrInvalidSignature    = fmt.Errorf("%w mp3 signature", meta.ErrInvalid)
+	ErrVersionNotSupported = fmt.Errorf("id3 version %w", meta.ErrNotSupported)
+)
+
+// Owner is the owner identifier of the PRIV frame the payload is stored
+// in. The id3 vendor has no codec, its fields are the standard text frames
+// by ID and the TXXX frames by description, prefixed by "TXXX:" when it's
+// a standard text frame ID.
+type CodecVendor struct {
+	Codec codec.Codec
+	Owner []byte
+}
+
+var Mp3VendorsCodec = map[codec.MetaCodecVendor]CodecVendor{
+	codec.TinyMetaVendor:     {tinymeta.TinyMeta, []byte("tinymedia:" + codec.TinyMetaVendor)},
+	codec.TinyMetaGzipVendor: {tinymeta.TinyMetaGzip, []byte("tinymedia:" + codec.TinyMetaGzipVendor)},
+	codec.XMPVendor:          {xmp.XMP, []byte("XMP")},
+	codec.ID3Vendor:          {},
+}
+
+// newTagVersion is the version of the tags added to files without one
+const newTagVersion = 4
+
+// Mp3MetaManager parses the ID3v2 tag at the start of the file, the audio
+// frames are streamed. The tag is rewritten in the same room when its
+// padding allows it, so the audio doesn't move.
+type Mp3MetaManager struct {
+	// header is nil when the file has no tag
+	header   []byte
+	r        io.Reader
+	version  byte
+	flags    byte
+	raw      []byte
+	size     int
+	padding  int
+	frames   []frame
+	parsed   bool
+	modified bool
+	err      error
+}
+
+func NewMp3MetaManager(r io.Reader) (*Mp3MetaManager, error) {
+	prefix := make([]byte, tagHeaderSize)
+	n, err := io.ReadFull(r, prefix)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("failed to read the magic bytes")
+	}
+	prefix = prefix[:n]
+
+	m := &Mp3MetaManager{r: r, version: newTagVersion}
+	switch {
+	case bytes.HasPrefix(prefix, magic.ID3Magic):
+		if n < tagHeaderSize {
+			return nil, ErrCorruptedTag
+		}
+		m.header = prefix
+	case magic.IsMPEGAudioSync(prefix):
+		m.r = io.MultiReader(bytes.NewReader(prefix), r)
+	default:
+		return nil, ErrInvalidSignature
+	}
+	return m, nil
+}
+
+// Insert sets the frames of the vendor, as a tag has a single frame by
+// owner or text field.
+func (m *Mp3MetaManager) Insert(vendor codec.MetaCodecVendor, fields map[string]string) error {
+	return m.Upsert(vendor, fields)
+}
+
+func (m *Mp3MetaManager) Upsert(vendor codec.MetaCodecVendor, fields map[string]string) error {
+	c, ok := Mp3VendorsCodec[vendor]
+	if !ok {
+		return ErrVendorNotSupported
+	}
+	if err := m.readTag(); err != nil {
+		return err
+	}
+
+	if vendor == codec.ID3Vendor {
+		for _, field := range slices.Sorted(maps.Keys(fields)) {
+			m.setText(field, fields[field])
+		}
+		return m.checkSize()
+	}
+
+	return m.UpsertPayload(vendor, func(data []byte) ([]byte, error) {
+		return codec.Update(c.Codec, data, fields)
+	})
+}
+
+// UpsertPayload replaces the payload of the vendor with the one update
+// returns for it, given nil when there's none. The id3 vendor has none.
+func (m *Mp3MetaManager) UpsertPayload(vendor codec.MetaCodecVendor, update func(data []byte) ([]byte, error)) error {
+	c, ok := Mp3VendorsCodec[vendor]
+	if !ok || c.Codec == nil {
+		return ErrVendorNotSupported
+	}
+	if err := m.readTag(); err != nil {
+		return err
+	}
+
+	var data []byte
+	if i := m.findPrivate(c.Owner); i >= 0 {
+		data, _ = m.private(m.frames[i], c.Owner)
+	}
+	encoded, err := update(data)
+	if err != nil {
+		return err
+	}
+	m.setPrivate(c.Owner, encoded)
+	return m.checkSize()
+}
+
+func (m *Mp3MetaManager) Extract(vendor codec.MetaCodecVendor, fields ...string) (map[string]string, error) {
+	decoded, err := m.Fields(vendor)
+	if err != nil {
+		return nil, err
+	}
+
+	return codec.Extract(Mp3VendorsCodec[vendor].Codec, decoded, fields...), nil
+}
+
+func (m *Mp3MetaManager) Fields(vendor codec.MetaCodecVendor) (map[string]string, error) {
+	c, ok := Mp3VendorsCodec[vendor]
+	if !ok {
+		return nil, ErrVendorNotSupported
+	}
+	if err := m.readTag(); err != nil {
+		return nil, err
+	}
+
+	if vendor == codec.ID3Vendor {
+		fields := m.texts()
+		if len(fields) == 0 {
+			return nil, ErrFrameNotFound
+		}
+		return fields, nil
+	}
+
+	data, err := m.Payload(vendor)
+	if err != nil {
+		return nil, err
+	}
+	return c.Codec.Decode(data)
+}
+
+// Payload returns the encoded payload of the vendor, the id3 vendor has
+// none.
+func (m *Mp3MetaManager) Payload(vendor codec.MetaCodecVendor) ([]byte, error) {
+	c, ok := Mp3VendorsCodec[vendor]
+	if !ok || c.Codec == nil {
+		return nil, ErrVendorNotSupported
+	}
+	if err := m.readTag(); err != nil {
+		return nil, err
+	}
+
+	i := m.findPrivate(c.Owner)
+	if i < 0 {
+		return nil, ErrFrameNotFound
+	}
+	data, _ := m.private(m.frames[i], c.Owner)
+	return data, nil
+}
+
+func (m *Mp3MetaManager) Vendors() ([]codec.MetaCodecVendor, error) {
+	if err := m.readTag(); err != nil {
+		return nil, err
+	}
+
+	var vendors []codec.MetaCodecVendor
+	if len(m.texts()) > 0 {
+		vendors = append(vendors, codec.ID3Vendor)
+	}
+	for _, vendor := range slices.Sorted(maps.Keys(Mp3VendorsCodec)) {
+		if c := Mp3VendorsCodec[vendor]; m.findPrivate(c.Owner) >= 0 {
+			vendors = append(vendors, vendor)
+		}
+	}
+	return vendors, nil
+}
+
+func (m *Mp3MetaManager) Delete(vendor codec.MetaCodecVendor, fields ...string) error {
+	c, ok := Mp3VendorsCodec[vendor]
+	if !ok {
+		return ErrVendorNotSupported
+	}
+	if err := m.readTag(); err != nil {
+		return err
+	}
+
+	if vendor == codec.ID3Vendor {
+		if len(m.texts()) == 0 {
+			return ErrFrameNotFound
+		}
+		m.removeFrames(func(f frame) bool {
+			field, ok := m.textField(f)
+			return ok && slices.Contains(fields, field)
+		})
+		return nil
+	}
+
+	i := m.findPrivate(c.Owner)
+	if i < 0 {
+		return ErrFrameNotFound
+	}
+	data, _ := m.private(m.frames[i], c.Owner)
+	updated, err := codec.Delete(c.Codec, data, fields...)
+	if err != nil {
+		return err
+	}
+	if updated == nil {
+		m.removeFrames(func(f frame) bool {
+			_, ok := m.private(f, c.Owner)
+			return ok
+		})
+		return nil
+	}
+	m.setPrivate(c.Owner, updated)
+	return m.checkSize()
+}
+
+func (m *Mp3MetaManager) Strip(vendors ...codec.MetaCodecVendor) error {
+	for _, vendor := range vendors {
+		c, ok := Mp3VendorsCodec[vendor]
+		if !ok {
+			return ErrVendorNotSupported
+		}
+		if err := m.readTag(); err != nil {
+			return err
+		}
+
+		m.removeFrames(func(f frame) bool {
+			if vendor == codec.ID3Vendor {
+				_, ok := m.textField(f)
+				return ok
+			}
+			_, ok := m.private(f, c.Owner)
+			return ok
+		})
+	}
+	return nil
+}
+
+// StripAll removes the whole tag.
+func (m *Mp3MetaManager) StripAll() error {
+	if err := m.readTag(); err != nil {
+		return err
+	}
+
+	m.removeFrames(func(frame) bool { return true })
+	return nil
+}
+
+// FileReader keeps the size of the tag when the frames fit in it, the tag
+// grows by its previous padding otherwise. A tag without frames is left
+// out.
+func (m *Mp3MetaManager) FileReader() io.Reader {
+	if !m.parsed {
+		return io.MultiReader(bytes.NewReader(m.header), m.r)
+	}
+	if !m.modified {
+		return io.MultiReader(bytes.NewReader(m.raw), m.r)
+	}
+	if len(m.frames) == 0 {
+		return m.r
+	}
+
+	frames := m.encodeFrames()
+	footer := m.version == 4 && m.flags&flagFooter != 0
+	padding := m.padding
+	if room := m.size - len(frames); room >= 0 && !footer {
+		padding = room
+	}
+	if footer {
+		// tags with a footer can't have padding
+		padding = 0
+	}
+
+	flags := m.flags &^ (flagUnsync | flagExtendedHeader)
+	header := append([]byte("ID3"), m.version, 0, flags)
+	header = append(header, putSynchsafe(len(frames)+padding)...)
+
+	readers := []io.Reader{bytes.NewReader(header), bytes.NewReader(frames), bytes.NewReader(make([]byte, padding))}
+	if footer {
+		footerHeader := append([]byte("3DI"), header[3:]...)
+		readers = append(readers, bytes.NewReader(footerHeader))
+	}
+	return io.MultiReader(append(readers, m.r)...)
+}
+
+func (m *Mp3MetaManager) encodeFrames() []byte {
+	var data []byte
+	for _, f := range m.frames {
+		data = append(data, m.encodeFrame(f)...)
+	}
+	return data
+}
+
+// checkSize fails once the frames don't fit in a synchsafe size.
+func (m *Mp3MetaManager) checkSize() error {
+	size := m.padding
+	for _, f := range m.frames {
+		size += frameHeaderSize + len(f.body)
+	}
+	if size > synchsafeMax {
+		return ErrDataSizeTooLarge
+	}
+	return nil
+}
+
+// texts returns the fields of the text frames.
+func (m *Mp3MetaManager) texts() map[string]string {
+	fields := make(map[string]string)
+	for _, f := range m.frames {
+		field, ok := m.textField(f)
+		if !ok {
+			continue
+		}
+		data, _ := m.content(f)
+		if f.id == idTXXX {
+			// the description, then the value
+			_, value := splitText(data[0], data[1:])
+			data = append([]byte{data[0]}, value...)
+		}
+		if value, ok := textValue(data); ok {
+			fields[field] = value
+		}
+	}
+	return fields
+}
+
+// textField returns the field of a text frame: its ID, or its description
+// for TXXX frames.
+func (m *Mp3MetaManager) textField(f frame) (string, bool) {
+	if f.id != idTXXX && !isTextID(f.id) {
+		return "", false
+	}
+	data, ok := m.content(f)
+	if !ok || len(data) < 1 {
+		return "", false
+	}
+	if f.id != idTXXX {
+		return f.id, true
+	}
+	description, _ := splitText(data[0], data[1:])
+	return txxxField(description), true
+}
+
+func (m *Mp3MetaManager) setText(field, value string) {
+	f := frame{id: field, body: m.encodeText(value)}
+	if !isTextID(field) {
+		description := strings.TrimPrefix(field, txxxPrefix)
+		f = frame{id: idTXXX, body: m.encodeText(description, value)}
+	}
+
+	i := slices.IndexFunc(m.frames, func(old frame) bool {
+		name, ok := m.textField(old)
+		return ok && name == field && old.id == f.id
+	})
+	m.putFrame(i, f)
+}
+
+func (m *Mp3MetaManager) findPrivate(owner []byte) int {
+	return slices.IndexFunc(m.frames, func(f frame) bool {
+		_, ok := m.private(f, owner)
+		return ok
+	})
+}
+
+// private returns the data of a PRIV frame of the owner.
+func (m *Mp3MetaManager) private(f frame, owner []byte) ([]byte, bool) {
+	if f.id != idPRIV || owner == nil {
+		return nil, false
+	}
+	data, ok := m.content(f)
+	if !ok {
+		return nil, false
+	}
+	prefix := append(slices.Clone(owner), 0)
+	if !bytes.HasPrefix(data, prefix) {
+		return nil, false
+	}
+	return data[len(prefix):], true
+}
+
+func (m *Mp3MetaManager) setPrivate(owner, data []byte) {
+	body := slices.Concat(owner, []byte{0}, data)
+	m.putFrame(m.findPrivate(owner), frame{id: idPRIV, body: body})
+}
+
+// putFrame replaces the frame at i, or appends it when i is negative.
+func (m *Mp3MetaManager) putFrame(i int, f frame) {
+	if i < 0 {
+		m.frames = append(m.frames, f)
+	} else {
+		m.frames[i] = f
+	}
+	m.modified = true
+}
+
+func (m *Mp3MetaManager) removeFrames(match func(frame) bool) {
+	n := len(m.frames)
+	m.frames = slices.DeleteFunc(m.frames, match)
+	if len(m.frames) != n {
+		m.modified = true
+	}
+}
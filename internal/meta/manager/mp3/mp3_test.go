@@ -0,0 +1,217 @@
+package mp3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/zzvanq/tinymedia/pkg/meta/codec"
+)
+
+var audio = []byte{0xFF, 0xFB, 0x90, 0x00, 0x00}
+
+// testTag returns a tag of the version with the frames and padding.
+func testTag(version, flags byte, padding int, frames ...[]byte) []byte {
+	body := slices.Concat(frames...)
+	if version == 3 && flags&flagUnsync != 0 {
+		body = bytes.ReplaceAll(body, []byte{0xFF}, []byte{0xFF, 0x00})
+	}
+	body = append(body, make([]byte, padding)...)
+	tag := append([]byte("ID3"), version, 0, flags)
+	return append(append(tag, putSynchsafe(len(body))...), body...)
+}
+
+func textFrame(version byte, id string, flags byte, body []byte) []byte {
+	f := []byte(id)
+	if version == 4 {
+		f = append(f, putSynchsafe(len(body))...)
+	} else {
+		f = binary.BigEndian.AppendUint32(f, uint32(len(body)))
+	}
+	return append(append(f, 0, flags), body...)
+}
+
+func Test_NewMp3MetaManager(t *testing.T) {
+	if _, err := NewMp3MetaManager(bytes.NewReader([]byte("RIFF"))); err != ErrInvalidSignature {
+		t.Errorf("want error: %v, got: %v", ErrInvalidSignature, err)
+	}
+	m, _ := NewMp3MetaManager(bytes.NewReader(testTag(2, 0, 0)))
+	if _, err := m.Vendors(); err != ErrVersionNotSupported {
+		t.Errorf("want error: %v, got: %v", ErrVersionNotSupported, err)
+	}
+}
+
+func Test_Mp3MetaManager_StandardFrames(t *testing.T) {
+	tests := []struct {
+		name string
+		file []byte
+	}{
+		{
+			name: "v2.3 latin1",
+			file: testTag(3, 0, 16, textFrame(3, "TIT2", 0, []byte("\x00Title")), textFrame(3, "TPE1", 0, []byte("\x00Artist\x00"))),
+		},
+		{
+			name: "v2.3 utf16",
+			file: testTag(3, 0, 0,
+				textFrame(3, "TIT2", 0, []byte("\x01\xFF\xFET\x00i\x00t\x00l\x00e\x00")),
+				textFrame(3, "TPE1", 0, []byte("\x01\xFE\xFF\x00A\x00r\x00t\x00i\x00s\x00t"))),
+		},
+		{
+			// the Latin-1 ÿ is 0xFF, followed by a zero once unsynchronised
+			name: "v2.3 unsynchronised tag",
+			file: testTag(3, flagUnsync, 0, textFrame(3, "TIT2", 0, []byte("\x00Title")), textFrame(3, "TPE1", 0, []byte("\x00Artist\xFF"))),
+		},
+		{
+			name: "v2.4 utf8 with data length",
+			file: testTag(4, 0, 8, textFrame(4, "TIT2", v4FlagDataLength, []byte("\x00\x00\x00\x06\x03Title")), textFrame(4, "TPE1", 0, []byte("\x03Artist"))),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewMp3MetaManager(bytes.NewReader(append(tt.file, audio...)))
+			if err != nil {
+				t.Fatalf("want error: %v, got: %v", nil, err)
+			}
+
+			got, err := m.Extract(codec.ID3Vendor, "TIT2", "TPE1")
+			if err != nil {
+				t.Fatalf("want error: %v, got: %v", nil, err)
+			}
+			artist := "Artist"
+			if tt.name == "v2.3 unsynchronised tag" {
+				artist = "Artistÿ"
+			}
+			if want := map[string]string{"TIT2": "Title", "TPE1": artist}; !maps.Equal(got, want) {
+				t.Errorf("want: %v, got: %v", want, got)
+			}
+
+			if err := m.Upsert(codec.ID3Vendor, map[string]string{"TALB": "Album", "episode": "12"}); err != nil {
+				t.Fatalf("want error: %v, got: %v", nil, err)
+			}
+			data, _ := io.ReadAll(m.FileReader())
+			if !bytes.HasSuffix(data, audio) {
+				t.Errorf("audio changed: %v", data)
+			}
+
+			m, _ = NewMp3MetaManager(bytes.NewReader(data))
+			got, err = m.Fields(codec.ID3Vendor)
+			if err != nil {
+				t.Fatalf("want error: %v, got: %v", nil, err)
+			}
+			want := map[string]string{"TIT2": "Title", "TPE1": artist, "TALB": "Album", "episode": "12"}
+			if !maps.Equal(got, want) {
+				t.Errorf("want: %v, got: %v", want, got)
+			}
+		})
+	}
+}
+
+func Test_Mp3MetaManager_UserFrames(t *testing.T) {
+	file := testTag(4, 0, 0,
+		textFrame(4, "TIT2", 0, []byte("\x03Title")),
+		textFrame(4, "TXXX", 0, []byte("\x03TIT2\x00User")))
+	m, _ := NewMp3MetaManager(bytes.NewReader(append(file, audio...)))
+
+	got, err := m.Fields(codec.ID3Vendor)
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if want := map[string]string{"TIT2": "Title", "TXXX:TIT2": "User"}; !maps.Equal(got, want) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+
+	fields := map[string]string{"TIT2": "New", "TXXX:TIT2": "Users", "TABC": "odd"}
+	if err := m.Upsert(codec.ID3Vendor, fields); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	data, _ := io.ReadAll(m.FileReader())
+	m, _ = NewMp3MetaManager(bytes.NewReader(data))
+	if got, _ = m.Fields(codec.ID3Vendor); !maps.Equal(got, fields) {
+		t.Errorf("want: %v, got: %v", fields, got)
+	}
+	// a description out of the standard IDs is a TXXX frame
+	var ids []string
+	for _, f := range m.frames {
+		ids = append(ids, f.id)
+	}
+	if want := []string{"TIT2", "TXXX", "TXXX"}; !slices.Equal(ids, want) {
+		t.Errorf("want frames: %v, got: %v", want, ids)
+	}
+}
+
+func Test_Mp3MetaManager_Padding(t *testing.T) {
+	file := append(testTag(4, 0, 256, textFrame(4, "TIT2", 0, []byte("\x03Title"))), audio...)
+	m, _ := NewMp3MetaManager(bytes.NewReader(file))
+	if err := m.Upsert(codec.TinyMetaVendor, map[string]string{"artist": "a"}); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	data, _ := io.ReadAll(m.FileReader())
+	if len(data) != len(file) {
+		t.Errorf("want the padding used, size: %d, got: %d", len(file), len(data))
+	}
+
+	// the tag grows by the padding left
+	m, _ = NewMp3MetaManager(bytes.NewReader(data))
+	m.readTag()
+	padding := m.padding
+	if err := m.Upsert(codec.TinyMetaVendor, map[string]string{"title": strings.Repeat("t", 512)}); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	data, _ = io.ReadAll(m.FileReader())
+	m, _ = NewMp3MetaManager(bytes.NewReader(data))
+	m.readTag()
+	if m.padding != padding {
+		t.Errorf("want padding: %d, got: %d", padding, m.padding)
+	}
+}
+
+func Test_Mp3MetaManager_Vendors(t *testing.T) {
+	m, _ := NewMp3MetaManager(bytes.NewReader(audio))
+	for _, vendor := range []codec.MetaCodecVendor{codec.TinyMetaVendor, codec.XMPVendor, codec.ID3Vendor} {
+		if err := m.Upsert(vendor, map[string]string{"dc:title": "t"}); err != nil {
+			t.Fatalf("want error: %v, got: %v", nil, err)
+		}
+	}
+
+	data, _ := io.ReadAll(m.FileReader())
+	m, _ = NewMp3MetaManager(bytes.NewReader(data))
+	vendors, err := m.Vendors()
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	want := []codec.MetaCodecVendor{codec.ID3Vendor, codec.TinyMetaVendor, codec.XMPVendor}
+	if !slices.Equal(vendors, want) {
+		t.Errorf("want: %v, got: %v", want, vendors)
+	}
+
+	if err := m.Strip(codec.XMPVendor); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if err := m.Delete(codec.TinyMetaVendor, "dc:title"); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if _, err := m.Fields(codec.TinyMetaVendor); err != ErrFrameNotFound {
+		t.Errorf("want error: %v, got: %v", ErrFrameNotFound, err)
+	}
+
+	if err := m.StripAll(); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	data, _ = io.ReadAll(m.FileReader())
+	if !bytes.Equal(data, audio) {
+		t.Errorf("want: %v, got: %v", audio, data)
+	}
+}
+
+func Test_Mp3MetaManager_Corrupted(t *testing.T) {
+	file := testTag(4, 0, 0, textFrame(4, "TIT2", 0, []byte("\x03Title")))
+	m, _ := NewMp3MetaManager(bytes.NewReader(file[:len(file)-1]))
+	if _, err := m.Fields(codec.ID3Vendor); err != ErrCorruptedTag {
+		t.Errorf("want error: %v, got: %v", ErrCorruptedTag, err)
+	}
+}
@@ -0,0 +1,353 @@
+package png
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+
+	"github.com/zzvanq/tinymedia/pkg/meta/codec"
+)
+
+const (
+	lengthSize  = 4
+	typeSize    = 4
+	crcSize     = 4
+	headerSize  = lengthSize + typeSize
+	dataMaxSize = 1<<31 - 1
+)
+
+const (
+	typeIHDR = "IHDR"
+	typeIDAT = "IDAT"
+	typeIEND = "IEND"
+	typeTEXT = "tEXt"
+	typeZTXT = "zTXt"
+	typeITXT = "iTXt"
+	typeEXIF = "eXIf"
+)
+
+type readSeekerAt interface {
+	io.ReadSeeker
+	io.ReaderAt
+}
+
+// renderingChunks are the ancillary chunks affecting how the image looks,
+// APNG animation chunks included.
+var renderingChunks = []string{
+	"cHRM", "gAMA", "iCCP", "sBIT", "sRGB", "cICP", "mDCV", "cLLI",
+	"bKGD", "hIST", "tRNS", "pHYs", "sPLT", "acTL", "fcTL", "fdAT",
+}
+
+// findChunk looks the vendor chunk up in the whole file, as text chunks
+// may follow the image data.
+func (m *PngMetaManager) findChunk(c CodecVendor) (int, error) {
+	if err := m.readChunks(); err != nil {
+		return 0, err
+	}
+	return m.findParsed(c)
+}
+
+func (m *PngMetaManager) findParsed(c CodecVendor) (int, error) {
+	for i, chunk := range m.chunks {
+		if c.matches(chunk) {
+			return i, nil
+		}
+	}
+	return 0, ErrChunkNotFound
+}
+
+// readChunks parses the rest of the file up to IEND.
+func (m *PngMetaManager) readChunks() error {
+	if err := m.readHeader(); err != nil {
+		return err
+	}
+
+	for chunkType(m.chunks[len(m.chunks)-1]) != typeIEND {
+		chunk, err := m.nextChunk()
+		if err != nil {
+			return err
+		}
+		m.chunks = append(m.chunks, chunk)
+	}
+	return nil
+}
+
+func (m *PngMetaManager) readHeader() error {
+	if len(m.chunks) > 0 {
+		return nil
+	}
+
+	chunk, err := m.nextChunk()
+	if err != nil {
+		return err
+	}
+	if chunkType(chunk) != typeIHDR {
+		return ErrCorruptedChunk
+	}
+	m.chunks = append(m.chunks, chunk)
+	return nil
+}
+
+// nextChunk returns the next chunk, or only the header of the first image
+// data chunk, the image data being read by readImage.
+func (m *PngMetaManager) nextChunk() ([]byte, error) {
+	headers, err := m.nextHeader()
+	if err != nil {
+		return nil, err
+	}
+	dataSize := binary.BigEndian.Uint32(headers[:lengthSize])
+
+	if chunkType(headers) == typeIDAT && m.image == nil {
+		if err := m.readImage(int64(dataSize)); err != nil {
+			return nil, err
+		}
+		return headers, nil
+	}
+
+	chunk := make([]byte, headerSize+int(dataSize)+crcSize)
+	copy(chunk, headers)
+	if _, err := io.ReadFull(m.r, chunk[headerSize:]); err != nil {
+		return nil, ErrCorruptedChunk
+	}
+
+	crc := binary.BigEndian.Uint32(chunk[len(chunk)-crcSize:])
+	if crc != crc32.ChecksumIEEE(chunk[lengthSize:len(chunk)-crcSize]) {
+		return nil, ErrCorruptedChunk
+	}
+	return chunk, nil
+}
+
+func (m *PngMetaManager) nextHeader() ([]byte, error) {
+	if m.next != nil {
+		headers := m.next
+		m.next = nil
+		return headers, nil
+	}
+
+	headers := make([]byte, headerSize)
+	if _, err := io.ReadFull(m.r, headers); err != nil {
+		return nil, ErrCorruptedChunk
+	}
+
+	dataSize := binary.BigEndian.Uint32(headers[:lengthSize])
+	if dataSize > dataMaxSize || !isChunkType(headers[lengthSize:headerSize]) {
+		return nil, ErrCorruptedChunk
+	}
+	return headers, nil
+}
+
+// readImage goes over the consecutive image data chunks, the first one of
+// the size, leaving the header of the chunk following them in next.
+func (m *PngMetaManager) readImage(size int64) error {
+	rs, seekable := m.r.(readSeekerAt)
+	var start int64
+	var buf bytes.Buffer
+	if seekable {
+		var err error
+		if start, err = rs.Seek(0, io.SeekCurrent); err != nil {
+			return err
+		}
+	}
+
+	for {
+		if seekable {
+			if _, err := rs.Seek(size+crcSize, io.SeekCurrent); err != nil {
+				return err
+			}
+		} else if _, err := io.CopyN(&buf, m.r, size+crcSize); err != nil {
+			return ErrCorruptedChunk
+		}
+
+		headers, err := m.nextHeader()
+		if err != nil {
+			return err
+		}
+		if chunkType(headers) != typeIDAT {
+			m.next = headers
+			break
+		}
+		buf.Write(headers)
+		size = int64(binary.BigEndian.Uint32(headers[:lengthSize]))
+	}
+
+	m.image = &buf
+	if seekable {
+		end, err := rs.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		m.image = io.NewSectionReader(rs, start, end-headerSize-start)
+	}
+	return nil
+}
+
+func createChunk(cType string, data []byte) ([]byte, error) {
+	if len(data) > dataMaxSize {
+		return nil, ErrDataSizeTooLarge
+	}
+
+	chunk := make([]byte, headerSize+len(data)+crcSize)
+	binary.BigEndian.PutUint32(chunk[:lengthSize], uint32(len(data)))
+	copy(chunk[lengthSize:headerSize], cType)
+	copy(chunk[headerSize:], data)
+	crc := crc32.ChecksumIEEE(chunk[lengthSize : len(chunk)-crcSize])
+	binary.BigEndian.PutUint32(chunk[len(chunk)-crcSize:], crc)
+	return chunk, nil
+}
+
+// createTextChunk always writes iTXt, since the payloads are UTF-8
+// and tEXt/zTXt are limited to Latin-1.
+func createTextChunk(keyword []byte, text []byte, compressed bool) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(keyword)
+	// keyword terminator, compression flag, compression method
+	buf.WriteByte(0)
+	if compressed {
+		buf.Write([]byte{1, 0})
+	} else {
+		buf.Write([]byte{0, 0})
+	}
+	// empty language tag and translated keyword
+	buf.Write([]byte{0, 0})
+
+	if compressed {
+		zw := zlib.NewWriter(&buf)
+		if _, err := zw.Write(text); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+	} else {
+		buf.Write(text)
+	}
+	return createChunk(typeITXT, buf.Bytes())
+}
+
+func textChunkData(chunk []byte) ([]byte, error) {
+	data := chunkData(chunk)
+	kwEnd := bytes.IndexByte(data, 0)
+	if kwEnd < 0 {
+		return nil, ErrCorruptedChunk
+	}
+	data = data[kwEnd+1:]
+
+	switch chunkType(chunk) {
+	case typeTEXT:
+		return data, nil
+	case typeZTXT:
+		if len(data) < 1 || data[0] != 0 {
+			return nil, ErrCorruptedChunk
+		}
+		return inflate(data[1:])
+	case typeITXT:
+		if len(data) < 2 {
+			return nil, ErrCorruptedChunk
+		}
+		compressed := data[0] == 1
+		data = data[2:]
+		// skip the language tag and the translated keyword
+		for range 2 {
+			end := bytes.IndexByte(data, 0)
+			if end < 0 {
+				return nil, ErrCorruptedChunk
+			}
+			data = data[end+1:]
+		}
+		if compressed {
+			return inflate(data)
+		}
+		return data, nil
+	}
+	return nil, ErrCorruptedChunk
+}
+
+func inflate(data []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrCorruptedChunk
+	}
+	defer zr.Close()
+
+	text, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, ErrCorruptedChunk
+	}
+	return text, nil
+}
+
+func chunkKeyword(chunk []byte) []byte {
+	switch chunkType(chunk) {
+	case typeTEXT, typeZTXT, typeITXT:
+	default:
+		return nil
+	}
+
+	data := chunkData(chunk)
+	end := bytes.IndexByte(data, 0)
+	if end < 0 {
+		return nil
+	}
+	return data[:end]
+}
+
+func chunkVendor(chunk []byte) (codec.MetaCodecVendor, bool) {
+	for vendor, c := range PngVendorsCodec {
+		if c.matches(chunk) {
+			return vendor, true
+		}
+	}
+	keyword := chunkKeyword(chunk)
+	if keyword == nil {
+		return "", false
+	}
+	return codec.MetaCodecVendor(keyword), true
+}
+
+func (c CodecVendor) matches(chunk []byte) bool {
+	if c.Type != typeITXT {
+		return chunkType(chunk) == c.Type
+	}
+	return bytes.Equal(chunkKeyword(chunk), c.Keyword)
+}
+
+// payload returns the data the codec decodes, text chunks of any type
+// are read.
+func (c CodecVendor) payload(chunk []byte) ([]byte, error) {
+	if c.Type != typeITXT {
+		return chunkData(chunk), nil
+	}
+	return textChunkData(chunk)
+}
+
+func (c CodecVendor) createChunk(data []byte) ([]byte, error) {
+	if c.Type != typeITXT {
+		return createChunk(c.Type, data)
+	}
+	return createTextChunk(c.Keyword, data, c.Compressed)
+}
+
+func chunkType(chunk []byte) string {
+	if len(chunk) < headerSize {
+		return ""
+	}
+	return string(chunk[lengthSize:headerSize])
+}
+
+func chunkData(chunk []byte) []byte {
+	if len(chunk) < headerSize+crcSize {
+		return nil
+	}
+	return chunk[headerSize : len(chunk)-crcSize]
+}
+
+func isChunkType(t []byte) bool {
+	for _, b := range t {
+		if (b < 'A' || b > 'Z') && (b < 'a' || b > 'z') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,161 @@
+package png
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"testing"
+
+	"github.com/zzvanq/tinymedia/pkg/meta/codec"
+)
+
+func Test_PngMetaManager_nextChunk(t *testing.T) {
+	correct, _ := createChunk(typeTEXT, []byte("k\x00v"))
+	badCRC := bytes.Clone(correct)
+	badCRC[len(badCRC)-1] ^= 0xFF
+	badType := bytes.Clone(correct)
+	badType[lengthSize] = '1'
+
+	tests := []struct {
+		name    string
+		r       io.Reader
+		want    []byte
+		wantErr error
+	}{
+		{
+			name:    "less than headerSize bytes",
+			r:       bytes.NewReader([]byte{0x00, 0x00, 0x00}),
+			want:    nil,
+			wantErr: ErrCorruptedChunk,
+		},
+		{
+			name:    "less than data size",
+			r:       bytes.NewReader(correct[:len(correct)-1]),
+			want:    nil,
+			wantErr: ErrCorruptedChunk,
+		},
+		{
+			name:    "wrong crc",
+			r:       bytes.NewReader(badCRC),
+			want:    nil,
+			wantErr: ErrCorruptedChunk,
+		},
+		{
+			name:    "wrong type",
+			r:       bytes.NewReader(badType),
+			want:    nil,
+			wantErr: ErrCorruptedChunk,
+		},
+		{
+			name:    "success",
+			r:       bytes.NewReader(correct),
+			want:    correct,
+			wantErr: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &PngMetaManager{r: tt.r}
+			got, err := m.nextChunk()
+			if err != tt.wantErr {
+				t.Errorf("want error: %v, got: %v", tt.wantErr, err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("want: %v, got: %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_PngMetaManager_findChunk(t *testing.T) {
+	text, _ := createChunk(typeTEXT, []byte("other\x00v"))
+	found, _ := createTextChunk([]byte("tinymeta"), []byte("{}"), false)
+	idat, _ := createChunk(typeIDAT, nil)
+	afterIDAT, _ := createTextChunk([]byte("tinymeta"), []byte("{}"), false)
+	iend, _ := createChunk(typeIEND, nil)
+	ihdr, _ := createChunk(typeIHDR, make([]byte, 13))
+
+	tests := []struct {
+		name    string
+		chunks  [][]byte
+		want    int
+		wantErr error
+	}{
+		{
+			name:    "corrupted",
+			chunks:  nil,
+			want:    0,
+			wantErr: ErrCorruptedChunk,
+		},
+		{
+			name:    "not found",
+			chunks:  [][]byte{ihdr, text, idat, iend},
+			want:    0,
+			wantErr: ErrChunkNotFound,
+		},
+		{
+			name:    "after idat",
+			chunks:  [][]byte{ihdr, idat, afterIDAT, iend},
+			want:    2,
+			wantErr: nil,
+		},
+		{
+			name:    "found",
+			chunks:  [][]byte{ihdr, text, found, idat, iend},
+			want:    2,
+			wantErr: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &PngMetaManager{r: bytes.NewReader(bytes.Join(tt.chunks, nil))}
+			got, err := m.findChunk(PngVendorsCodec[codec.TinyMetaVendor])
+			if err != tt.wantErr {
+				t.Errorf("want error: %v, got: %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("want: %v, got: %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_textChunkData(t *testing.T) {
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write([]byte("zipped"))
+	zw.Close()
+
+	text, _ := createChunk(typeTEXT, []byte("k\x00plain"))
+	ztxt, _ := createChunk(typeZTXT, append([]byte("k\x00\x00"), z.Bytes()...))
+	itxt, _ := createTextChunk([]byte("k"), []byte("international"), false)
+	itxtZ, _ := createTextChunk([]byte("k"), []byte("zipped"), true)
+	noKeyword, _ := createChunk(typeTEXT, []byte("k"))
+
+	tests := []struct {
+		name    string
+		chunk   []byte
+		want    []byte
+		wantErr error
+	}{
+		{name: "tEXt", chunk: text, want: []byte("plain")},
+		{name: "zTXt", chunk: ztxt, want: []byte("zipped")},
+		{name: "iTXt", chunk: itxt, want: []byte("international")},
+		{name: "compressed iTXt", chunk: itxtZ, want: []byte("zipped")},
+		{name: "no keyword", chunk: noKeyword, wantErr: ErrCorruptedChunk},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := textChunkData(tt.chunk)
+			if err != tt.wantErr {
+				t.Errorf("want error: %v, got: %v", tt.wantErr, err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("want: %s, got: %s", tt.want, got)
+			}
+		})
+	}
+}
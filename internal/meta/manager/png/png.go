@@ -0,0 +1,280 @@
+package png
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/zzvanq/tinymedia/internal/file/magic"
+	"github.com/zzvanq/tinymedia/pkg/meta"
+	"github.com/zzvanq/tinymedia/pkg/meta/codec"
+	"github.com/zzvanq/tinymedia/pkg/meta/codec/exif"
+	"github.com/zzvanq/tinymedia/pkg/meta/codec/tinymeta"
+	"github.com/zzvanq/tinymedia/pkg/meta/codec/xmp"
+)
+
+var (
+	ErrVendorNotSupported = meta.ErrVendorNotSupported
+	ErrChunkNotFound      = fmt.Errorf("chunk %w", meta.ErrNotFound)
+	ErrDataSizeTooLarge   = errors.New("data size too large")
+	ErrCorruptedChunk     = fmt.Errorf("%w chunk", meta.ErrCorrupted)
+	ErrInvalidSignature   = fmt.Errorf("%w png signature", meta.ErrInvalid)
+)
+
+// Type is the type of the chunk the payload is stored in, text chunks
+// are told apart by Keyword. Compressed payloads are zlib-deflated inside
+// the iTXt chunk, the only compression PNG allows, so tinymetagzip keeps
+// the plain tinymeta codec.
+type CodecVendor struct {
+	Codec      codec.Codec
+	Type       string
+	Keyword    []byte
+	Compressed bool
+}
+
+var PngVendorsCodec = map[codec.MetaCodecVendor]CodecVendor{
+	codec.TinyMetaVendor:     {tinymeta.TinyMeta, typeITXT, []byte(codec.TinyMetaVendor), false},
+	codec.TinyMetaGzipVendor: {tinymeta.TinyMeta, typeITXT, []byte(codec.TinyMetaGzipVendor), true},
+	codec.ExifVendor:         {exif.Exif, typeEXIF, nil, false},
+	codec.XMPVendor:          {xmp.XMP, typeITXT, []byte("XML:com.adobe.xmp"), false},
+}
+
+// PngMetaManager buffers the chunks but the image data, whose chunks are
+// kept as the header of the first one. The rest of them is skipped when
+// the reader can be seeked, and read through it again when the file is
+// written, it's buffered otherwise.
+type PngMetaManager struct {
+	prefix []byte
+	r      io.Reader
+	chunks [][]byte
+	// image is the data of the image chunks after the first header
+	image io.Reader
+	// next is the header read past the image data
+	next []byte
+}
+
+func NewPngMetaManager(r io.Reader) (*PngMetaManager, error) {
+	prefix := make([]byte, len(magic.PNGMagic))
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, fmt.Errorf("failed to read the magic bytes")
+	}
+
+	if !bytes.Equal(prefix, magic.PNGMagic) {
+		return nil, ErrInvalidSignature
+	}
+
+	return &PngMetaManager{
+		prefix: prefix,
+		r:      r,
+		chunks: [][]byte{},
+	}, nil
+}
+
+func (m *PngMetaManager) Insert(vendor codec.MetaCodecVendor, fields map[string]string) error {
+	c, ok := PngVendorsCodec[vendor]
+	if !ok {
+		return ErrVendorNotSupported
+	}
+
+	encoded, err := c.Codec.Encode(fields)
+	if err != nil {
+		return err
+	}
+	return m.insert(c, encoded)
+}
+
+func (m *PngMetaManager) insert(c CodecVendor, encoded []byte) error {
+	chunk, err := c.createChunk(encoded)
+	if err != nil {
+		return err
+	}
+
+	if err := m.readHeader(); err != nil {
+		return err
+	}
+	// IHDR must stay the first chunk
+	m.chunks = append(m.chunks[:1], append([][]byte{chunk}, m.chunks[1:]...)...)
+	return nil
+}
+
+func (m *PngMetaManager) Upsert(vendor codec.MetaCodecVendor, fields map[string]string) error {
+	c, ok := PngVendorsCodec[vendor]
+	if !ok {
+		return ErrVendorNotSupported
+	}
+	return m.UpsertPayload(vendor, func(data []byte) ([]byte, error) {
+		return codec.Update(c.Codec, data, fields)
+	})
+}
+
+// UpsertPayload replaces the payload of the vendor with the one update
+// returns for it, given nil when there's none.
+func (m *PngMetaManager) UpsertPayload(vendor codec.MetaCodecVendor, update func(data []byte) ([]byte, error)) error {
+	c, ok := PngVendorsCodec[vendor]
+	if !ok {
+		return ErrVendorNotSupported
+	}
+
+	i, err := m.findChunk(c)
+	if err != nil {
+		if err == ErrChunkNotFound {
+			encoded, err := update(nil)
+			if err != nil {
+				return err
+			}
+			return m.insert(c, encoded)
+		}
+		return err
+	}
+
+	text, err := c.payload(m.chunks[i])
+	if err != nil {
+		return err
+	}
+
+	encoded, err := update(text)
+	if err != nil {
+		return err
+	}
+
+	chunk, err := c.createChunk(encoded)
+	if err != nil {
+		return err
+	}
+	m.chunks[i] = chunk
+	return nil
+}
+
+func (m *PngMetaManager) Extract(vendor codec.MetaCodecVendor, fields ...string) (map[string]string, error) {
+	decoded, err := m.Fields(vendor)
+	if err != nil {
+		return nil, err
+	}
+
+	return codec.Extract(PngVendorsCodec[vendor].Codec, decoded, fields...), nil
+}
+
+func (m *PngMetaManager) Fields(vendor codec.MetaCodecVendor) (map[string]string, error) {
+	c, ok := PngVendorsCodec[vendor]
+	if !ok {
+		return nil, ErrVendorNotSupported
+	}
+
+	text, err := m.Payload(vendor)
+	if err != nil {
+		return nil, err
+	}
+	return c.Codec.Decode(text)
+}
+
+// Payload returns the encoded payload of the vendor.
+func (m *PngMetaManager) Payload(vendor codec.MetaCodecVendor) ([]byte, error) {
+	c, ok := PngVendorsCodec[vendor]
+	if !ok {
+		return nil, ErrVendorNotSupported
+	}
+
+	i, err := m.findChunk(c)
+	if err != nil {
+		return nil, err
+	}
+	return c.payload(m.chunks[i])
+}
+
+// Vendors lists the vendors of all the text chunks in order of appearance,
+// the unknown ones are named after their keyword.
+func (m *PngMetaManager) Vendors() ([]codec.MetaCodecVendor, error) {
+	if err := m.readChunks(); err != nil {
+		return nil, err
+	}
+
+	var vendors []codec.MetaCodecVendor
+	for _, chunk := range m.chunks {
+		vendor, ok := chunkVendor(chunk)
+		if ok && !slices.Contains(vendors, vendor) {
+			vendors = append(vendors, vendor)
+		}
+	}
+	return vendors, nil
+}
+
+func (m *PngMetaManager) Delete(vendor codec.MetaCodecVendor, fields ...string) error {
+	c, ok := PngVendorsCodec[vendor]
+	if !ok {
+		return ErrVendorNotSupported
+	}
+
+	i, err := m.findChunk(c)
+	if err != nil {
+		return err
+	}
+
+	text, err := c.payload(m.chunks[i])
+	if err != nil {
+		return err
+	}
+
+	updated, err := codec.Delete(c.Codec, text, fields...)
+	if err != nil {
+		return err
+	}
+	if updated == nil {
+		m.chunks = slices.Delete(m.chunks, i, i+1)
+		return nil
+	}
+
+	chunk, err := c.createChunk(updated)
+	if err != nil {
+		return err
+	}
+	m.chunks[i] = chunk
+	return nil
+}
+
+func (m *PngMetaManager) Strip(vendors ...codec.MetaCodecVendor) error {
+	for _, vendor := range vendors {
+		c, ok := PngVendorsCodec[vendor]
+		if !ok {
+			return ErrVendorNotSupported
+		}
+
+		if err := m.readChunks(); err != nil {
+			return err
+		}
+		m.chunks = slices.DeleteFunc(m.chunks, c.matches)
+	}
+	return nil
+}
+
+// StripAll removes every ancillary chunk not needed to render the image,
+// including the ones after the image data.
+func (m *PngMetaManager) StripAll() error {
+	if err := m.readChunks(); err != nil {
+		return err
+	}
+
+	m.chunks = slices.DeleteFunc(m.chunks, func(chunk []byte) bool {
+		cType := chunkType(chunk)
+		// critical chunks have the first letter uppercase
+		if cType[0] >= 'A' && cType[0] <= 'Z' {
+			return false
+		}
+		return !slices.Contains(renderingChunks, cType)
+	})
+	return nil
+}
+
+func (m *PngMetaManager) FileReader() io.Reader {
+	readers := make([]io.Reader, 0, len(m.chunks)+4)
+	readers = append(readers, bytes.NewReader(m.prefix))
+	for _, chunk := range m.chunks {
+		readers = append(readers, bytes.NewReader(chunk))
+		if chunkType(chunk) == typeIDAT && m.image != nil {
+			readers = append(readers, m.image)
+		}
+	}
+	readers = append(readers, bytes.NewReader(m.next), m.r)
+	return io.MultiReader(readers...)
+}
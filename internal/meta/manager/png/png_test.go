@@ -0,0 +1,288 @@
+package png
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"testing"
+
+	"github.com/zzvanq/tinymedia/internal/file/magic"
+	"github.com/zzvanq/tinymedia/pkg/meta/codec"
+)
+
+func testPNG(t *testing.T, chunks ...[]byte) []byte {
+	t.Helper()
+
+	ihdr, _ := createChunk(typeIHDR, make([]byte, 13))
+	idat, _ := createChunk(typeIDAT, []byte{0x01, 0x02})
+	iend, _ := createChunk(typeIEND, nil)
+
+	data := append([]byte{}, magic.PNGMagic...)
+	data = append(data, ihdr...)
+	for _, chunk := range chunks {
+		data = append(data, chunk...)
+	}
+	data = append(data, idat...)
+	return append(data, iend...)
+}
+
+func Test_PngMetaManager_Insert_Errors(t *testing.T) {
+	m := &PngMetaManager{}
+	if err := m.Insert("unsupported", map[string]string{"test": "test"}); err != ErrVendorNotSupported {
+		t.Errorf("Insert() error = %v, wantErr %v", err, ErrVendorNotSupported)
+	}
+
+	m = &PngMetaManager{r: bytes.NewReader([]byte{})}
+	if err := m.Insert(codec.TinyMetaVendor, map[string]string{"test": "test"}); err != ErrCorruptedChunk {
+		t.Errorf("Insert() error = %v, wantErr %v", err, ErrCorruptedChunk)
+	}
+}
+
+func Test_PngMetaManager_Insert(t *testing.T) {
+	c := PngVendorsCodec[codec.TinyMetaVendor]
+
+	fields := map[string]string{"k": "v"}
+	encoded, _ := c.Codec.Encode(fields)
+	chunk, _ := createTextChunk(c.Keyword, encoded, c.Compressed)
+
+	ihdr, _ := createChunk(typeIHDR, make([]byte, 13))
+	m := &PngMetaManager{}
+	m.chunks = [][]byte{ihdr, []byte("test")}
+
+	if err := m.Insert(codec.TinyMetaVendor, fields); err != nil {
+		t.Errorf("Insert error = %v", err)
+	}
+
+	if len(m.chunks) != 3 {
+		t.Errorf("wrong m.chunks length = %d", len(m.chunks))
+	}
+
+	if !bytes.Equal(m.chunks[1], chunk) {
+		t.Errorf("wrong chunk at 1:\nchunk: %v\nm.chunks[1]: %v\n", chunk, m.chunks[1])
+	}
+}
+
+func Test_PngMetaManager_UpsertExtract(t *testing.T) {
+	tests := []struct {
+		name      string
+		vendor    codec.MetaCodecVendor
+		artist    string
+		title     string
+		chunkType string
+	}{
+		{name: "tinymeta", vendor: codec.TinyMetaVendor, artist: "artist", title: "title", chunkType: typeITXT},
+		{name: "tinymetagzip", vendor: codec.TinyMetaGzipVendor, artist: "artist", title: "title", chunkType: typeITXT},
+		{name: "exif", vendor: codec.ExifVendor, artist: "Artist", title: "ImageDescription", chunkType: typeEXIF},
+		{name: "xmp", vendor: codec.XMPVendor, artist: "dc:creator", title: "dc:title", chunkType: typeITXT},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewPngMetaManager(bytes.NewReader(testPNG(t)))
+			if err != nil {
+				t.Fatalf("want error: %v, got: %v", nil, err)
+			}
+			if err := m.Upsert(tt.vendor, map[string]string{tt.artist: "a", tt.title: "t"}); err != nil {
+				t.Fatalf("want error: %v, got: %v", nil, err)
+			}
+
+			data, _ := io.ReadAll(m.FileReader())
+			m, _ = NewPngMetaManager(bytes.NewReader(data))
+			if err := m.Upsert(tt.vendor, map[string]string{tt.title: "new"}); err != nil {
+				t.Fatalf("want error: %v, got: %v", nil, err)
+			}
+
+			data, _ = io.ReadAll(m.FileReader())
+			m, _ = NewPngMetaManager(bytes.NewReader(data))
+			got, err := m.Extract(tt.vendor, tt.artist, tt.title, "missing")
+			if err != nil {
+				t.Fatalf("want error: %v, got: %v", nil, err)
+			}
+			if len(got) != 2 || got[tt.artist] != "a" || got[tt.title] != "new" {
+				t.Errorf("want: %v, got: %v", map[string]string{tt.artist: "a", tt.title: "new"}, got)
+			}
+
+			if chunkType(m.chunks[0]) != typeIHDR || chunkType(m.chunks[1]) != tt.chunkType {
+				t.Errorf("want chunks order: IHDR, %s, got: %s, %s", tt.chunkType, chunkType(m.chunks[0]), chunkType(m.chunks[1]))
+			}
+		})
+	}
+}
+
+func Test_PngMetaManager_Extract_NotFound(t *testing.T) {
+	m, _ := NewPngMetaManager(bytes.NewReader(testPNG(t)))
+	if _, err := m.Extract(codec.TinyMetaVendor, "artist"); err != ErrChunkNotFound {
+		t.Errorf("want error: %v, got: %v", ErrChunkNotFound, err)
+	}
+	if _, err := m.Extract(codec.TinyMetaGzipVendor, "artist"); err != ErrChunkNotFound {
+		t.Errorf("want error: %v, got: %v", ErrChunkNotFound, err)
+	}
+
+	got, _ := io.ReadAll(m.FileReader())
+	if !bytes.Equal(got, testPNG(t)) {
+		t.Errorf("file changed after extract:\nwant: %v\ngot: %v", testPNG(t), got)
+	}
+}
+
+func Test_NewPngMetaManager(t *testing.T) {
+	if _, err := NewPngMetaManager(bytes.NewReader([]byte{0xFF, 0xD8, 0, 0, 0, 0, 0, 0})); err != ErrInvalidSignature {
+		t.Errorf("want error: %v, got: %v", ErrInvalidSignature, err)
+	}
+}
+
+func Test_PngMetaManager_Delete(t *testing.T) {
+	m, _ := NewPngMetaManager(bytes.NewReader(testPNG(t)))
+	if err := m.Upsert(codec.TinyMetaGzipVendor, map[string]string{"artist": "a", "title": "t"}); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+
+	data, _ := io.ReadAll(m.FileReader())
+	m, _ = NewPngMetaManager(bytes.NewReader(data))
+	if err := m.Delete(codec.TinyMetaGzipVendor, "artist"); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	got, _ := m.Extract(codec.TinyMetaGzipVendor, "artist", "title")
+	if len(got) != 1 || got["title"] != "t" {
+		t.Errorf("want: %v, got: %v", map[string]string{"title": "t"}, got)
+	}
+
+	if err := m.Delete(codec.TinyMetaGzipVendor, "title"); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	data, _ = io.ReadAll(m.FileReader())
+	if !bytes.Equal(data, testPNG(t)) {
+		t.Errorf("empty chunk not dropped:\nwant: %v\ngot: %v", testPNG(t), data)
+	}
+}
+
+func Test_PngMetaManager_Strip(t *testing.T) {
+	gama, _ := createChunk("gAMA", []byte{0, 0, 0xB1, 0x8F})
+	time, _ := createChunk("tIME", make([]byte, 7))
+	text, _ := createChunk(typeTEXT, []byte("Comment\x00hello"))
+	file := testPNG(t, gama, time, text)
+
+	m, _ := NewPngMetaManager(bytes.NewReader(file))
+	if err := m.Upsert(codec.TinyMetaVendor, map[string]string{"artist": "a"}); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if err := m.Strip(codec.TinyMetaVendor, codec.TinyMetaGzipVendor); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	data, _ := io.ReadAll(m.FileReader())
+	if !bytes.Equal(data, file) {
+		t.Errorf("want: %v\ngot: %v", file, data)
+	}
+	if err := m.Strip("unsupported"); err != ErrVendorNotSupported {
+		t.Errorf("want error: %v, got: %v", ErrVendorNotSupported, err)
+	}
+
+	m, _ = NewPngMetaManager(bytes.NewReader(file))
+	if err := m.StripAll(); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	data, _ = io.ReadAll(m.FileReader())
+	if want := testPNG(t, gama); !bytes.Equal(data, want) {
+		t.Errorf("want: %v\ngot: %v", want, data)
+	}
+}
+
+func Test_PngMetaManager_Vendors(t *testing.T) {
+	text, _ := createChunk(typeTEXT, []byte("Comment\x00hello"))
+	m, _ := NewPngMetaManager(bytes.NewReader(testPNG(t, text)))
+	if err := m.Upsert(codec.TinyMetaGzipVendor, map[string]string{"artist": "a"}); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+
+	got, err := m.Vendors()
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	want := []codec.MetaCodecVendor{codec.TinyMetaGzipVendor, "Comment"}
+	if !slices.Equal(got, want) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+
+	fields, err := m.Fields(codec.TinyMetaGzipVendor)
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if len(fields) != 1 || fields["artist"] != "a" {
+		t.Errorf("want: %v, got: %v", map[string]string{"artist": "a"}, fields)
+	}
+}
+
+func Test_PngMetaManager_ImageData(t *testing.T) {
+	ihdr, _ := createChunk(typeIHDR, make([]byte, 13))
+	idat1, _ := createChunk(typeIDAT, []byte{0x01, 0x02})
+	idat2, _ := createChunk(typeIDAT, []byte{0x03})
+	text, _ := createChunk(typeTEXT, []byte("Comment\x00hello"))
+	iend, _ := createChunk(typeIEND, nil)
+	file := slices.Concat(magic.PNGMagic, ihdr, idat1, idat2, text, iend)
+
+	tests := []struct {
+		name     string
+		r        io.Reader
+		seekable bool
+	}{
+		{name: "seekable", r: bytes.NewReader(file), seekable: true},
+		{name: "stream", r: io.MultiReader(bytes.NewReader(file))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _ := NewPngMetaManager(tt.r)
+			if err := m.StripAll(); err != nil {
+				t.Fatalf("want error: %v, got: %v", nil, err)
+			}
+			if _, ok := m.image.(*io.SectionReader); ok != tt.seekable {
+				t.Errorf("want the image data skipped: %v, got: %v", tt.seekable, ok)
+			}
+
+			data, _ := io.ReadAll(m.FileReader())
+			if want := slices.Concat(magic.PNGMagic, ihdr, idat1, idat2, iend); !bytes.Equal(data, want) {
+				t.Errorf("want: %v\ngot: %v", want, data)
+			}
+		})
+	}
+}
+
+func Test_PngMetaManager_VendorsAfterImageData(t *testing.T) {
+	text, _ := createChunk(typeTEXT, []byte("Comment\x00hello"))
+	ihdr, _ := createChunk(typeIHDR, make([]byte, 13))
+	idat, _ := createChunk(typeIDAT, make([]byte, 1<<16))
+	iend, _ := createChunk(typeIEND, nil)
+	file := slices.Concat(magic.PNGMagic, ihdr, idat, text, iend)
+
+	m, _ := NewPngMetaManager(bytes.NewReader(file))
+	got, err := m.Vendors()
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if want := []codec.MetaCodecVendor{"Comment"}; !slices.Equal(got, want) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+	if _, ok := m.image.(*io.SectionReader); !ok {
+		t.Errorf("image data buffered for listing the vendors")
+	}
+}
+
+func Test_PngMetaManager_UpsertAfterImageData(t *testing.T) {
+	c := PngVendorsCodec[codec.TinyMetaVendor]
+	encoded, _ := c.Codec.Encode(map[string]string{"artist": "a"})
+	text, _ := createTextChunk(c.Keyword, encoded, c.Compressed)
+	ihdr, _ := createChunk(typeIHDR, make([]byte, 13))
+	idat, _ := createChunk(typeIDAT, []byte{0x01})
+	iend, _ := createChunk(typeIEND, nil)
+
+	m, _ := NewPngMetaManager(bytes.NewReader(slices.Concat(magic.PNGMagic, ihdr, idat, text, iend)))
+	if err := m.Upsert(codec.TinyMetaVendor, map[string]string{"title": "t"}); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+
+	encoded, _ = c.Codec.Encode(map[string]string{"artist": "a", "title": "t"})
+	text, _ = createTextChunk(c.Keyword, encoded, c.Compressed)
+	data, _ := io.ReadAll(m.FileReader())
+	if want := slices.Concat(magic.PNGMagic, ihdr, idat, text, iend); !bytes.Equal(data, want) {
+		t.Errorf("want: %v\ngot: %v", want, data)
+	}
+}
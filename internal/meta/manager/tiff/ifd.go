@@ -0,0 +1,319 @@
+package tiff
+
+import (
+	"cmp"
+	"io"
+	"math"
+	"slices"
+)
+
+const (
+	headerSize = 8
+	entrySize  = 12
+	// the entries count and the next IFD offset around the entries
+	ifdOverhead = 2 + 4
+	valueSize   = 4
+)
+
+const (
+	typeByte      = 1
+	typeASCII     = 2
+	typeShort     = 3
+	typeLong      = 4
+	typeRational  = 5
+	typeSByte     = 6
+	typeUndefined = 7
+	typeSShort    = 8
+	typeSLong     = 9
+	typeSRational = 10
+	typeFloat     = 11
+	typeDouble    = 12
+	typeIFD       = 13
+)
+
+var typeSizes = map[uint16]uint64{
+	typeByte: 1, typeASCII: 1, typeShort: 2, typeLong: 4, typeRational: 8,
+	typeSByte: 1, typeUndefined: 1, typeSShort: 2, typeSLong: 4,
+	typeSRational: 8, typeFloat: 4, typeDouble: 8, typeIFD: 4,
+}
+
+const (
+	tagImageDescription = 270
+	tagSoftware         = 305
+	tagDateTime         = 306
+	tagArtist           = 315
+	tagHostComputer     = 316
+	tagXMP              = 700
+	tagCopyright        = 33432
+	tagIPTC             = 33723
+	tagPhotoshop        = 34377
+	tagExifIFD          = 34665
+	tagGPSIFD           = 34853
+	tagInteropIFD       = 40965
+
+	// privateTag starts the range of the tags registered by vendors
+	privateTag = 32768
+)
+
+// subIFDTags point to the IFDs whose entries are metadata as a whole.
+var subIFDTags = []uint16{tagExifIFD, tagGPSIFD, tagInteropIFD}
+
+// metadataTags are the tags not needed to render the image besides the
+// vendors ones.
+var metadataTags = []uint16{
+	tagImageDescription, tagSoftware, tagDateTime, tagArtist, tagHostComputer,
+	tagCopyright, tagIPTC, tagPhotoshop, tagExifIFD, tagGPSIFD,
+}
+
+type entry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value [valueSize]byte
+	// pending is the payload written on the next rebuild
+	pending []byte
+}
+
+// size returns the size of the value, false for an unknown type.
+func (e entry) size() (uint64, bool) {
+	typeSize, ok := typeSizes[e.typ]
+	return typeSize * uint64(e.count), ok
+}
+
+// readIFD reads the rest of the file and parses IFD0, the offsets being
+// relative to the start of the file.
+func (m *TiffMetaManager) readIFD() error {
+	if m.parsed {
+		return m.err
+	}
+
+	rest, err := io.ReadAll(m.r)
+	if err != nil {
+		return err
+	}
+	m.data = append(m.prefix, rest...)
+	m.parsed = true
+	m.err = m.parseIFD()
+	return m.err
+}
+
+func (m *TiffMetaManager) parseIFD() error {
+	m.ifdOffset = m.order.Uint32(m.prefix[4:])
+	if uint64(m.ifdOffset)+ifdOverhead > uint64(len(m.data)) || m.ifdOffset < headerSize {
+		return ErrCorruptedIFD
+	}
+
+	count := int(m.order.Uint16(m.data[m.ifdOffset:]))
+	m.ifdSize = ifdOverhead + count*entrySize
+	if int(m.ifdOffset)+m.ifdSize > len(m.data) {
+		return ErrCorruptedIFD
+	}
+
+	ifd := m.data[m.ifdOffset+2:]
+	for i := range count {
+		raw := ifd[i*entrySize:]
+		e := entry{
+			tag:   m.order.Uint16(raw),
+			typ:   m.order.Uint16(raw[2:]),
+			count: m.order.Uint32(raw[4:]),
+		}
+		copy(e.value[:], raw[8:entrySize])
+		m.entries = append(m.entries, e)
+	}
+	m.next = m.order.Uint32(ifd[count*entrySize:])
+	return nil
+}
+
+func (m *TiffMetaManager) findEntry(tag uint16) (int, error) {
+	if err := m.readIFD(); err != nil {
+		return 0, err
+	}
+
+	i := slices.IndexFunc(m.entries, func(e entry) bool { return e.tag == tag })
+	if i < 0 {
+		return 0, ErrTagNotFound
+	}
+	return i, nil
+}
+
+// payload returns the bytes of an entry of a single byte type.
+func (m *TiffMetaManager) payload(e entry) ([]byte, error) {
+	switch e.typ {
+	case typeByte, typeASCII, typeSByte, typeUndefined:
+	default:
+		return nil, ErrCorruptedIFD
+	}
+
+	if e.count <= valueSize {
+		return e.value[:e.count], nil
+	}
+	offset := uint64(m.order.Uint32(e.value[:]))
+	if offset+uint64(e.count) > uint64(len(m.data)) {
+		return nil, ErrCorruptedIFD
+	}
+	return m.data[offset : offset+uint64(e.count)], nil
+}
+
+// setEntry replaces or adds the entry of the tag, keeping them sorted.
+// A replaced entry keeps its type, XMP is BYTE as its spec requires.
+func (m *TiffMetaManager) setEntry(tag uint16, data []byte) error {
+	if len(data) > math.MaxUint32 {
+		return ErrDataSizeTooLarge
+	}
+
+	e := entry{tag: tag, typ: typeUndefined, count: uint32(len(data)), pending: data}
+	if tag == tagXMP {
+		e.typ = typeByte
+	}
+	i, found := slices.BinarySearchFunc(m.entries, tag, func(e entry, tag uint16) int { return cmp.Compare(e.tag, tag) })
+	if found {
+		removed := m.entries[i]
+		if _, err := m.payload(removed); err == nil {
+			e.typ = removed.typ
+		}
+		m.entries[i] = e
+		return m.rebuild(removed)
+	}
+	m.entries = slices.Insert(m.entries, i, e)
+	return m.rebuild()
+}
+
+// removeEntries removes the entries of the tags, if any.
+func (m *TiffMetaManager) removeEntries(tags ...uint16) error {
+	var removed []entry
+	m.entries = slices.DeleteFunc(m.entries, func(e entry) bool {
+		if slices.Contains(tags, e.tag) {
+			removed = append(removed, e)
+			return true
+		}
+		return false
+	})
+	if len(removed) == 0 {
+		return nil
+	}
+	return m.rebuild(removed...)
+}
+
+// rebuild appends the pending payloads and a new IFD0 to the file, so
+// the strips and tiles never move. The previous IFD0 and the removed
+// payloads are dropped when they're at the end of the file, as after an
+// earlier rebuild, so repeated updates don't grow the file. They're
+// zero-filled otherwise, with the previous IFD0 holding the removed entries,
+// so removed metadata can't be read in the file.
+func (m *TiffMetaManager) rebuild(removed ...entry) error {
+	seen := make(map[uint32]bool)
+	for _, e := range removed {
+		m.erase(e, seen)
+	}
+	if len(removed) > 0 {
+		m.clear(uint64(m.ifdOffset), uint64(m.ifdSize))
+	}
+
+	end := len(m.data)
+	if int(m.ifdOffset)+m.ifdSize == end {
+		end = int(m.ifdOffset)
+	}
+	slices.SortFunc(removed, func(a, b entry) int {
+		return cmp.Compare(m.order.Uint32(b.value[:]), m.order.Uint32(a.value[:]))
+	})
+	for _, e := range removed {
+		size, ok := e.size()
+		if !ok || size <= valueSize {
+			continue
+		}
+		offset := int(m.order.Uint32(e.value[:]))
+		if tail := uint64(offset) + size; tail == uint64(end) || uint64(pad(int(tail))) == uint64(end) {
+			end = offset
+		}
+	}
+
+	data := m.data[:end:end]
+	for i := range m.entries {
+		e := &m.entries[i]
+		if e.pending == nil {
+			continue
+		}
+		if len(e.pending) <= valueSize {
+			e.value = [valueSize]byte{}
+			copy(e.value[:], e.pending)
+		} else {
+			data = append(data, make([]byte, pad(len(data))-len(data))...)
+			m.order.PutUint32(e.value[:], uint32(len(data)))
+			data = append(data, e.pending...)
+		}
+		e.pending = nil
+	}
+
+	data = append(data, make([]byte, pad(len(data))-len(data))...)
+	ifdOffset := len(data)
+	data = m.order.AppendUint16(data, uint16(len(m.entries)))
+	for _, e := range m.entries {
+		data = m.order.AppendUint16(data, e.tag)
+		data = m.order.AppendUint16(data, e.typ)
+		data = m.order.AppendUint32(data, e.count)
+		data = append(data, e.value[:]...)
+	}
+	data = m.order.AppendUint32(data, m.next)
+	if len(data) > math.MaxUint32 {
+		return ErrDataSizeTooLarge
+	}
+	m.order.PutUint32(data[4:], uint32(ifdOffset))
+
+	m.data = data
+	m.ifdOffset = uint32(ifdOffset)
+	m.ifdSize = ifdOverhead + len(m.entries)*entrySize
+	return nil
+}
+
+// erase zero-fills the value of the removed entry stored out of the IFD,
+// and the sub-IFD it points to with their values.
+func (m *TiffMetaManager) erase(e entry, seen map[uint32]bool) {
+	size, ok := e.size()
+	if !ok {
+		return
+	}
+	if size > valueSize {
+		m.clear(uint64(m.order.Uint32(e.value[:])), size)
+		return
+	}
+	if size == valueSize && slices.Contains(subIFDTags, e.tag) {
+		m.eraseIFD(m.order.Uint32(e.value[:]), seen)
+	}
+}
+
+func (m *TiffMetaManager) eraseIFD(offset uint32, seen map[uint32]bool) {
+	if seen[offset] || uint64(offset)+2 > uint64(len(m.data)) {
+		return
+	}
+	seen[offset] = true
+
+	count := uint64(m.order.Uint16(m.data[offset:]))
+	size := ifdOverhead + count*entrySize
+	if uint64(offset)+size > uint64(len(m.data)) {
+		return
+	}
+	for i := range count {
+		raw := m.data[uint64(offset)+2+i*entrySize:]
+		e := entry{
+			tag:   m.order.Uint16(raw),
+			typ:   m.order.Uint16(raw[2:]),
+			count: m.order.Uint32(raw[4:]),
+		}
+		copy(e.value[:], raw[8:entrySize])
+		m.erase(e, seen)
+	}
+	m.clear(uint64(offset), size)
+}
+
+// clear zero-fills the range of the file, the header is never cleared.
+func (m *TiffMetaManager) clear(offset, size uint64) {
+	if offset < headerSize || offset+size > uint64(len(m.data)) {
+		return
+	}
+	clear(m.data[offset : offset+size])
+}
+
+// pad rounds the offset up to a word boundary.
+func pad(offset int) int {
+	return offset + offset&1
+}
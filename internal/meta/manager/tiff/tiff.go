@@ -0,0 +1,281 @@
+package tiff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/zzvanq/tinymedia/internal/file/magic"
+	"github.com/zzvanq/tinymedia/pkg/meta"
+	"github.com/zzvanq/tinymedia/pkg/meta/codec"
+	"github.com/zzvanq/tinymedia/pkg/meta/codec/tinymeta"
+	"github.com/zzvanq/tinymedia/pkg/meta/codec/xmp"
+)
+
+var (
+	ErrVendorNotSupported  = meta.ErrVendorNotSupported
+	ErrTagNotFound         = fmt.Errorf("tag %w", meta.ErrNotFound)
+	ErrDataSizeTooLarge    = errors.New("data size too large")
+	ErrCorruptedIFD        = fmt.Errorf("%w ifd", meta.ErrCorrupted)
+	ErrInvalidSignature    = fmt.Errorf("%w tiff signature", meta.ErrInvalid)
+	ErrBigTIFFNotSupported = fmt.Errorf("bigtiff %w", meta.ErrNotSupported)
+)
+
+// Tag is the IFD0 tag the payload is stored in, the tinymeta ones are in
+// the reusable private range.
+type CodecVendor struct {
+	Codec codec.Codec
+	Tag   uint16
+}
+
+var TiffVendorsCodec = map[codec.MetaCodecVendor]CodecVendor{
+	codec.TinyMetaVendor:     {tinymeta.TinyMeta, 65000},
+	codec.TinyMetaGzipVendor: {tinymeta.TinyMetaGzip, 65001},
+	codec.XMPVendor:          {xmp.XMP, tagXMP},
+}
+
+const (
+	versionTIFF    = 42
+	versionBigTIFF = 43
+)
+
+type byteOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+// TiffMetaManager reads the whole file on the first access, since the IFD
+// entries point anywhere in it and IFD0 usually follows the image data.
+// The memory used grows with the file, reads included, as the reader
+// can't be seeked.
+type TiffMetaManager struct {
+	prefix    []byte
+	r         io.Reader
+	order     byteOrder
+	data      []byte
+	ifdOffset uint32
+	ifdSize   int
+	entries   []entry
+	next      uint32
+	parsed    bool
+	err       error
+}
+
+func NewTiffMetaManager(r io.Reader) (*TiffMetaManager, error) {
+	prefix := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, fmt.Errorf("failed to read the magic bytes")
+	}
+
+	var order byteOrder
+	switch {
+	case bytes.HasPrefix(prefix, magic.TIFFLEMagic[:2]):
+		order = binary.LittleEndian
+	case bytes.HasPrefix(prefix, magic.TIFFBEMagic[:2]):
+		order = binary.BigEndian
+	default:
+		return nil, ErrInvalidSignature
+	}
+
+	switch order.Uint16(prefix[2:]) {
+	case versionTIFF:
+	case versionBigTIFF:
+		return nil, ErrBigTIFFNotSupported
+	default:
+		return nil, ErrInvalidSignature
+	}
+
+	return &TiffMetaManager{
+		prefix: prefix,
+		r:      r,
+		order:  order,
+	}, nil
+}
+
+// Insert sets the tag of the vendor, as IFD tags can't be repeated.
+func (m *TiffMetaManager) Insert(vendor codec.MetaCodecVendor, fields map[string]string) error {
+	c, ok := TiffVendorsCodec[vendor]
+	if !ok {
+		return ErrVendorNotSupported
+	}
+
+	encoded, err := c.Codec.Encode(fields)
+	if err != nil {
+		return err
+	}
+
+	if err := m.readIFD(); err != nil {
+		return err
+	}
+	return m.setEntry(c.Tag, encoded)
+}
+
+func (m *TiffMetaManager) Upsert(vendor codec.MetaCodecVendor, fields map[string]string) error {
+	c, ok := TiffVendorsCodec[vendor]
+	if !ok {
+		return ErrVendorNotSupported
+	}
+	return m.UpsertPayload(vendor, func(data []byte) ([]byte, error) {
+		return codec.Update(c.Codec, data, fields)
+	})
+}
+
+// UpsertPayload replaces the payload of the vendor with the one update
+// returns for it, given nil when there's none.
+func (m *TiffMetaManager) UpsertPayload(vendor codec.MetaCodecVendor, update func(data []byte) ([]byte, error)) error {
+	c, ok := TiffVendorsCodec[vendor]
+	if !ok {
+		return ErrVendorNotSupported
+	}
+
+	data, err := m.Payload(vendor)
+	if err != nil && err != ErrTagNotFound {
+		return err
+	}
+	encoded, err := update(data)
+	if err != nil {
+		return err
+	}
+	return m.setEntry(c.Tag, encoded)
+}
+
+func (m *TiffMetaManager) Extract(vendor codec.MetaCodecVendor, fields ...string) (map[string]string, error) {
+	decoded, err := m.Fields(vendor)
+	if err != nil {
+		return nil, err
+	}
+
+	return codec.Extract(TiffVendorsCodec[vendor].Codec, decoded, fields...), nil
+}
+
+func (m *TiffMetaManager) Fields(vendor codec.MetaCodecVendor) (map[string]string, error) {
+	c, ok := TiffVendorsCodec[vendor]
+	if !ok {
+		return nil, ErrVendorNotSupported
+	}
+
+	data, err := m.Payload(vendor)
+	if err != nil {
+		return nil, err
+	}
+	return c.Codec.Decode(data)
+}
+
+// Payload returns the encoded payload of the vendor.
+func (m *TiffMetaManager) Payload(vendor codec.MetaCodecVendor) ([]byte, error) {
+	c, ok := TiffVendorsCodec[vendor]
+	if !ok {
+		return nil, ErrVendorNotSupported
+	}
+
+	i, err := m.findEntry(c.Tag)
+	if err != nil {
+		return nil, err
+	}
+	return m.payload(m.entries[i])
+}
+
+func (m *TiffMetaManager) Vendors() ([]codec.MetaCodecVendor, error) {
+	if err := m.readIFD(); err != nil {
+		return nil, err
+	}
+
+	var vendors []codec.MetaCodecVendor
+	for _, e := range m.entries {
+		vendor, ok := tagVendor(e.tag)
+		if ok || e.tag >= privateTag {
+			vendors = append(vendors, vendor)
+		}
+	}
+	return vendors, nil
+}
+
+// tagVendor returns the vendor stored in the tag, the hex tag when it's
+// not a known one.
+func tagVendor(tag uint16) (codec.MetaCodecVendor, bool) {
+	for vendor, c := range TiffVendorsCodec {
+		if c.Tag == tag {
+			return vendor, true
+		}
+	}
+	return codec.MetaCodecVendor(fmt.Sprintf("0x%04X", tag)), false
+}
+
+// vendorTag returns the tag the vendor is stored in, either a known one or
+// a hex private tag as listed by Vendors.
+func vendorTag(vendor codec.MetaCodecVendor) (uint16, bool) {
+	if c, ok := TiffVendorsCodec[vendor]; ok {
+		return c.Tag, true
+	}
+	var tag uint16
+	if _, err := fmt.Sscanf(string(vendor), "0x%04X", &tag); err != nil || tag < privateTag {
+		return 0, false
+	}
+	_, known := tagVendor(tag)
+	return tag, !known
+}
+
+func (m *TiffMetaManager) Delete(vendor codec.MetaCodecVendor, fields ...string) error {
+	c, ok := TiffVendorsCodec[vendor]
+	if !ok {
+		return ErrVendorNotSupported
+	}
+
+	i, err := m.findEntry(c.Tag)
+	if err != nil {
+		return err
+	}
+
+	data, err := m.payload(m.entries[i])
+	if err != nil {
+		return err
+	}
+	updated, err := codec.Delete(c.Codec, data, fields...)
+	if err != nil {
+		return err
+	}
+	if updated == nil {
+		return m.removeEntries(c.Tag)
+	}
+	return m.setEntry(c.Tag, updated)
+}
+
+func (m *TiffMetaManager) Strip(vendors ...codec.MetaCodecVendor) error {
+	tags := make([]uint16, 0, len(vendors))
+	for _, vendor := range vendors {
+		tag, ok := vendorTag(vendor)
+		if !ok {
+			return ErrVendorNotSupported
+		}
+		tags = append(tags, tag)
+	}
+
+	if err := m.readIFD(); err != nil {
+		return err
+	}
+	return m.removeEntries(tags...)
+}
+
+// StripAll removes the vendors tags and the descriptive ones of IFD0,
+// including the Exif and GPS IFD pointers.
+func (m *TiffMetaManager) StripAll() error {
+	if err := m.readIFD(); err != nil {
+		return err
+	}
+
+	tags := slices.Clone(metadataTags)
+	for _, c := range TiffVendorsCodec {
+		tags = append(tags, c.Tag)
+	}
+	return m.removeEntries(tags...)
+}
+
+func (m *TiffMetaManager) FileReader() io.Reader {
+	if !m.parsed {
+		return io.MultiReader(bytes.NewReader(m.prefix), m.r)
+	}
+	return bytes.NewReader(m.data)
+}
@@ -0,0 +1,280 @@
+package tiff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/zzvanq/tinymedia/pkg/meta/codec"
+)
+
+const (
+	tagStripOffsets = 273
+	// stripOffset is right after the header and the 5 entries IFD0
+	stripOffset = headerSize + ifdOverhead + 5*entrySize
+)
+
+var strip = []byte{0xAB, 0xCD}
+
+// testTIFF returns a 1x1 image with a single strip and an Artist tag.
+func testTIFF(order byteOrder) []byte {
+	data := []byte("II*\x00")
+	if order == binary.BigEndian {
+		data = []byte("MM\x00*")
+	}
+	data = order.AppendUint32(data, headerSize)
+	data = order.AppendUint16(data, 5)
+	for _, e := range []struct {
+		tag, typ uint16
+		value    []byte
+	}{
+		{256, 3, order.AppendUint16(nil, 1)},
+		{257, 3, order.AppendUint16(nil, 1)},
+		{tagStripOffsets, 4, order.AppendUint32(nil, stripOffset)},
+		{279, 4, order.AppendUint32(nil, uint32(len(strip)))},
+		{tagArtist, typeASCII, []byte("ab\x00")},
+	} {
+		data = order.AppendUint16(data, e.tag)
+		data = order.AppendUint16(data, e.typ)
+		data = order.AppendUint32(data, 1)
+		data = append(data, e.value...)
+		data = append(data, make([]byte, valueSize-len(e.value))...)
+	}
+	data = order.AppendUint32(data, 0)
+	return append(data, strip...)
+}
+
+func Test_NewTiffMetaManager(t *testing.T) {
+	if _, err := NewTiffMetaManager(bytes.NewReader([]byte("II+\x00\x08\x00\x00\x00"))); err != ErrBigTIFFNotSupported {
+		t.Errorf("want error: %v, got: %v", ErrBigTIFFNotSupported, err)
+	}
+	if _, err := NewTiffMetaManager(bytes.NewReader([]byte("IM*\x00\x08\x00\x00\x00"))); err != ErrInvalidSignature {
+		t.Errorf("want error: %v, got: %v", ErrInvalidSignature, err)
+	}
+}
+
+func Test_TiffMetaManager_UpsertExtract(t *testing.T) {
+	tests := []struct {
+		name     string
+		order    byteOrder
+		vendor   codec.MetaCodecVendor
+		field    string
+		wantType uint16
+	}{
+		{name: "tinymeta little endian", order: binary.LittleEndian, vendor: codec.TinyMetaVendor, field: "artist", wantType: typeUndefined},
+		{name: "tinymeta big endian", order: binary.BigEndian, vendor: codec.TinyMetaVendor, field: "artist", wantType: typeUndefined},
+		{name: "tinymetagzip", order: binary.LittleEndian, vendor: codec.TinyMetaGzipVendor, field: "artist", wantType: typeUndefined},
+		{name: "xmp", order: binary.BigEndian, vendor: codec.XMPVendor, field: "dc:creator", wantType: typeByte},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewTiffMetaManager(bytes.NewReader(testTIFF(tt.order)))
+			if err != nil {
+				t.Fatalf("want error: %v, got: %v", nil, err)
+			}
+			if err := m.Upsert(tt.vendor, map[string]string{tt.field: "a"}); err != nil {
+				t.Fatalf("want error: %v, got: %v", nil, err)
+			}
+
+			first, _ := io.ReadAll(m.FileReader())
+			m, _ = NewTiffMetaManager(bytes.NewReader(first))
+			if err := m.Upsert(tt.vendor, map[string]string{tt.field: "b"}); err != nil {
+				t.Fatalf("want error: %v, got: %v", nil, err)
+			}
+
+			data, _ := io.ReadAll(m.FileReader())
+			if len(data) != len(first) {
+				t.Errorf("want size: %d, got: %d", len(first), len(data))
+			}
+			if !bytes.Equal(data[stripOffset:stripOffset+len(strip)], strip) {
+				t.Errorf("strip moved: %v", data)
+			}
+
+			m, _ = NewTiffMetaManager(bytes.NewReader(data))
+			got, err := m.Extract(tt.vendor, tt.field)
+			if err != nil {
+				t.Fatalf("want error: %v, got: %v", nil, err)
+			}
+			if want := map[string]string{tt.field: "b"}; !maps.Equal(got, want) {
+				t.Errorf("want: %v, got: %v", want, got)
+			}
+			i, _ := m.findEntry(tagStripOffsets)
+			if offset := m.order.Uint32(m.entries[i].value[:]); offset != stripOffset {
+				t.Errorf("want strip offset: %d, got: %d", stripOffset, offset)
+			}
+			if !slices.IsSortedFunc(m.entries, func(a, b entry) int { return int(a.tag) - int(b.tag) }) {
+				t.Errorf("entries not sorted: %v", m.entries)
+			}
+			i, _ = m.findEntry(TiffVendorsCodec[tt.vendor].Tag)
+			if typ := m.entries[i].typ; typ != tt.wantType {
+				t.Errorf("want type: %d, got: %d", tt.wantType, typ)
+			}
+		})
+	}
+}
+
+func Test_TiffMetaManager_UpsertKeepsType(t *testing.T) {
+	m, _ := NewTiffMetaManager(bytes.NewReader(testTIFF(binary.LittleEndian)))
+	m.Upsert(codec.XMPVendor, map[string]string{"dc:creator": "a"})
+	// written as UNDEFINED by another tool
+	i, _ := m.findEntry(tagXMP)
+	m.entries[i].typ = typeUndefined
+
+	if err := m.Upsert(codec.XMPVendor, map[string]string{"dc:creator": "b"}); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	i, _ = m.findEntry(tagXMP)
+	if typ := m.entries[i].typ; typ != typeUndefined {
+		t.Errorf("want type: %d, got: %d", typeUndefined, typ)
+	}
+}
+
+func Test_TiffMetaManager_Delete(t *testing.T) {
+	m, _ := NewTiffMetaManager(bytes.NewReader(testTIFF(binary.LittleEndian)))
+	m.Upsert(codec.TinyMetaVendor, map[string]string{"artist": "a", "title": "t"})
+
+	if err := m.Delete(codec.TinyMetaVendor, "artist"); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	got, _ := m.Fields(codec.TinyMetaVendor)
+	if want := map[string]string{"title": "t"}; !maps.Equal(got, want) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+
+	if err := m.Delete(codec.TinyMetaVendor, "title"); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if _, err := m.Fields(codec.TinyMetaVendor); err != ErrTagNotFound {
+		t.Errorf("want error: %v, got: %v", ErrTagNotFound, err)
+	}
+}
+
+func Test_TiffMetaManager_StripVendors(t *testing.T) {
+	m, _ := NewTiffMetaManager(bytes.NewReader(testTIFF(binary.LittleEndian)))
+	m.Upsert(codec.TinyMetaVendor, map[string]string{"artist": "a"})
+	m.Upsert(codec.XMPVendor, map[string]string{"dc:title": "t"})
+
+	vendors, err := m.Vendors()
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	want := []codec.MetaCodecVendor{codec.XMPVendor, codec.TinyMetaVendor}
+	if !slices.Equal(vendors, want) {
+		t.Errorf("want: %v, got: %v", want, vendors)
+	}
+
+	if err := m.Strip(codec.XMPVendor); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if err := m.StripAll(); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if len(m.entries) != 4 {
+		t.Errorf("want the 4 image entries, got: %v", m.entries)
+	}
+	data, _ := io.ReadAll(m.FileReader())
+	if !bytes.Equal(data[stripOffset:stripOffset+len(strip)], strip) {
+		t.Errorf("strip moved: %v", data)
+	}
+}
+
+func Test_TiffMetaManager_Corrupted(t *testing.T) {
+	file := testTIFF(binary.LittleEndian)
+	m, _ := NewTiffMetaManager(bytes.NewReader(file[:stripOffset-8]))
+	if _, err := m.Fields(codec.TinyMetaVendor); err != ErrCorruptedIFD {
+		t.Errorf("want error: %v, got: %v", ErrCorruptedIFD, err)
+	}
+}
+
+func Test_TiffMetaManager_VendorsPrivate(t *testing.T) {
+	m, _ := NewTiffMetaManager(bytes.NewReader(testTIFF(binary.LittleEndian)))
+	if err := m.setEntry(0xC612, []byte("dng-version")); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+
+	vendors, err := m.Vendors()
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	want := []codec.MetaCodecVendor{"0xC612"}
+	if !slices.Equal(vendors, want) {
+		t.Errorf("want: %v, got: %v", want, vendors)
+	}
+
+	if err := m.Strip("0xC612"); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if len(m.entries) != 5 {
+		t.Errorf("want the 5 entries, got: %v", m.entries)
+	}
+	if err := m.Strip("0x0100"); err != ErrVendorNotSupported {
+		t.Errorf("want error: %v, got: %v", ErrVendorNotSupported, err)
+	}
+}
+
+func Test_TiffMetaManager_StripZeroFills(t *testing.T) {
+	order := binary.LittleEndian
+	m, _ := NewTiffMetaManager(bytes.NewReader(testTIFF(order)))
+	if err := m.readIFD(); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+
+	// an Exif IFD with an out of IFD ASCII value, followed by the IFD0
+	// payloads, so none of them is at the end of the file
+	exifOffset := uint32(len(m.data))
+	exif := order.AppendUint16(nil, 1)
+	exif = order.AppendUint16(exif, 0x9286)
+	exif = order.AppendUint16(exif, typeASCII)
+	exif = order.AppendUint32(exif, 8)
+	exif = order.AppendUint32(exif, exifOffset+ifdOverhead+entrySize)
+	exif = order.AppendUint32(exif, 0)
+	exif = append(exif, "comment\x00"...)
+	m.data = append(m.data, exif...)
+	m.entries = append(m.entries, entry{tag: tagExifIFD, typ: typeLong, count: 1, value: [4]byte(order.AppendUint32(nil, exifOffset))})
+
+	if err := m.Upsert(codec.XMPVendor, map[string]string{"dc:title": "title"}); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if err := m.Upsert(codec.TinyMetaVendor, map[string]string{"artist": "artist"}); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if err := m.StripAll(); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+
+	data, _ := io.ReadAll(m.FileReader())
+	for _, s := range []string{"comment", "title", "artist"} {
+		if bytes.Contains(data, []byte(s)) {
+			t.Errorf("want %q zero-filled, got: %q", s, data)
+		}
+	}
+	if !bytes.Equal(data[stripOffset:stripOffset+len(strip)], strip) {
+		t.Errorf("strip moved: %v", data)
+	}
+}
+
+func Test_TiffMetaManager_StripTypedPayload(t *testing.T) {
+	order := binary.LittleEndian
+	want, _ := NewTiffMetaManager(bytes.NewReader(testTIFF(order)))
+	want.StripAll()
+	wantData, _ := io.ReadAll(want.FileReader())
+
+	// a LONG IPTC payload is 4 bytes per count, dropped as it ends the file
+	m, _ := NewTiffMetaManager(bytes.NewReader(testTIFF(order)))
+	m.readIFD()
+	m.entries = append(m.entries, entry{tag: tagIPTC, typ: typeLong, count: 2, pending: make([]byte, 8)})
+	if err := m.rebuild(); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if err := m.StripAll(); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	data, _ := io.ReadAll(m.FileReader())
+	if len(data) != len(wantData) {
+		t.Errorf("want size: %d, got: %d", len(wantData), len(data))
+	}
+}
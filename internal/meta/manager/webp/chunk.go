@@ -0,0 +1,180 @@
+package webp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"slices"
+
+	"github.com/zzvanq/tinymedia/pkg/meta/codec"
+)
+
+const (
+	fourCCSize  = 4
+	sizeSize    = 4
+	headerSize  = fourCCSize + sizeSize
+	dataMaxSize = 1<<32 - 2
+	// vp8xSize is the size of the VP8X chunk data
+	vp8xSize = 10
+)
+
+const (
+	typeVP8X = "VP8X"
+	typeVP8  = "VP8 "
+	typeVP8L = "VP8L"
+	typeALPH = "ALPH"
+	typeANIM = "ANIM"
+	typeANMF = "ANMF"
+	typeICCP = "ICCP"
+	typeEXIF = "EXIF"
+	typeXMP  = "XMP "
+)
+
+// VP8X flags
+const (
+	flagXMP   = 0x04
+	flagEXIF  = 0x08
+	flagAlpha = 0x10
+	flagICC   = 0x20
+)
+
+// renderingChunks are the chunks needed to render the image.
+var renderingChunks = []string{typeVP8X, typeVP8, typeVP8L, typeALPH, typeANIM, typeANMF, typeICCP}
+
+// readChunks parses the rest of the file, the error is kept for the later
+// calls since the reader is consumed.
+func (m *WebpMetaManager) readChunks() error {
+	if m.parsed {
+		return m.err
+	}
+	m.parsed = true
+
+	for {
+		chunk, err := m.nextChunk()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			m.err = err
+			return err
+		}
+		m.chunks = append(m.chunks, chunk)
+	}
+
+	if len(m.chunks) == 0 {
+		m.err = ErrCorruptedChunk
+	}
+	return m.err
+}
+
+// nextChunk returns the next chunk with its padding byte, io.EOF at the end.
+func (m *WebpMetaManager) nextChunk() ([]byte, error) {
+	header := make([]byte, headerSize)
+	if n, err := io.ReadFull(m.r, header); err != nil {
+		if n == 0 && err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, ErrCorruptedChunk
+	}
+
+	size := binary.LittleEndian.Uint32(header[fourCCSize:])
+	if size > dataMaxSize {
+		return nil, ErrCorruptedChunk
+	}
+	chunk := make([]byte, headerSize+int(size)+int(size&1))
+	copy(chunk, header)
+	if n, err := io.ReadFull(m.r, chunk[headerSize:]); err != nil {
+		// writers often leave the padding of the last chunk out
+		if err != io.ErrUnexpectedEOF || n != int(size) || size&1 == 0 {
+			return nil, ErrCorruptedChunk
+		}
+	}
+	return chunk, nil
+}
+
+func (m *WebpMetaManager) findChunk(fourCC string) (int, error) {
+	if err := m.readChunks(); err != nil {
+		return 0, err
+	}
+
+	i := slices.IndexFunc(m.chunks, func(chunk []byte) bool { return chunkType(chunk) == fourCC })
+	if i < 0 {
+		return 0, ErrChunkNotFound
+	}
+	return i, nil
+}
+
+func createChunk(fourCC string, data []byte) ([]byte, error) {
+	if len(data) > dataMaxSize {
+		return nil, ErrDataSizeTooLarge
+	}
+
+	chunk := make([]byte, headerSize+len(data)+len(data)&1)
+	copy(chunk, fourCC)
+	binary.LittleEndian.PutUint32(chunk[fourCCSize:], uint32(len(data)))
+	copy(chunk[headerSize:], data)
+	return chunk, nil
+}
+
+func chunkType(chunk []byte) string {
+	return string(chunk[:fourCCSize])
+}
+
+// chunkData returns the data without the padding byte.
+func chunkData(chunk []byte) []byte {
+	size := binary.LittleEndian.Uint32(chunk[fourCCSize:headerSize])
+	return chunk[headerSize : headerSize+int(size)]
+}
+
+func chunkVendor(chunk []byte) (codec.MetaCodecVendor, bool) {
+	cType := chunkType(chunk)
+	if slices.Contains(renderingChunks, cType) {
+		return "", false
+	}
+	for vendor, c := range WebpVendorsCodec {
+		if c.FourCC == cType {
+			return vendor, true
+		}
+	}
+	return codec.MetaCodecVendor(bytes.TrimRight([]byte(cType), " ")), true
+}
+
+// canvas returns the size of the image and whether it has alpha from the
+// VP8 or VP8L chunk of a simple file.
+func canvas(chunk []byte) (width, height int, alpha bool, err error) {
+	data := chunkData(chunk)
+	switch chunkType(chunk) {
+	case typeVP8:
+		// frame tag, start code, then 14 bits of width and height
+		if len(data) < 10 || !bytes.Equal(data[3:6], []byte{0x9D, 0x01, 0x2A}) {
+			return 0, 0, false, ErrCorruptedChunk
+		}
+		width = int(binary.LittleEndian.Uint16(data[6:]) & 0x3FFF)
+		height = int(binary.LittleEndian.Uint16(data[8:]) & 0x3FFF)
+		return width, height, false, nil
+	case typeVP8L:
+		// signature, then 14 bits of width - 1, height - 1 and the alpha hint
+		if len(data) < 5 || data[0] != 0x2F {
+			return 0, 0, false, ErrCorruptedChunk
+		}
+		bits := binary.LittleEndian.Uint32(data[1:])
+		width = int(bits&0x3FFF) + 1
+		height = int(bits>>14&0x3FFF) + 1
+		return width, height, bits>>28&1 == 1, nil
+	}
+	return 0, 0, false, ErrCorruptedChunk
+}
+
+func createVP8X(flags byte, width, height int) ([]byte, error) {
+	data := make([]byte, vp8xSize)
+	data[0] = flags
+	putUint24(data[4:], uint32(width-1))
+	putUint24(data[7:], uint32(height-1))
+	return createChunk(typeVP8X, data)
+}
+
+func putUint24(b []byte, v uint32) {
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v >> 16)
+}
@@ -0,0 +1,316 @@
+package webp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/zzvanq/tinymedia/internal/file/magic"
+	"github.com/zzvanq/tinymedia/pkg/meta"
+	"github.com/zzvanq/tinymedia/pkg/meta/codec"
+	"github.com/zzvanq/tinymedia/pkg/meta/codec/exif"
+	"github.com/zzvanq/tinymedia/pkg/meta/codec/tinymeta"
+	"github.com/zzvanq/tinymedia/pkg/meta/codec/xmp"
+)
+
+var (
+	ErrVendorNotSupported = meta.ErrVendorNotSupported
+	ErrChunkNotFound      = fmt.Errorf("chunk %w", meta.ErrNotFound)
+	ErrDataSizeTooLarge   = errors.New("data size too large")
+	ErrCorruptedChunk     = fmt.Errorf("%w chunk", meta.ErrCorrupted)
+	ErrInvalidSignature   = fmt.Errorf("%w webp signature", meta.ErrInvalid)
+)
+
+type CodecVendor struct {
+	Codec  codec.Codec
+	FourCC string
+}
+
+var WebpVendorsCodec = map[codec.MetaCodecVendor]CodecVendor{
+	codec.TinyMetaVendor:     {tinymeta.TinyMeta, "TMTA"},
+	codec.TinyMetaGzipVendor: {tinymeta.TinyMetaGzip, "TMGZ"},
+	codec.ExifVendor:         {exif.Exif, typeEXIF},
+	codec.XMPVendor:          {xmp.XMP, typeXMP},
+}
+
+// exifHeader is written before the TIFF data by some tools.
+var exifHeader = []byte("Exif\x00\x00")
+
+// WebpMetaManager parses all the chunks on the first access, since the
+// metadata chunks follow the image data. The RIFF size is recomputed
+// when the file is written.
+type WebpMetaManager struct {
+	prefix []byte
+	r      io.Reader
+	chunks [][]byte
+	parsed bool
+	err    error
+}
+
+func NewWebpMetaManager(r io.Reader) (*WebpMetaManager, error) {
+	prefix := make([]byte, len(magic.RIFFMagic)+sizeSize+len(magic.WEBPMagic))
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, fmt.Errorf("failed to read the magic bytes")
+	}
+
+	if !bytes.HasPrefix(prefix, magic.RIFFMagic) || !bytes.Equal(prefix[8:], magic.WEBPMagic) {
+		return nil, ErrInvalidSignature
+	}
+
+	return &WebpMetaManager{
+		prefix: prefix,
+		r:      r,
+		chunks: [][]byte{},
+	}, nil
+}
+
+func (m *WebpMetaManager) Insert(vendor codec.MetaCodecVendor, fields map[string]string) error {
+	c, ok := WebpVendorsCodec[vendor]
+	if !ok {
+		return ErrVendorNotSupported
+	}
+
+	encoded, err := c.Codec.Encode(fields)
+	if err != nil {
+		return err
+	}
+	return m.insert(c, encoded)
+}
+
+func (m *WebpMetaManager) insert(c CodecVendor, encoded []byte) error {
+	chunk, err := createChunk(c.FourCC, encoded)
+	if err != nil {
+		return err
+	}
+
+	if err := m.readChunks(); err != nil {
+		return err
+	}
+	m.chunks = append(m.chunks, chunk)
+	return m.updateVP8X()
+}
+
+func (m *WebpMetaManager) Upsert(vendor codec.MetaCodecVendor, fields map[string]string) error {
+	c, ok := WebpVendorsCodec[vendor]
+	if !ok {
+		return ErrVendorNotSupported
+	}
+	return m.UpsertPayload(vendor, func(data []byte) ([]byte, error) {
+		return codec.Update(c.Codec, data, fields)
+	})
+}
+
+// UpsertPayload replaces the payload of the vendor with the one update
+// returns for it, given nil when there's none.
+func (m *WebpMetaManager) UpsertPayload(vendor codec.MetaCodecVendor, update func(data []byte) ([]byte, error)) error {
+	c, ok := WebpVendorsCodec[vendor]
+	if !ok {
+		return ErrVendorNotSupported
+	}
+
+	i, err := m.findChunk(c.FourCC)
+	if err != nil {
+		if err == ErrChunkNotFound {
+			encoded, err := update(nil)
+			if err != nil {
+				return err
+			}
+			return m.insert(c, encoded)
+		}
+		return err
+	}
+
+	encoded, err := update(c.payload(m.chunks[i]))
+	if err != nil {
+		return err
+	}
+
+	chunk, err := createChunk(c.FourCC, encoded)
+	if err != nil {
+		return err
+	}
+	m.chunks[i] = chunk
+	return m.updateVP8X()
+}
+
+func (m *WebpMetaManager) Extract(vendor codec.MetaCodecVendor, fields ...string) (map[string]string, error) {
+	decoded, err := m.Fields(vendor)
+	if err != nil {
+		return nil, err
+	}
+
+	return codec.Extract(WebpVendorsCodec[vendor].Codec, decoded, fields...), nil
+}
+
+func (m *WebpMetaManager) Fields(vendor codec.MetaCodecVendor) (map[string]string, error) {
+	c, ok := WebpVendorsCodec[vendor]
+	if !ok {
+		return nil, ErrVendorNotSupported
+	}
+
+	data, err := m.Payload(vendor)
+	if err != nil {
+		return nil, err
+	}
+	return c.Codec.Decode(data)
+}
+
+// Payload returns the encoded payload of the vendor.
+func (m *WebpMetaManager) Payload(vendor codec.MetaCodecVendor) ([]byte, error) {
+	c, ok := WebpVendorsCodec[vendor]
+	if !ok {
+		return nil, ErrVendorNotSupported
+	}
+
+	i, err := m.findChunk(c.FourCC)
+	if err != nil {
+		return nil, err
+	}
+	return c.payload(m.chunks[i]), nil
+}
+
+// Vendors lists the vendors of the chunks not needed for rendering, the
+// unknown ones are named after their FourCC.
+func (m *WebpMetaManager) Vendors() ([]codec.MetaCodecVendor, error) {
+	if err := m.readChunks(); err != nil {
+		return nil, err
+	}
+
+	var vendors []codec.MetaCodecVendor
+	for _, chunk := range m.chunks {
+		vendor, ok := chunkVendor(chunk)
+		if ok && !slices.Contains(vendors, vendor) {
+			vendors = append(vendors, vendor)
+		}
+	}
+	return vendors, nil
+}
+
+func (m *WebpMetaManager) Delete(vendor codec.MetaCodecVendor, fields ...string) error {
+	c, ok := WebpVendorsCodec[vendor]
+	if !ok {
+		return ErrVendorNotSupported
+	}
+
+	i, err := m.findChunk(c.FourCC)
+	if err != nil {
+		return err
+	}
+
+	updated, err := codec.Delete(c.Codec, c.payload(m.chunks[i]), fields...)
+	if err != nil {
+		return err
+	}
+	if updated == nil {
+		m.chunks = slices.Delete(m.chunks, i, i+1)
+		return m.updateVP8X()
+	}
+
+	chunk, err := createChunk(c.FourCC, updated)
+	if err != nil {
+		return err
+	}
+	m.chunks[i] = chunk
+	return nil
+}
+
+func (m *WebpMetaManager) Strip(vendors ...codec.MetaCodecVendor) error {
+	for _, vendor := range vendors {
+		c, ok := WebpVendorsCodec[vendor]
+		if !ok {
+			return ErrVendorNotSupported
+		}
+
+		if err := m.readChunks(); err != nil {
+			return err
+		}
+		m.chunks = slices.DeleteFunc(m.chunks, func(chunk []byte) bool { return chunkType(chunk) == c.FourCC })
+	}
+	return m.updateVP8X()
+}
+
+// StripAll removes every chunk not needed to render the image.
+func (m *WebpMetaManager) StripAll() error {
+	if err := m.readChunks(); err != nil {
+		return err
+	}
+
+	m.chunks = slices.DeleteFunc(m.chunks, func(chunk []byte) bool {
+		return !slices.Contains(renderingChunks, chunkType(chunk))
+	})
+	return m.updateVP8X()
+}
+
+// FileReader writes the RIFF size of the chunks once they're parsed.
+func (m *WebpMetaManager) FileReader() io.Reader {
+	if !m.parsed {
+		return io.MultiReader(bytes.NewReader(m.prefix), m.r)
+	}
+
+	size := len(magic.WEBPMagic)
+	for _, chunk := range m.chunks {
+		size += len(chunk)
+	}
+	prefix := bytes.Clone(m.prefix)
+	binary.LittleEndian.PutUint32(prefix[len(magic.RIFFMagic):], uint32(size))
+
+	readers := make([]io.Reader, 0, len(m.chunks)+1)
+	readers = append(readers, bytes.NewReader(prefix))
+	for _, chunk := range m.chunks {
+		readers = append(readers, bytes.NewReader(chunk))
+	}
+	return io.MultiReader(readers...)
+}
+
+// updateVP8X converts a simple file to the extended format once it has
+// other chunks than the image one, and sets the flags of the metadata
+// chunks present.
+func (m *WebpMetaManager) updateVP8X() error {
+	if chunkType(m.chunks[0]) != typeVP8X {
+		if len(m.chunks) == 1 {
+			return nil
+		}
+		width, height, alpha, err := canvas(m.chunks[0])
+		if err != nil {
+			return err
+		}
+		var flags byte
+		if alpha {
+			flags |= flagAlpha
+		}
+		vp8x, err := createVP8X(flags, width, height)
+		if err != nil {
+			return err
+		}
+		m.chunks = slices.Insert(m.chunks, 0, vp8x)
+	}
+
+	if len(m.chunks[0]) < headerSize+vp8xSize {
+		return ErrCorruptedChunk
+	}
+	flags := m.chunks[0][headerSize] &^ (flagEXIF | flagXMP | flagICC)
+	for _, chunk := range m.chunks[1:] {
+		switch chunkType(chunk) {
+		case typeEXIF:
+			flags |= flagEXIF
+		case typeXMP:
+			flags |= flagXMP
+		case typeICCP:
+			flags |= flagICC
+		}
+	}
+	m.chunks[0][headerSize] = flags
+	return nil
+}
+
+// payload returns the data the codec decodes.
+func (c CodecVendor) payload(chunk []byte) []byte {
+	data := chunkData(chunk)
+	if c.FourCC == typeEXIF {
+		return bytes.TrimPrefix(data, exifHeader)
+	}
+	return data
+}
@@ -0,0 +1,197 @@
+package webp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/zzvanq/tinymedia/pkg/meta/codec"
+)
+
+var (
+	// 3x2 lossy frame
+	vp8Chunk = []byte{'V', 'P', '8', ' ', 0x0A, 0, 0, 0, 0x50, 0x01, 0x00, 0x9D, 0x01, 0x2A, 0x03, 0x00, 0x02, 0x00}
+	// 3x2 lossless image with the alpha hint, odd sized so it's padded
+	vp8lChunk = []byte{'V', 'P', '8', 'L', 0x05, 0, 0, 0, 0x2F, 0x02, 0x40, 0x00, 0x10, 0x00}
+	iccpChunk = []byte{'I', 'C', 'C', 'P', 0x02, 0, 0, 0, 'c', 'm'}
+)
+
+// testWebP returns a file of the chunks with the RIFF size set.
+func testWebP(chunks ...[]byte) []byte {
+	data := []byte("RIFF\x00\x00\x00\x00WEBP")
+	for _, c := range chunks {
+		data = append(data, c...)
+	}
+	binary.LittleEndian.PutUint32(data[4:], uint32(len(data)-8))
+	return data
+}
+
+func Test_NewWebpMetaManager(t *testing.T) {
+	if _, err := NewWebpMetaManager(bytes.NewReader([]byte("RIFF\x04\x00\x00\x00WAVE"))); err != ErrInvalidSignature {
+		t.Errorf("want error: %v, got: %v", ErrInvalidSignature, err)
+	}
+	m, _ := NewWebpMetaManager(bytes.NewReader(testWebP()))
+	if _, err := m.Vendors(); err != ErrCorruptedChunk {
+		t.Errorf("want error: %v, got: %v", ErrCorruptedChunk, err)
+	}
+}
+
+func Test_WebpMetaManager_NoChunks(t *testing.T) {
+	m, _ := NewWebpMetaManager(bytes.NewReader(testWebP()))
+	for range 2 {
+		if err := m.StripAll(); err != ErrCorruptedChunk {
+			t.Errorf("want error: %v, got: %v", ErrCorruptedChunk, err)
+		}
+		if err := m.Strip(codec.XMPVendor); err != ErrCorruptedChunk {
+			t.Errorf("want error: %v, got: %v", ErrCorruptedChunk, err)
+		}
+	}
+}
+
+func Test_WebpMetaManager_UpsertExtract(t *testing.T) {
+	tests := []struct {
+		name      string
+		image     []byte
+		vendor    codec.MetaCodecVendor
+		field     string
+		wantFlags byte
+	}{
+		{name: "tinymeta lossy", image: vp8Chunk, vendor: codec.TinyMetaVendor, field: "artist", wantFlags: 0},
+		{name: "tinymetagzip lossy", image: vp8Chunk, vendor: codec.TinyMetaGzipVendor, field: "artist", wantFlags: 0},
+		{name: "xmp lossy", image: vp8Chunk, vendor: codec.XMPVendor, field: "dc:creator", wantFlags: flagXMP},
+		{name: "xmp lossless", image: vp8lChunk, vendor: codec.XMPVendor, field: "dc:creator", wantFlags: flagXMP | flagAlpha},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewWebpMetaManager(bytes.NewReader(testWebP(tt.image)))
+			if err != nil {
+				t.Fatalf("want error: %v, got: %v", nil, err)
+			}
+			if err := m.Upsert(tt.vendor, map[string]string{tt.field: "odd"}); err != nil {
+				t.Fatalf("want error: %v, got: %v", nil, err)
+			}
+
+			data, _ := io.ReadAll(m.FileReader())
+			m, _ = NewWebpMetaManager(bytes.NewReader(data))
+			if err := m.Upsert(tt.vendor, map[string]string{tt.field: "even"}); err != nil {
+				t.Fatalf("want error: %v, got: %v", nil, err)
+			}
+
+			data, _ = io.ReadAll(m.FileReader())
+			if size := binary.LittleEndian.Uint32(data[4:]); int(size) != len(data)-8 {
+				t.Errorf("want RIFF size: %d, got: %d", len(data)-8, size)
+			}
+			vp8x := data[12 : 12+headerSize+vp8xSize]
+			if chunkType(vp8x) != typeVP8X || vp8x[headerSize] != tt.wantFlags {
+				t.Errorf("want VP8X with flags: %#x, got: %v", tt.wantFlags, vp8x)
+			}
+			// canvas of 3x2 stored minus one
+			if !bytes.Equal(vp8x[headerSize+4:], []byte{2, 0, 0, 1, 0, 0}) {
+				t.Errorf("want canvas 3x2, got: %v", vp8x[headerSize+4:])
+			}
+
+			m, _ = NewWebpMetaManager(bytes.NewReader(data))
+			got, err := m.Extract(tt.vendor, tt.field)
+			if err != nil {
+				t.Fatalf("want error: %v, got: %v", nil, err)
+			}
+			if want := map[string]string{tt.field: "even"}; !maps.Equal(got, want) {
+				t.Errorf("want: %v, got: %v", want, got)
+			}
+		})
+	}
+}
+
+func Test_WebpMetaManager_ExtractAlias(t *testing.T) {
+	m, _ := NewWebpMetaManager(bytes.NewReader(testWebP(vp8Chunk)))
+	if err := m.Upsert(codec.ExifVendor, map[string]string{"Orientation": "6"}); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+
+	got, err := m.Extract(codec.ExifVendor, "0x0112")
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if want := map[string]string{"0x0112": "6"}; !maps.Equal(got, want) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+}
+
+func Test_WebpMetaManager_Delete(t *testing.T) {
+	m, _ := NewWebpMetaManager(bytes.NewReader(testWebP(vp8Chunk)))
+	m.Upsert(codec.XMPVendor, map[string]string{"dc:creator": "a", "dc:title": "t"})
+
+	if err := m.Delete(codec.XMPVendor, "dc:creator"); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	got, _ := m.Fields(codec.XMPVendor)
+	if want := map[string]string{"dc:title": "t"}; !maps.Equal(got, want) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+
+	if err := m.Delete(codec.XMPVendor, "dc:title"); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if _, err := m.Fields(codec.XMPVendor); err != ErrChunkNotFound {
+		t.Errorf("want error: %v, got: %v", ErrChunkNotFound, err)
+	}
+	if flags := m.chunks[0][headerSize]; flags&flagXMP != 0 {
+		t.Errorf("want XMP flag cleared, got: %#x", flags)
+	}
+}
+
+func Test_WebpMetaManager_UpsertFlags(t *testing.T) {
+	m, _ := NewWebpMetaManager(bytes.NewReader(testWebP(vp8Chunk)))
+	m.Upsert(codec.XMPVendor, map[string]string{"dc:title": "t"})
+	data, _ := io.ReadAll(m.FileReader())
+	// written by a tool leaving the flag unset
+	data[12+headerSize] &^= flagXMP
+
+	m, _ = NewWebpMetaManager(bytes.NewReader(data))
+	if err := m.Upsert(codec.XMPVendor, map[string]string{"dc:creator": "a"}); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if flags := m.chunks[0][headerSize]; flags&flagXMP == 0 {
+		t.Errorf("want XMP flag set, got: %#x", flags)
+	}
+}
+
+func Test_WebpMetaManager_StripVendors(t *testing.T) {
+	vp8x, _ := createVP8X(flagICC, 3, 2)
+	unknown := []byte{'A', 'B', 'C', ' ', 0x01, 0, 0, 0, 'x', 0}
+	m, _ := NewWebpMetaManager(bytes.NewReader(testWebP(vp8x, iccpChunk, vp8Chunk, unknown)))
+	m.Upsert(codec.TinyMetaVendor, map[string]string{"artist": "a"})
+	m.Upsert(codec.XMPVendor, map[string]string{"dc:title": "t"})
+
+	vendors, err := m.Vendors()
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	want := []codec.MetaCodecVendor{"ABC", codec.TinyMetaVendor, codec.XMPVendor}
+	if !slices.Equal(vendors, want) {
+		t.Errorf("want: %v, got: %v", want, vendors)
+	}
+
+	if err := m.Strip(codec.XMPVendor); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if err := m.StripAll(); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	data, _ := io.ReadAll(m.FileReader())
+	if want := testWebP(vp8x, iccpChunk, vp8Chunk); !bytes.Equal(data, want) {
+		t.Errorf("want: %v, got: %v", want, data)
+	}
+}
+
+func Test_WebpMetaManager_Corrupted(t *testing.T) {
+	file := testWebP(vp8Chunk)
+	m, _ := NewWebpMetaManager(bytes.NewReader(file[:len(file)-3]))
+	if _, err := m.Fields(codec.TinyMetaVendor); err != ErrCorruptedChunk {
+		t.Errorf("want error: %v, got: %v", ErrCorruptedChunk, err)
+	}
+}
@@ -0,0 +1,137 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOp
+	tokenLParen
+	tokenRParen
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+func (t token) String() string {
+	if t.kind == tokenEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(t.value)
+}
+
+// operators are matched longest first.
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "!"}
+
+func lex(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case r == '(':
+			tokens = append(tokens, token{tokenLParen, "(", i})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{tokenRParen, ")", i})
+			i++
+		case r == '"':
+			value, n, err := lexString(s[i:])
+			if err != nil {
+				return nil, fmt.Errorf("%w at %d: %v", ErrSyntax, i, err)
+			}
+			tokens = append(tokens, token{tokenString, value, i})
+			i += n
+		case r == '-' || r == '.' || unicode.IsDigit(r):
+			n := lexNumber(s[i:])
+			value := s[i : i+n]
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				return nil, fmt.Errorf("%w at %d: invalid number %q", ErrSyntax, i, value)
+			}
+			tokens = append(tokens, token{tokenNumber, value, i})
+			i += n
+		case unicode.IsLetter(r) || r == '_':
+			n := strings.IndexFunc(s[i:], func(r rune) bool { return !isIdentRune(r) })
+			if n < 0 {
+				n = len(s) - i
+			}
+			tokens = append(tokens, token{tokenIdent, s[i : i+n], i})
+			i += n
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(s[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("%w at %d: unexpected %q", ErrSyntax, i, r)
+			}
+			tokens = append(tokens, token{tokenOp, op, i})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{tokenEOF, "", len(s)}), nil
+}
+
+// lexNumber returns the length of the number s starts with, its sign
+// included, with an exponent as in 1e3. An exponent without digits is
+// kept, so the number fails to parse.
+func lexNumber(s string) int {
+	n := 1 + span(s[1:], func(r rune) bool { return unicode.IsDigit(r) || r == '.' })
+	if n < len(s) && (s[n] == 'e' || s[n] == 'E') {
+		exp := n + 1
+		if exp < len(s) && (s[exp] == '+' || s[exp] == '-') {
+			exp++
+		}
+		n = exp + span(s[exp:], unicode.IsDigit)
+	}
+	return n
+}
+
+// span returns the length of the prefix of s whose runes satisfy f.
+func span(s string, f func(rune) bool) int {
+	n := strings.IndexFunc(s, func(r rune) bool { return !f(r) })
+	if n < 0 {
+		return len(s)
+	}
+	return n
+}
+
+// lexString reads a double-quoted Go string, returning its value and length.
+func lexString(s string) (string, int, error) {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			value, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid string %s", s[:i+1])
+			}
+			return value, i + 1, nil
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+// isIdentRune reports whether r can be part of a field name, namespaced
+// ones included, e.g. dc:title or photoshop:Date-Created.
+func isIdentRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == ':' || r == '.' || r == '-'
+}
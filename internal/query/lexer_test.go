@@ -0,0 +1,45 @@
+package query
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func Test_lex(t *testing.T) {
+	tests := []struct {
+		expr string
+		want []token
+	}{
+		{expr: `size > 1e3`, want: []token{{tokenIdent, "size", 0}, {tokenOp, ">", 5}, {tokenNumber, "1e3", 7}}},
+		{expr: `-2.5E-3<x`, want: []token{{tokenNumber, "-2.5E-3", 0}, {tokenOp, "<", 7}, {tokenIdent, "x", 8}}},
+		{expr: `1e+2`, want: []token{{tokenNumber, "1e+2", 0}}},
+		{
+			expr: `photoshop:Date-Created != ""`,
+			want: []token{{tokenIdent, "photoshop:Date-Created", 0}, {tokenOp, "!=", 23}, {tokenString, "", 26}},
+		},
+		{expr: `a==-1`, want: []token{{tokenIdent, "a", 0}, {tokenOp, "==", 1}, {tokenNumber, "-1", 3}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := lex(tt.expr)
+			if err != nil {
+				t.Fatalf("want error: %v, got: %v", nil, err)
+			}
+			want := append(tt.want, token{tokenEOF, "", len(tt.expr)})
+			if !slices.Equal(got, want) {
+				t.Errorf("want: %v, got: %v", want, got)
+			}
+		})
+	}
+}
+
+func Test_lex_Errors(t *testing.T) {
+	for _, expr := range []string{`1e`, `-`, `1.2.3`, `x @ 1`} {
+		t.Run(expr, func(t *testing.T) {
+			if _, err := lex(expr); !errors.Is(err, ErrSyntax) {
+				t.Errorf("want error: %v, got: %v", ErrSyntax, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+// Package query evaluates filter expressions over metadata fields, e.g.
+//
+//	artist == "X" && year >= 2020 || has(title) && title =~ "(?i)draft"
+//
+// Fields are compared as numbers when both sides are numbers, as strings
+// otherwise. A comparison with a missing field is false.
+package query
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+var ErrSyntax = errors.New("syntax error")
+
+// Expr is a parsed expression.
+type Expr interface {
+	Eval(fields map[string]string) bool
+}
+
+// Parse parses the expression, with && binding tighter than ||.
+func Parse(s string) (Expr, error) {
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, p.unexpected(t)
+	}
+	return e, nil
+}
+
+type parser struct {
+	tokens []token
+	i      int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tokenEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) unexpected(t token) error {
+	return fmt.Errorf("%w at %d: unexpected %s", ErrSyntax, t.pos, t)
+}
+
+func (p *parser) expect(kind tokenKind) (token, error) {
+	t := p.next()
+	if t.kind != kind {
+		return t, p.unexpected(t)
+	}
+	return t, nil
+}
+
+func (p *parser) or() (Expr, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenOp && p.peek().value == "||" {
+		p.next()
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) and() (Expr, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenOp && p.peek().value == "&&" {
+		p.next()
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) unary() (Expr, error) {
+	if t := p.peek(); t.kind == tokenOp && t.value == "!" {
+		p.next()
+		e, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{e}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (Expr, error) {
+	t := p.peek()
+	switch {
+	case t.kind == tokenLParen:
+		p.next()
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokenRParen); err != nil {
+			return nil, err
+		}
+		return e, nil
+	case t.kind == tokenIdent && t.value == "has" && p.tokens[p.i+1].kind == tokenLParen:
+		p.i += 2
+		field := p.next()
+		if field.kind != tokenIdent && field.kind != tokenString {
+			return nil, p.unexpected(field)
+		}
+		if _, err := p.expect(tokenRParen); err != nil {
+			return nil, err
+		}
+		return hasExpr{field.value}, nil
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() (Expr, error) {
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+
+	op := p.next()
+	if op.kind != tokenOp {
+		return nil, p.unexpected(op)
+	}
+	c := compareExpr{op: op.value, left: left}
+	switch op.value {
+	case "==", "!=", "<", "<=", ">", ">=":
+		if c.right, err = p.operand(); err != nil {
+			return nil, err
+		}
+	case "=~", "!~":
+		pattern, err := p.expect(tokenString)
+		if err != nil {
+			return nil, err
+		}
+		if c.re, err = regexp.Compile(pattern.value); err != nil {
+			return nil, fmt.Errorf("%w at %d: %v", ErrSyntax, pattern.pos, err)
+		}
+	default:
+		return nil, p.unexpected(op)
+	}
+	return c, nil
+}
+
+func (p *parser) operand() (operand, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenIdent:
+		return operand{field: t.value}, nil
+	case tokenString, tokenNumber:
+		return operand{value: t.value, literal: true}, nil
+	}
+	return operand{}, p.unexpected(t)
+}
+
+type orExpr struct{ left, right Expr }
+
+func (e orExpr) Eval(fields map[string]string) bool {
+	return e.left.Eval(fields) || e.right.Eval(fields)
+}
+
+type andExpr struct{ left, right Expr }
+
+func (e andExpr) Eval(fields map[string]string) bool {
+	return e.left.Eval(fields) && e.right.Eval(fields)
+}
+
+type notExpr struct{ e Expr }
+
+func (e notExpr) Eval(fields map[string]string) bool {
+	return !e.e.Eval(fields)
+}
+
+type hasExpr struct{ field string }
+
+func (e hasExpr) Eval(fields map[string]string) bool {
+	_, ok := fields[e.field]
+	return ok
+}
+
+// operand is either a field or a literal value.
+type operand struct {
+	field   string
+	value   string
+	literal bool
+}
+
+func (o operand) resolve(fields map[string]string) (string, bool) {
+	if o.literal {
+		return o.value, true
+	}
+	v, ok := fields[o.field]
+	return v, ok
+}
+
+type compareExpr struct {
+	op          string
+	left, right operand
+	re          *regexp.Regexp
+}
+
+func (e compareExpr) Eval(fields map[string]string) bool {
+	left, ok := e.left.resolve(fields)
+	if !ok {
+		return false
+	}
+	if e.re != nil {
+		return e.re.MatchString(left) == (e.op == "=~")
+	}
+
+	right, ok := e.right.resolve(fields)
+	if !ok {
+		return false
+	}
+
+	cmp := compare(left, right)
+	switch e.op {
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	}
+	return cmp >= 0
+}
+
+// compare compares numerically if both values are numbers.
+func compare(a, b string) int {
+	x, errA := strconv.ParseFloat(a, 64)
+	y, errB := strconv.ParseFloat(b, 64)
+	if errA != nil || errB != nil {
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	}
+
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
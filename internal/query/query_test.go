@@ -0,0 +1,76 @@
+package query
+
+import (
+	"errors"
+	"testing"
+)
+
+func Test_Parse_Eval(t *testing.T) {
+	fields := map[string]string{
+		"artist":   "X",
+		"year":     "2021",
+		"title":    "Draft: sunset",
+		"dc:title": "t",
+		"rating":   "10",
+
+		"photoshop:Date-Created": "2021-05-01",
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{expr: `artist == "X" && year >= 2020`, want: true},
+		{expr: `artist == "X" && year >= 2022`, want: false},
+		{expr: `artist != "X" || year < 2022`, want: true},
+		{expr: `has(title) && !has(album)`, want: true},
+		{expr: `has("dc:title") && dc:title == "t"`, want: true},
+		{expr: `title =~ "(?i)^draft"`, want: true},
+		{expr: `title !~ "sunset"`, want: false},
+		{expr: `rating > 9`, want: true},
+		{expr: `rating < 1e3 && rating > 1E-1`, want: true},
+		{expr: `photoshop:Date-Created >= "2021"`, want: true},
+		{expr: `rating > "9"`, want: true},
+		{expr: `artist > "W" && artist <= "X"`, want: true},
+		{expr: `album == "" || album != ""`, want: false},
+		{expr: `!(artist == "Y" || year == 2020) && year != -1.5`, want: true},
+		{expr: `artist == "X" || year == 1 && rating == 1`, want: true},
+		{expr: `(artist == "X" || year == 1) && rating == 1`, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			e, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("want error: %v, got: %v", nil, err)
+			}
+			if got := e.Eval(fields); got != tt.want {
+				t.Errorf("want: %v, got: %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_Parse_Errors(t *testing.T) {
+	tests := []string{
+		``,
+		`artist`,
+		`artist ==`,
+		`artist == "X" &&`,
+		`(artist == "X"`,
+		`artist == "X")`,
+		`artist =~ title`,
+		`artist =~ "("`,
+		`artist == "X`,
+		`has(1)`,
+		`year == 1.2.3`,
+		`artist @ "X"`,
+		`! == "X"`,
+	}
+	for _, expr := range tests {
+		t.Run(expr, func(t *testing.T) {
+			if _, err := Parse(expr); !errors.Is(err, ErrSyntax) {
+				t.Errorf("want error: %v, got: %v", ErrSyntax, err)
+			}
+		})
+	}
+}
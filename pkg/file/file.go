@@ -10,19 +10,57 @@ import (
 
 var ErrUnsupportedFileType = errors.New("unsupported file type")
 
+// ReadFileType tells the type of the file from its first bytes. The
+// returned reader starts over from the beginning, it's r itself when r
+// can be seeked, so the managers can skip the media data instead of
+// buffering it.
 func ReadFileType(r io.Reader) (io.Reader, FileType, error) {
+	if s, ok := r.(io.ReadSeeker); ok {
+		if start, err := s.Seek(0, io.SeekCurrent); err == nil {
+			ftype, err := readType(s)
+			if err != nil {
+				return nil, "", err
+			}
+			if _, err := s.Seek(start, io.SeekStart); err != nil {
+				return nil, "", err
+			}
+			return s, ftype, nil
+		}
+	}
+
 	var buf bytes.Buffer
-	tee := io.TeeReader(r, &buf)
+	ftype, err := readType(io.TeeReader(r, &buf))
+	if err != nil {
+		return nil, "", err
+	}
+	return io.MultiReader(&buf, r), ftype, nil
+}
 
+func readType(r io.Reader) (FileType, error) {
 	prefix := make([]byte, magic.MagicPrefixMaxLength)
-	if _, err := io.ReadFull(tee, prefix); err != nil {
-		return nil, "", err
+	n, err := io.ReadFull(r, prefix)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", err
 	}
+	prefix = prefix[:n]
 
-	rewindReader := io.MultiReader(&buf, r)
-	if bytes.HasPrefix(prefix, magic.JPEGMagic) {
-		return rewindReader, FileTypeJPEG, nil
+	switch {
+	case bytes.HasPrefix(prefix, magic.JPEGMagic):
+		return FileTypeJPEG, nil
+	case bytes.HasPrefix(prefix, magic.PNGMagic):
+		return FileTypePNG, nil
+	case bytes.HasPrefix(prefix, magic.GIF87aMagic), bytes.HasPrefix(prefix, magic.GIF89aMagic):
+		return FileTypeGIF, nil
+	case bytes.HasPrefix(prefix, magic.RIFFMagic) && len(prefix) == magic.MagicPrefixMaxLength &&
+		bytes.HasSuffix(prefix, magic.WEBPMagic):
+		return FileTypeWebP, nil
+	case bytes.HasPrefix(prefix, magic.TIFFLEMagic), bytes.HasPrefix(prefix, magic.TIFFBEMagic):
+		return FileTypeTIFF, nil
+	case len(prefix) >= 8 && bytes.Equal(prefix[4:8], magic.FTYPMagic):
+		return FileTypeISOBMFF, nil
+	case bytes.HasPrefix(prefix, magic.ID3Magic), magic.IsMPEGAudioSync(prefix):
+		return FileTypeMP3, nil
 	}
 
-	return nil, "", ErrUnsupportedFileType
+	return "", ErrUnsupportedFileType
 }
@@ -3,6 +3,7 @@ package file
 import (
 	"bytes"
 	"errors"
+	"io"
 	"testing"
 
 	"github.com/zzvanq/tinymedia/internal/file/magic"
@@ -24,9 +25,75 @@ func Test_ReadFileType(t *testing.T) {
 		{
 			name:    "png",
 			data:    magic.PNGMagic,
+			want:    FileTypePNG,
+			wantErr: nil,
+		},
+		{
+			name:    "gif87a",
+			data:    magic.GIF87aMagic,
+			want:    FileTypeGIF,
+			wantErr: nil,
+		},
+		{
+			name:    "gif89a",
+			data:    magic.GIF89aMagic,
+			want:    FileTypeGIF,
+			wantErr: nil,
+		},
+		{
+			name:    "webp",
+			data:    []byte("RIFF\x1a\x00\x00\x00WEBP"),
+			want:    FileTypeWebP,
+			wantErr: nil,
+		},
+		{
+			name:    "riff not webp",
+			data:    []byte("RIFF\x1a\x00\x00\x00WAVE"),
+			want:    "",
+			wantErr: ErrUnsupportedFileType,
+		},
+		{
+			name:    "tiff little endian",
+			data:    magic.TIFFLEMagic,
+			want:    FileTypeTIFF,
+			wantErr: nil,
+		},
+		{
+			name:    "tiff big endian",
+			data:    magic.TIFFBEMagic,
+			want:    FileTypeTIFF,
+			wantErr: nil,
+		},
+		{
+			name:    "isobmff",
+			data:    []byte("\x00\x00\x00\x18ftypmp42"),
+			want:    FileTypeISOBMFF,
+			wantErr: nil,
+		},
+		{
+			name:    "mp3 id3",
+			data:    []byte("ID3\x04\x00\x00\x00\x00\x00\x00"),
+			want:    FileTypeMP3,
+			wantErr: nil,
+		},
+		{
+			name:    "mp3 frame sync",
+			data:    []byte{0xFF, 0xFB, 0x90, 0x00},
+			want:    FileTypeMP3,
+			wantErr: nil,
+		},
+		{
+			name:    "truncated png",
+			data:    magic.PNGMagic[:4],
 			want:    "",
 			wantErr: ErrUnsupportedFileType,
 		},
+		{
+			name:    "empty",
+			data:    []byte{},
+			want:    "",
+			wantErr: io.EOF,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
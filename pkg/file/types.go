@@ -4,4 +4,11 @@ type FileType string
 
 const (
 	FileTypeJPEG FileType = "jpeg"
+	FileTypePNG  FileType = "png"
+	FileTypeGIF  FileType = "gif"
+	FileTypeWebP FileType = "webp"
+	FileTypeTIFF FileType = "tiff"
+	FileTypeMP3  FileType = "mp3"
+	// FileTypeISOBMFF covers HEIC, AVIF, MP4 and MOV
+	FileTypeISOBMFF FileType = "isobmff"
 )
@@ -1,8 +1,103 @@
 package codec
 
+import "maps"
+
 type MetaCodecVendor string
 
 const (
 	TinyMetaVendor     MetaCodecVendor = "tinymeta"
 	TinyMetaGzipVendor MetaCodecVendor = "tinymetagzip"
+	ExifVendor         MetaCodecVendor = "exif"
+	XMPVendor          MetaCodecVendor = "xmp"
+	// ID3Vendor has no codec, the MP3 manager maps its fields to ID3v2
+	// text frames.
+	ID3Vendor MetaCodecVendor = "id3"
+	// CommentVendor is the text of the GIF Comment Extension, as its single
+	// "text" field.
+	CommentVendor MetaCodecVendor = "comment"
 )
+
+type Codec interface {
+	Encode(map[string]string) ([]byte, error)
+	Decode([]byte) (map[string]string, error)
+}
+
+// Updater is implemented by codecs whose payload holds more than the
+// decoded fields, so it has to be patched instead of re-encoded.
+type Updater interface {
+	Update(data []byte, fields map[string]string) ([]byte, error)
+}
+
+// Deleter is the removing counterpart of Updater. A nil payload means
+// nothing is left in it.
+type Deleter interface {
+	Delete(data []byte, fields ...string) ([]byte, error)
+}
+
+// Normalizer is implemented by codecs accepting aliases for field names.
+type Normalizer interface {
+	Normalize(field string) string
+}
+
+// Restricter is implemented by codecs writing only some of the fields
+// they decode.
+type Restricter interface {
+	Writable(field string) bool
+}
+
+// Extract returns the decoded fields asked for by their names, looked up
+// by the normalized ones when the codec has aliases.
+func Extract(c Codec, decoded map[string]string, fields ...string) map[string]string {
+	normalizer, _ := c.(Normalizer)
+	result := make(map[string]string, len(fields))
+	for _, field := range fields {
+		key := field
+		if normalizer != nil {
+			key = normalizer.Normalize(field)
+		}
+		if v, ok := decoded[key]; ok {
+			result[field] = v
+		}
+	}
+	return result
+}
+
+// Update merges fields into the encoded data.
+func Update(c Codec, data []byte, fields map[string]string) ([]byte, error) {
+	if u, ok := c.(Updater); ok {
+		return u.Update(data, fields)
+	}
+
+	decoded := make(map[string]string)
+	if len(data) > 0 {
+		var err error
+		decoded, err = c.Decode(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	maps.Copy(decoded, fields)
+	return c.Encode(decoded)
+}
+
+// Delete removes fields from the encoded data, returning nil once the
+// payload has no fields left.
+func Delete(c Codec, data []byte, fields ...string) ([]byte, error) {
+	if d, ok := c.(Deleter); ok {
+		return d.Delete(data, fields...)
+	}
+
+	decoded, err := c.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, field := range fields {
+		delete(decoded, field)
+	}
+	if len(decoded) == 0 {
+		return nil, nil
+	}
+	return c.Encode(decoded)
+}
@@ -0,0 +1,216 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/zzvanq/tinymedia/pkg/meta"
+)
+
+var (
+	ErrCorruptedExif  = fmt.Errorf("%w exif", meta.ErrCorrupted)
+	ErrTagNotWritable = errors.New("tag not writable")
+	ErrInvalidValue   = errors.New("invalid tag value")
+)
+
+type exif struct{}
+
+// Exif decodes a TIFF structure as stored in the JPEG APP1 segment.
+// Tags are keyed by name, or by their hex ID when the name is unknown.
+var Exif = exif{}
+
+func (e exif) Encode(fields map[string]string) ([]byte, error) {
+	return e.Update(nil, fields)
+}
+
+func (e exif) Decode(data []byte) (map[string]string, error) {
+	t, err := parseTiff(data)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]string)
+	for kind, d := range t.ifds {
+		for _, en := range d.entries {
+			fields[tagName(kind, en.tag)] = formatValue(en, t.order)
+		}
+	}
+	return fields, nil
+}
+
+// Update rewrites the given tags keeping the rest of the structure,
+// including the thumbnail, intact. The entries whose value can't be
+// moved, of unknown types or holding offsets as the maker notes, are
+// dropped.
+func (e exif) Update(data []byte, fields map[string]string) ([]byte, error) {
+	t := newTiff()
+	if len(data) > 0 {
+		var err error
+		t, err = parseTiff(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for field, value := range fields {
+		name := e.Normalize(field)
+		w, ok := writableTags[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrTagNotWritable, field)
+		}
+
+		en, err := parseValue(w, value, t.order)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", err, field)
+		}
+
+		d, ok := t.ifds[w.ifd]
+		if !ok {
+			d = &ifd{}
+			t.ifds[w.ifd] = d
+		}
+		d.set(en)
+	}
+	return t.bytes(), nil
+}
+
+func (e exif) Delete(data []byte, fields ...string) ([]byte, error) {
+	t, err := parseTiff(data)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, field := range fields {
+		name := e.Normalize(field)
+		for kind, d := range t.ifds {
+			for _, en := range d.entries {
+				if tagName(kind, en.tag) == name {
+					d.remove(en.tag)
+					break
+				}
+			}
+		}
+	}
+
+	if t.empty() {
+		return nil, nil
+	}
+	return t.bytes(), nil
+}
+
+// Writable reports whether Update sets the tag, the layout and image
+// tags are left to the file.
+func (e exif) Writable(field string) bool {
+	_, ok := writableTags[e.Normalize(field)]
+	return ok
+}
+
+// Normalize resolves numeric tag IDs, e.g. "315" or "0x013B", to tag names.
+func (e exif) Normalize(field string) string {
+	id, err := strconv.ParseUint(field, 0, 16)
+	if err != nil {
+		return field
+	}
+	for _, kind := range []ifdKind{ifd0, ifdExif} {
+		if _, ok := ifdTags[kind][uint16(id)]; ok {
+			return tagName(kind, uint16(id))
+		}
+	}
+	return tagName(ifd0, uint16(id))
+}
+
+func tagName(kind ifdKind, tag uint16) string {
+	name, ok := ifdTags[kind][tag]
+	if !ok {
+		name = fmt.Sprintf("0x%04X", tag)
+		if kind == ifdGPS {
+			name = "GPS." + name
+		}
+	}
+	return ifdPrefixes[kind] + name
+}
+
+func formatValue(en entry, order binary.ByteOrder) string {
+	switch en.typ {
+	case typeASCII:
+		return strings.TrimRight(string(en.value), "\x00")
+	case typeUndefined:
+		if en.tag == tagUserComment && bytes.HasPrefix(en.value, []byte("ASCII\x00\x00\x00")) {
+			return strings.TrimRight(string(en.value[8:]), "\x00 ")
+		}
+		if isPrintable(en.value) {
+			return string(en.value)
+		}
+		return hex.EncodeToString(en.value)
+	}
+
+	size, ok := typeSizes[en.typ]
+	if !ok {
+		return hex.EncodeToString(en.value)
+	}
+	values := make([]string, 0, en.count)
+	for i := 0; i+size <= len(en.value); i += size {
+		v := en.value[i : i+size]
+		var s string
+		switch en.typ {
+		case typeByte:
+			s = strconv.FormatUint(uint64(v[0]), 10)
+		case typeSByte:
+			s = strconv.FormatInt(int64(int8(v[0])), 10)
+		case typeShort:
+			s = strconv.FormatUint(uint64(order.Uint16(v)), 10)
+		case typeSShort:
+			s = strconv.FormatInt(int64(int16(order.Uint16(v))), 10)
+		case typeLong:
+			s = strconv.FormatUint(uint64(order.Uint32(v)), 10)
+		case typeSLong:
+			s = strconv.FormatInt(int64(int32(order.Uint32(v))), 10)
+		case typeRational:
+			s = fmt.Sprintf("%d/%d", order.Uint32(v), order.Uint32(v[4:]))
+		case typeSRational:
+			s = fmt.Sprintf("%d/%d", int32(order.Uint32(v)), int32(order.Uint32(v[4:])))
+		case typeFloat:
+			s = strconv.FormatFloat(float64(math.Float32frombits(order.Uint32(v))), 'g', -1, 32)
+		case typeDouble:
+			s = strconv.FormatFloat(math.Float64frombits(order.Uint64(v)), 'g', -1, 64)
+		}
+		values = append(values, s)
+	}
+	return strings.Join(values, " ")
+}
+
+func parseValue(w writableTag, value string, order binary.ByteOrder) (entry, error) {
+	en := entry{tag: w.tag, typ: w.typ}
+	switch w.typ {
+	case typeASCII:
+		if strings.IndexByte(value, 0) >= 0 {
+			return entry{}, ErrInvalidValue
+		}
+		en.value = append([]byte(value), 0)
+		en.count = uint32(len(en.value))
+	case typeShort:
+		v, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return entry{}, ErrInvalidValue
+		}
+		en.value = make([]byte, 2)
+		order.PutUint16(en.value, uint16(v))
+		en.count = 1
+	}
+	return en, nil
+}
+
+func isPrintable(b []byte) bool {
+	for _, c := range b {
+		if c < 0x20 || c > 0x7E {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,363 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"maps"
+	"testing"
+)
+
+type testEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// testTiff lays out IFD0 -> ExifIFD -> GPS -> IFD1 -> thumbnail by hand,
+// so the parser is not tested against its own writer.
+func testTiff(order binary.ByteOrder, thumbnail []byte) []byte {
+	u16 := func(v uint16) []byte { b := make([]byte, 2); order.PutUint16(b, v); return b }
+	u32 := func(v uint32) []byte { b := make([]byte, 4); order.PutUint32(b, v); return b }
+	pad4 := func(b []byte) []byte { return append(b, make([]byte, 4-len(b))...) }
+
+	writeIFD := func(buf []byte, entries []testEntry, next uint32) []byte {
+		start := uint32(len(buf))
+		dataPos := start + 2 + uint32(len(entries))*12 + 4
+		var data []byte
+		buf = append(buf, u16(uint16(len(entries)))...)
+		for _, e := range entries {
+			buf = append(buf, u16(e.tag)...)
+			buf = append(buf, u16(e.typ)...)
+			buf = append(buf, u32(e.count)...)
+			if len(e.value) <= 4 {
+				buf = append(buf, pad4(e.value)...)
+			} else {
+				buf = append(buf, u32(dataPos+uint32(len(data)))...)
+				data = append(data, e.value...)
+			}
+		}
+		buf = append(buf, u32(next)...)
+		return append(buf, data...)
+	}
+
+	mk := []byte("Canon\x00")
+	ifd0Size := uint32(2 + 4*12 + 4 + len(mk))
+	exifStart := 8 + ifd0Size
+	dto := []byte("2020:01:02 03:04:05\x00")
+	exposure := append(u32(1), u32(250)...)
+	exifSize := uint32(2 + 2*12 + 4 + len(dto) + len(exposure))
+	gpsStart := exifStart + exifSize
+	gpsSize := uint32(2 + 1*12 + 4)
+	ifd1Start := gpsStart + gpsSize
+	ifd1Size := uint32(2 + 2*12 + 4)
+	thumbStart := ifd1Start + ifd1Size
+
+	var buf []byte
+	if order == binary.LittleEndian {
+		buf = append(buf, "II"...)
+	} else {
+		buf = append(buf, "MM"...)
+	}
+	buf = append(buf, u16(42)...)
+	buf = append(buf, u32(8)...)
+	buf = writeIFD(buf, []testEntry{
+		{0x010F, typeASCII, uint32(len(mk)), mk},
+		{0x0112, typeShort, 1, u16(6)},
+		{tagExifIFD, typeLong, 1, u32(exifStart)},
+		{tagGPSIFD, typeLong, 1, u32(gpsStart)},
+	}, ifd1Start)
+	buf = writeIFD(buf, []testEntry{
+		{0x829A, typeRational, 1, exposure},
+		{0x9003, typeASCII, uint32(len(dto)), dto},
+	}, 0)
+	buf = writeIFD(buf, []testEntry{
+		{0x0001, typeASCII, 2, []byte("N\x00")},
+	}, 0)
+	buf = writeIFD(buf, []testEntry{
+		{tagThumbOffset, typeLong, 1, u32(thumbStart)},
+		{tagThumbLength, typeLong, 1, u32(uint32(len(thumbnail)))},
+	}, 0)
+	buf = append(buf, thumbnail...)
+	return buf
+}
+
+func Test_Exif_Decode(t *testing.T) {
+	thumbnail := []byte{0xFF, 0xD8, 0xFF, 0xD9}
+	want := map[string]string{
+		"Make":             "Canon",
+		"Orientation":      "6",
+		"ExposureTime":     "1/250",
+		"DateTimeOriginal": "2020:01:02 03:04:05",
+		"GPSLatitudeRef":   "N",
+	}
+
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		t.Run(order.String(), func(t *testing.T) {
+			got, err := Exif.Decode(testTiff(order, thumbnail))
+			if err != nil {
+				t.Fatalf("want error: %v, got: %v", nil, err)
+			}
+			for k, v := range want {
+				if got[k] != v {
+					t.Errorf("%s: want: %q, got: %q", k, v, got[k])
+				}
+			}
+			if _, ok := got["Thumbnail.0x0201"]; ok {
+				t.Errorf("thumbnail pointer must not be exposed: %v", got)
+			}
+		})
+	}
+}
+
+func Test_Exif_Decode_Errors(t *testing.T) {
+	valid := testTiff(binary.BigEndian, nil)
+	badIFD := bytes.Clone(valid)
+	binary.BigEndian.PutUint32(badIFD[4:], uint32(len(valid)))
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: []byte{}},
+		{name: "wrong byte order", data: append([]byte("XX"), valid[2:]...)},
+		{name: "wrong magic", data: append([]byte("MM\x00\x2B"), valid[4:]...)},
+		{name: "ifd out of bounds", data: badIFD},
+		{name: "truncated", data: valid[:len(valid)-8]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Exif.Decode(tt.data); err != ErrCorruptedExif {
+				t.Errorf("want error: %v, got: %v", ErrCorruptedExif, err)
+			}
+		})
+	}
+}
+
+func Test_Exif_Update(t *testing.T) {
+	thumbnail := []byte{0xFF, 0xD8, 0x01, 0x02, 0x03, 0xFF, 0xD9}
+	data := testTiff(binary.LittleEndian, thumbnail)
+
+	updated, err := Exif.Update(data, map[string]string{
+		"Artist":           "Someone",
+		"0x8298":           "(c) Someone",
+		"DateTimeOriginal": "2021:01:01 00:00:00",
+		"Orientation":      "1",
+	})
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+
+	got, err := Exif.Decode(updated)
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	want := map[string]string{
+		"Artist":           "Someone",
+		"Copyright":        "(c) Someone",
+		"DateTimeOriginal": "2021:01:01 00:00:00",
+		"Orientation":      "1",
+		"Make":             "Canon",
+		"ExposureTime":     "1/250",
+		"GPSLatitudeRef":   "N",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s: want: %q, got: %q", k, v, got[k])
+		}
+	}
+
+	if string(updated[:2]) != "II" {
+		t.Errorf("byte order changed: %q", updated[:2])
+	}
+
+	parsed, err := parseTiff(updated)
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if !bytes.Equal(parsed.thumbnail, thumbnail) {
+		t.Errorf("want thumbnail: %v, got: %v", thumbnail, parsed.thumbnail)
+	}
+}
+
+func Test_Exif_Update_Opaque(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		t.Run(order.String(), func(t *testing.T) {
+			u16 := func(v uint16) []byte { b := make([]byte, 2); order.PutUint16(b, v); return b }
+			u32 := func(v uint32) []byte { b := make([]byte, 4); order.PutUint32(b, v); return b }
+			entry := func(tag, typ uint16, count uint32, value []byte) []byte {
+				return bytes.Join([][]byte{u16(tag), u16(typ), u32(count), value}, nil)
+			}
+
+			// IFD0 with an entry of a type from a later spec, IFD1 with an
+			// uncompressed thumbnail of two strips
+			data := []byte("II\x2A\x00")
+			if order == binary.BigEndian {
+				data = []byte("MM\x00\x2A")
+			}
+			data = append(data, u32(8)...)
+			data = append(data, u16(2)...)
+			data = append(data, entry(0x010F, typeASCII, 4, []byte("Nik\x00"))...)
+			data = append(data, entry(0xC000, 13, 1, []byte{0xDE, 0xAD, 0xBE, 0xEF})...)
+			data = append(data, u32(38)...)
+			data = append(data, u16(2)...)
+			data = append(data, entry(tagStripOffsets, typeLong, 2, u32(68))...)
+			data = append(data, entry(tagStripByteCount, typeShort, 2, append(u16(3), u16(2)...))...)
+			data = append(data, u32(0)...)
+			data = append(data, u32(76)...)
+			data = append(data, u32(79)...)
+			data = append(data, "abcde"...)
+
+			updated, err := Exif.Update(data, map[string]string{"Artist": "Someone"})
+			if err != nil {
+				t.Fatalf("want error: %v, got: %v", nil, err)
+			}
+
+			got, err := Exif.Decode(updated)
+			if err != nil {
+				t.Fatalf("want error: %v, got: %v", nil, err)
+			}
+			if _, ok := got["0xC000"]; ok || got["Artist"] != "Someone" || got["Make"] != "Nik" {
+				t.Errorf("want the opaque entry dropped, got: %v", got)
+			}
+
+			parsed, err := parseTiff(updated)
+			if err != nil {
+				t.Fatalf("want error: %v, got: %v", nil, err)
+			}
+			if want := [][]byte{[]byte("abc"), []byte("de")}; len(parsed.strips) != 2 ||
+				!bytes.Equal(parsed.strips[0], want[0]) || !bytes.Equal(parsed.strips[1], want[1]) {
+				t.Errorf("want strips: %q, got: %q", want, parsed.strips)
+			}
+		})
+	}
+}
+
+func Test_Exif_Update_OutOfLineOpaque(t *testing.T) {
+	order := binary.LittleEndian
+	entry := func(tag, typ uint16, count, value uint32) []byte {
+		b := order.AppendUint16(nil, tag)
+		b = order.AppendUint16(b, typ)
+		b = order.AppendUint32(b, count)
+		return order.AppendUint32(b, value)
+	}
+
+	// IFD0 with an unknown type entry and maker notes, both stored after it
+	data := []byte("II\x2A\x00\x08\x00\x00\x00")
+	data = order.AppendUint16(data, 3)
+	data = append(data, entry(0x010F, typeASCII, 4, 0x006B694E)...)
+	data = append(data, entry(0xC001, 99, 6, 50)...)
+	data = append(data, entry(tagMakerNote, typeUndefined, 8, 56)...)
+	data = order.AppendUint32(data, 0)
+	data = append(data, "opaque"...)
+	data = append(data, "makernot"...)
+
+	got, err := Exif.Decode(data)
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if got["0x927C"] != "makernot" {
+		t.Errorf("want the maker notes decoded, got: %v", got)
+	}
+
+	updated, err := Exif.Update(data, map[string]string{"Artist": "Someone"})
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	got, err = Exif.Decode(updated)
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	want := map[string]string{"Make": "Nik", "Artist": "Someone"}
+	if !maps.Equal(got, want) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+}
+
+func Test_Exif_Delete(t *testing.T) {
+	thumbnail := []byte{0xFF, 0xD8, 0xFF, 0xD9}
+	updated, err := Exif.Delete(testTiff(binary.BigEndian, thumbnail), "Make", "0x829A", "GPSLatitudeRef", "missing")
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+
+	got, err := Exif.Decode(updated)
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	for _, deleted := range []string{"Make", "ExposureTime", "GPSLatitudeRef"} {
+		if _, ok := got[deleted]; ok {
+			t.Errorf("%s not deleted: %v", deleted, got)
+		}
+	}
+	if got["Orientation"] != "6" || got["DateTimeOriginal"] != "2020:01:02 03:04:05" {
+		t.Errorf("unrelated tags changed: %v", got)
+	}
+
+	encoded, _ := Exif.Encode(map[string]string{"Artist": "a"})
+	empty, err := Exif.Delete(encoded, "Artist")
+	if err != nil || empty != nil {
+		t.Errorf("want: %v, %v, got: %v, %v", nil, nil, empty, err)
+	}
+}
+
+func Test_Exif_Update_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		fields  map[string]string
+		wantErr error
+	}{
+		{name: "not writable", fields: map[string]string{"ExposureTime": "1/2"}, wantErr: ErrTagNotWritable},
+		{name: "unknown", fields: map[string]string{"Unknown": "x"}, wantErr: ErrTagNotWritable},
+		{name: "not a number", fields: map[string]string{"Orientation": "up"}, wantErr: ErrInvalidValue},
+		{name: "nul in ascii", fields: map[string]string{"Artist": "a\x00b"}, wantErr: ErrInvalidValue},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Exif.Encode(tt.fields); !errors.Is(err, tt.wantErr) {
+				t.Errorf("want error: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func Test_Exif_Encode(t *testing.T) {
+	data, err := Exif.Encode(map[string]string{"Artist": "a", "DateTimeOriginal": "2020:01:01 00:00:00"})
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+
+	got, err := Exif.Decode(data)
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if len(got) != 2 || got["Artist"] != "a" || got["DateTimeOriginal"] != "2020:01:01 00:00:00" {
+		t.Errorf("wrong fields: %v", got)
+	}
+}
+
+func Test_Exif_Normalize(t *testing.T) {
+	tests := []struct {
+		field string
+		want  string
+	}{
+		{field: "Artist", want: "Artist"},
+		{field: "315", want: "Artist"},
+		{field: "0x013B", want: "Artist"},
+		{field: "0x013b", want: "Artist"},
+		{field: "0x9003", want: "DateTimeOriginal"},
+		{field: "0xBEEF", want: "0xBEEF"},
+		{field: "70000", want: "70000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			if got := Exif.Normalize(tt.field); got != tt.want {
+				t.Errorf("want: %v, got: %v", tt.want, got)
+			}
+		})
+	}
+}
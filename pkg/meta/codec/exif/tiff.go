@@ -0,0 +1,447 @@
+package exif
+
+import (
+	"encoding/binary"
+	"slices"
+)
+
+const (
+	tiffHeaderSize = 8
+	ifdEntrySize   = 12
+	// a sane upper bound, a garbage count would allocate a lot otherwise
+	maxIFDEntries = 1 << 12
+)
+
+type entry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+	// opaque values can't be moved, their size is unknown or they hold
+	// offsets into the file, so they're dropped on write
+	opaque bool
+}
+
+// offsetTags hold offsets into the file in their value.
+var offsetTags = []uint16{tagMakerNote}
+
+type ifd struct {
+	entries []entry
+}
+
+func (d *ifd) get(tag uint16) (entry, bool) {
+	for _, e := range d.entries {
+		if e.tag == tag {
+			return e, true
+		}
+	}
+	return entry{}, false
+}
+
+func (d *ifd) set(e entry) {
+	for i := range d.entries {
+		if d.entries[i].tag == e.tag {
+			d.entries[i] = e
+			return
+		}
+	}
+	d.entries = append(d.entries, e)
+}
+
+func (d *ifd) remove(tag uint16) bool {
+	for i := range d.entries {
+		if d.entries[i].tag == tag {
+			d.entries = slices.Delete(d.entries, i, i+1)
+			return true
+		}
+	}
+	return false
+}
+
+// tiff keeps the sub-IFD pointers and the thumbnail location out of the
+// entries, they are recomputed on every write. A thumbnail is either a
+// JPEG or the strips of an uncompressed image.
+type tiff struct {
+	order     binary.ByteOrder
+	ifds      map[ifdKind]*ifd
+	thumbnail []byte
+	strips    [][]byte
+}
+
+func newTiff() *tiff {
+	return &tiff{
+		order: binary.BigEndian,
+		ifds:  map[ifdKind]*ifd{ifd0: {}},
+	}
+}
+
+// written reports whether the IFD is serialized, IFD0 is mandatory and
+// the rest is only written when it holds anything.
+func (t *tiff) written(kind ifdKind) bool {
+	switch kind {
+	case ifd0:
+		return true
+	case ifdExif:
+		return t.hasEntries(ifdExif) || t.hasEntries(ifdInterop)
+	case ifd1:
+		return t.hasEntries(ifd1) || t.thumbnail != nil || t.strips != nil
+	}
+	return t.hasEntries(kind)
+}
+
+func (t *tiff) hasEntries(kind ifdKind) bool {
+	d, ok := t.ifds[kind]
+	return ok && slices.ContainsFunc(d.entries, func(e entry) bool { return !e.opaque })
+}
+
+func (t *tiff) empty() bool {
+	for _, d := range t.ifds {
+		if len(d.entries) > 0 {
+			return false
+		}
+	}
+	return t.thumbnail == nil && t.strips == nil
+}
+
+func parseTiff(data []byte) (*tiff, error) {
+	if len(data) < tiffHeaderSize {
+		return nil, ErrCorruptedExif
+	}
+
+	t := &tiff{ifds: map[ifdKind]*ifd{}}
+	switch string(data[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, ErrCorruptedExif
+	}
+	if t.order.Uint16(data[2:4]) != 42 {
+		return nil, ErrCorruptedExif
+	}
+
+	p := parser{data: data, order: t.order, seen: map[uint32]bool{}}
+	d0, next, err := p.readIFD(t.order.Uint32(data[4:8]))
+	if err != nil {
+		return nil, err
+	}
+	t.ifds[ifd0] = d0
+
+	subIFDs := []struct {
+		parent  ifdKind
+		pointer uint16
+		kind    ifdKind
+	}{
+		{ifd0, tagExifIFD, ifdExif},
+		{ifd0, tagGPSIFD, ifdGPS},
+		{ifdExif, tagInteropIFD, ifdInterop},
+	}
+	for _, sub := range subIFDs {
+		parent, ok := t.ifds[sub.parent]
+		if !ok {
+			continue
+		}
+		e, ok := parent.get(sub.pointer)
+		if !ok {
+			continue
+		}
+		parent.remove(sub.pointer)
+		if len(e.value) < 4 {
+			return nil, ErrCorruptedExif
+		}
+		d, _, err := p.readIFD(t.order.Uint32(e.value))
+		if err != nil {
+			return nil, err
+		}
+		t.ifds[sub.kind] = d
+	}
+
+	if next != 0 {
+		d1, _, err := p.readIFD(next)
+		if err != nil {
+			return nil, err
+		}
+		if err := t.readThumbnail(d1, data); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// readThumbnail takes the thumbnail data out of the file, so it's written
+// back wherever IFD1 points to it.
+func (t *tiff) readThumbnail(d1 *ifd, data []byte) error {
+	t.ifds[ifd1] = d1
+	if offsets, ok := d1.get(tagStripOffsets); ok {
+		return t.readStrips(d1, offsets, data)
+	}
+
+	offset, okOffset := d1.get(tagThumbOffset)
+	length, okLength := d1.get(tagThumbLength)
+	if !okOffset || !okLength {
+		return nil
+	}
+	d1.remove(tagThumbOffset)
+	d1.remove(tagThumbLength)
+
+	start, ok := entryUint(offset, t.order)
+	if !ok {
+		return ErrCorruptedExif
+	}
+	size, ok := entryUint(length, t.order)
+	if !ok {
+		return ErrCorruptedExif
+	}
+	if uint64(start)+uint64(size) > uint64(len(data)) {
+		return ErrCorruptedExif
+	}
+	t.thumbnail = data[start : start+size]
+	return nil
+}
+
+func (t *tiff) readStrips(d1 *ifd, offsets entry, data []byte) error {
+	counts, ok := d1.get(tagStripByteCount)
+	if !ok {
+		return ErrCorruptedExif
+	}
+	starts, okStarts := entryUints(offsets, t.order)
+	sizes, okSizes := entryUints(counts, t.order)
+	if !okStarts || !okSizes || len(starts) != len(sizes) {
+		return ErrCorruptedExif
+	}
+	d1.remove(tagStripOffsets)
+
+	t.strips = make([][]byte, len(starts))
+	for i, start := range starts {
+		if uint64(start)+uint64(sizes[i]) > uint64(len(data)) {
+			return ErrCorruptedExif
+		}
+		t.strips[i] = data[start : start+sizes[i]]
+	}
+	return nil
+}
+
+type parser struct {
+	data  []byte
+	order binary.ByteOrder
+	seen  map[uint32]bool
+}
+
+func (p *parser) readIFD(offset uint32) (*ifd, uint32, error) {
+	if p.seen[offset] {
+		return nil, 0, ErrCorruptedExif
+	}
+	p.seen[offset] = true
+
+	if uint64(offset)+2 > uint64(len(p.data)) {
+		return nil, 0, ErrCorruptedExif
+	}
+	count := int(p.order.Uint16(p.data[offset:]))
+	if count > maxIFDEntries {
+		return nil, 0, ErrCorruptedExif
+	}
+
+	start := int(offset) + 2
+	end := start + count*ifdEntrySize
+	if end+4 > len(p.data) {
+		return nil, 0, ErrCorruptedExif
+	}
+
+	d := &ifd{entries: make([]entry, 0, count)}
+	for i := start; i < end; i += ifdEntrySize {
+		raw := p.data[i : i+ifdEntrySize]
+		e := entry{
+			tag:   p.order.Uint16(raw[0:2]),
+			typ:   p.order.Uint16(raw[2:4]),
+			count: p.order.Uint32(raw[4:8]),
+		}
+
+		typeSize, ok := typeSizes[e.typ]
+		if !ok {
+			// unknown types can't be sized, the value is read as is
+			e.value = append([]byte{}, raw[8:12]...)
+			e.opaque = true
+			d.entries = append(d.entries, e)
+			continue
+		}
+		e.opaque = slices.Contains(offsetTags, e.tag)
+
+		size := uint64(typeSize) * uint64(e.count)
+		if size <= 4 {
+			e.value = append([]byte{}, raw[8:8+size]...)
+		} else {
+			valueOffset := uint64(p.order.Uint32(raw[8:12]))
+			if valueOffset+size > uint64(len(p.data)) {
+				return nil, 0, ErrCorruptedExif
+			}
+			e.value = append([]byte{}, p.data[valueOffset:valueOffset+size]...)
+		}
+		d.entries = append(d.entries, e)
+	}
+
+	next := p.order.Uint32(p.data[end : end+4])
+	return d, next, nil
+}
+
+func (t *tiff) bytes() []byte {
+	type block struct {
+		kind    ifdKind
+		entries []entry
+		offset  uint32
+		size    uint32
+	}
+
+	kinds := []ifdKind{ifd0, ifdExif, ifdInterop, ifdGPS, ifd1}
+	blocks := make([]*block, 0, len(kinds))
+	byKind := make(map[ifdKind]*block, len(kinds))
+	for _, kind := range kinds {
+		d, ok := t.ifds[kind]
+		if !ok {
+			continue
+		}
+		if !t.written(kind) {
+			continue
+		}
+		entries := slices.DeleteFunc(slices.Clone(d.entries), func(e entry) bool { return e.opaque })
+		b := &block{kind: kind, entries: entries}
+		blocks = append(blocks, b)
+		byKind[kind] = b
+	}
+
+	// pointer placeholders first, so they are accounted in the block sizes
+	pointer := func(parent ifdKind, tag uint16) {
+		if b, ok := byKind[parent]; ok {
+			b.entries = append(b.entries, entry{tag: tag, typ: typeLong, count: 1, value: make([]byte, 4)})
+		}
+	}
+	if _, ok := byKind[ifdExif]; ok {
+		pointer(ifd0, tagExifIFD)
+	}
+	if _, ok := byKind[ifdGPS]; ok {
+		pointer(ifd0, tagGPSIFD)
+	}
+	if _, ok := byKind[ifdInterop]; ok {
+		pointer(ifdExif, tagInteropIFD)
+	}
+	if t.thumbnail != nil {
+		pointer(ifd1, tagThumbOffset)
+		pointer(ifd1, tagThumbLength)
+	}
+	if b, ok := byKind[ifd1]; ok && t.strips != nil {
+		count := len(t.strips)
+		b.entries = append(b.entries, entry{tag: tagStripOffsets, typ: typeLong, count: uint32(count), value: make([]byte, 4*count)})
+	}
+
+	offset := uint32(tiffHeaderSize)
+	for _, b := range blocks {
+		slices.SortFunc(b.entries, func(a, b entry) int { return int(a.tag) - int(b.tag) })
+		b.offset = offset
+		b.size = uint32(2 + len(b.entries)*ifdEntrySize + 4)
+		for _, e := range b.entries {
+			if len(e.value) > 4 {
+				b.size += uint32(len(e.value) + len(e.value)%2)
+			}
+		}
+		offset += b.size
+	}
+	thumbnailOffset := offset
+
+	setPointer := func(parent ifdKind, tag uint16, value uint32) {
+		b := byKind[parent]
+		for i := range b.entries {
+			if b.entries[i].tag == tag {
+				t.order.PutUint32(b.entries[i].value, value)
+			}
+		}
+	}
+	if b, ok := byKind[ifdExif]; ok {
+		setPointer(ifd0, tagExifIFD, b.offset)
+	}
+	if b, ok := byKind[ifdGPS]; ok {
+		setPointer(ifd0, tagGPSIFD, b.offset)
+	}
+	if b, ok := byKind[ifdInterop]; ok {
+		setPointer(ifdExif, tagInteropIFD, b.offset)
+	}
+	if t.thumbnail != nil {
+		setPointer(ifd1, tagThumbOffset, thumbnailOffset)
+		setPointer(ifd1, tagThumbLength, uint32(len(t.thumbnail)))
+	}
+	stripsOffset := thumbnailOffset + uint32(len(t.thumbnail))
+	end := stripsOffset
+	if b, ok := byKind[ifd1]; ok && t.strips != nil {
+		i := slices.IndexFunc(b.entries, func(e entry) bool { return e.tag == tagStripOffsets })
+		for j, strip := range t.strips {
+			t.order.PutUint32(b.entries[i].value[4*j:], end)
+			end += uint32(len(strip))
+		}
+	}
+
+	out := make([]byte, end)
+	if t.order == binary.LittleEndian {
+		copy(out, "II")
+	} else {
+		copy(out, "MM")
+	}
+	t.order.PutUint16(out[2:4], 42)
+	t.order.PutUint32(out[4:8], tiffHeaderSize)
+
+	for _, b := range blocks {
+		t.order.PutUint16(out[b.offset:], uint16(len(b.entries)))
+		pos := b.offset + 2
+		dataPos := pos + uint32(len(b.entries)*ifdEntrySize) + 4
+		for _, e := range b.entries {
+			t.order.PutUint16(out[pos:], e.tag)
+			t.order.PutUint16(out[pos+2:], e.typ)
+			t.order.PutUint32(out[pos+4:], e.count)
+			if len(e.value) <= 4 {
+				copy(out[pos+8:pos+12], e.value)
+			} else {
+				t.order.PutUint32(out[pos+8:], dataPos)
+				copy(out[dataPos:], e.value)
+				dataPos += uint32(len(e.value) + len(e.value)%2)
+			}
+			pos += ifdEntrySize
+		}
+
+		// only IFD0 links to the next one
+		if b.kind == ifd0 {
+			if b1, ok := byKind[ifd1]; ok {
+				t.order.PutUint32(out[pos:], b1.offset)
+			}
+		}
+	}
+	copy(out[thumbnailOffset:], t.thumbnail)
+	pos := stripsOffset
+	for _, strip := range t.strips {
+		pos += uint32(copy(out[pos:], strip))
+	}
+	return out
+}
+
+func entryUint(e entry, order binary.ByteOrder) (uint32, bool) {
+	values, ok := entryUints(e, order)
+	if !ok || len(values) == 0 {
+		return 0, false
+	}
+	return values[0], true
+}
+
+// entryUints returns the values of a SHORT or LONG entry.
+func entryUints(e entry, order binary.ByteOrder) ([]uint32, bool) {
+	var values []uint32
+	switch e.typ {
+	case typeShort:
+		for i := 0; i+2 <= len(e.value); i += 2 {
+			values = append(values, uint32(order.Uint16(e.value[i:])))
+		}
+	case typeLong:
+		for i := 0; i+4 <= len(e.value); i += 4 {
+			values = append(values, order.Uint32(e.value[i:]))
+		}
+	default:
+		return nil, false
+	}
+	return values, true
+}
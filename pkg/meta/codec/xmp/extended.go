@@ -0,0 +1,168 @@
+package xmp
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"slices"
+	"strings"
+)
+
+const extendedTemplate = `<x:xmpmeta xmlns:x="adobe:ns:meta/">` +
+	`<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` +
+	`<rdf:Description rdf:about=""/>` +
+	`</rdf:RDF>` +
+	`</x:xmpmeta>`
+
+// GUIDSize is the length of the hex MD5 digest identifying an ExtendedXMP.
+const GUIDSize = 32
+
+var ErrPacketTooLarge = errors.New("xmp packet too large")
+
+var extendedProperty = property{Namespaces["xmpNote"], "HasExtendedXMP"}
+
+// ExtendedGUID returns the GUID of the ExtendedXMP the standard packet
+// refers to.
+func ExtendedGUID(standard []byte) (string, bool) {
+	root, err := parseTree(standard)
+	if err != nil {
+		return "", false
+	}
+	rdf := root.find(rdfNS, "RDF")
+	if rdf == nil {
+		return "", false
+	}
+
+	for _, desc := range descriptions(rdf) {
+		if i, ok := desc.attr(extendedProperty.uri, extendedProperty.local); ok {
+			return desc.attrs[i].Value, true
+		}
+		for _, el := range desc.elements() {
+			if el.is(extendedProperty.uri, extendedProperty.local) {
+				return el.textContent(), true
+			}
+		}
+	}
+	return "", false
+}
+
+// Split moves the largest properties out of the packet until it fits into
+// maxSize. The moved ones make up the extended packet, which is referred to
+// by its GUID from the standard one.
+func Split(packet []byte, maxSize int) ([]byte, []byte, string, error) {
+	root, err := parseTree(packet)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	rdf := root.find(rdfNS, "RDF")
+	if rdf == nil {
+		return nil, nil, "", ErrCorruptedXMP
+	}
+	descs := descriptions(rdf)
+	if len(descs) == 0 {
+		return nil, nil, "", ErrCorruptedXMP
+	}
+
+	ext, err := parseTree([]byte(extendedTemplate))
+	if err != nil {
+		return nil, nil, "", err
+	}
+	extDesc := descriptions(ext.find(rdfNS, "RDF"))[0]
+
+	// the final GUID has the same length, so the size check holds
+	if err := setProperty(rdf, descs, "xmpNote:HasExtendedXMP", strings.Repeat("0", GUIDSize)); err != nil {
+		return nil, nil, "", err
+	}
+
+	type candidate struct {
+		desc *node
+		el   *node
+		size int
+	}
+	var candidates []candidate
+	for _, desc := range descs {
+		for _, el := range desc.elements() {
+			if el.is(extendedProperty.uri, extendedProperty.local) {
+				continue
+			}
+			candidates = append(candidates, candidate{desc, el, len(el.bytes())})
+		}
+	}
+	slices.SortStableFunc(candidates, func(a, b candidate) int { return b.size - a.size })
+
+	for len(root.bytes()) > maxSize {
+		if len(candidates) == 0 {
+			return nil, nil, "", ErrPacketTooLarge
+		}
+		c := candidates[0]
+		candidates = candidates[1:]
+
+		c.desc.children = slices.DeleteFunc(c.desc.children, func(n *node) bool { return n == c.el })
+		declareScope(extDesc, c.desc)
+		extDesc.append(c.el)
+	}
+
+	extended := ext.bytes()
+	sum := md5.Sum(extended)
+	guid := strings.ToUpper(hex.EncodeToString(sum[:]))
+	if err := setProperty(rdf, descs, "xmpNote:HasExtendedXMP", guid); err != nil {
+		return nil, nil, "", err
+	}
+	return root.bytes(), extended, guid, nil
+}
+
+// Merge folds the extended packet descriptions into the standard one,
+// dropping the reference to the extended packet.
+func Merge(standard, extended []byte) ([]byte, error) {
+	root, err := parseTree(standard)
+	if err != nil {
+		return nil, err
+	}
+	rdf := root.find(rdfNS, "RDF")
+	if rdf == nil {
+		return nil, ErrCorruptedXMP
+	}
+
+	ext, err := parseTree(extended)
+	if err != nil {
+		return nil, err
+	}
+	extRDF := ext.find(rdfNS, "RDF")
+	if extRDF == nil {
+		return nil, ErrCorruptedXMP
+	}
+
+	for _, desc := range descriptions(rdf) {
+		if i, ok := desc.attr(extendedProperty.uri, extendedProperty.local); ok {
+			desc.attrs = slices.Delete(desc.attrs, i, i+1)
+		}
+		desc.children = slices.DeleteFunc(desc.children, func(n *node) bool {
+			return n.is(extendedProperty.uri, extendedProperty.local)
+		})
+	}
+
+	for _, desc := range descriptions(extRDF) {
+		declareScope(desc, desc.parent)
+		rdf.append(desc)
+	}
+	return root.bytes(), nil
+}
+
+// declareScope copies the namespace declarations visible from src onto dst,
+// so nodes moved between trees keep resolving their prefixes.
+func declareScope(dst *node, src *node) {
+	for cur := src; cur != nil; cur = cur.parent {
+		for _, a := range cur.attrs {
+			if a.Name.Space != "xmlns" {
+				continue
+			}
+			declared := slices.ContainsFunc(dst.attrs, func(d xml.Attr) bool {
+				return d.Name == a.Name
+			})
+			if !declared {
+				dst.attrs = append(dst.attrs, a)
+			}
+		}
+	}
+}
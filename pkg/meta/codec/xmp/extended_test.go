@@ -0,0 +1,63 @@
+package xmp
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"maps"
+	"strings"
+	"testing"
+)
+
+func Test_Split(t *testing.T) {
+	large := strings.Repeat("d", 2000)
+	packet, _ := XMP.Encode(map[string]string{
+		"dc:title":       "T",
+		"dc:description": large,
+		"xmp:Rating":     "5",
+	})
+
+	standard, extended, guid, err := Split(packet, 1000)
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if len(standard) > 1000 {
+		t.Errorf("standard packet too large: %d", len(standard))
+	}
+
+	sum := md5.Sum(extended)
+	if want := strings.ToUpper(hex.EncodeToString(sum[:])); guid != want {
+		t.Errorf("want guid: %v, got: %v", want, guid)
+	}
+	if got, ok := ExtendedGUID(standard); !ok || got != guid {
+		t.Errorf("want guid: %v, got: %v", guid, got)
+	}
+
+	std, _ := XMP.Decode(standard)
+	if std["dc:title"] != "T" || std["dc:description"] != "" {
+		t.Errorf("wrong standard fields: %v", std)
+	}
+	ext, _ := XMP.Decode(extended)
+	if ext["dc:description"] != large {
+		t.Errorf("description not moved to the extended packet")
+	}
+
+	merged, err := Merge(standard, extended)
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	got, _ := XMP.Decode(merged)
+	want := map[string]string{"dc:title": "T", "dc:description": large, "xmp:Rating": "5"}
+	if !maps.Equal(got, want) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+	if _, ok := ExtendedGUID(merged); ok {
+		t.Errorf("merged packet still refers to the extended one")
+	}
+}
+
+func Test_Split_TooLarge(t *testing.T) {
+	packet, _ := XMP.Encode(map[string]string{"xmp:Rating": "5"})
+	if _, _, _, err := Split(packet, 10); err != ErrPacketTooLarge {
+		t.Errorf("want error: %v, got: %v", ErrPacketTooLarge, err)
+	}
+}
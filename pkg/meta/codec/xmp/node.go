@@ -0,0 +1,227 @@
+package xmp
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+const xmlNS = "http://www.w3.org/XML/1998/namespace"
+
+// whitespace between elements is written back as is, only the characters
+// that would break the markup are escaped
+var (
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+)
+
+type nodeKind int
+
+const (
+	kindDocument nodeKind = iota
+	kindElement
+	kindText
+	kindComment
+	kindProcInst
+	kindDirective
+)
+
+// node is a namespace-unaware XML tree, prefixes are kept exactly as they
+// were written so unknown namespaces survive a round-trip untouched.
+type node struct {
+	kind     nodeKind
+	name     xml.Name
+	attrs    []xml.Attr
+	text     string
+	parent   *node
+	children []*node
+}
+
+func parseTree(data []byte) (*node, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = true
+
+	root := &node{kind: kindDocument}
+	cur := root
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, ErrCorruptedXMP
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &node{kind: kindElement, name: t.Name, attrs: t.Copy().Attr}
+			cur.append(n)
+			cur = n
+		case xml.EndElement:
+			if cur.kind != kindElement || cur.name != t.Name {
+				return nil, ErrCorruptedXMP
+			}
+			cur = cur.parent
+		case xml.CharData:
+			cur.append(&node{kind: kindText, text: string(t)})
+		case xml.Comment:
+			cur.append(&node{kind: kindComment, text: string(t)})
+		case xml.ProcInst:
+			cur.append(&node{kind: kindProcInst, name: xml.Name{Local: t.Target}, text: string(t.Inst)})
+		case xml.Directive:
+			cur.append(&node{kind: kindDirective, text: string(t)})
+		}
+	}
+	if cur != root {
+		return nil, ErrCorruptedXMP
+	}
+	return root, nil
+}
+
+func (n *node) append(child *node) {
+	child.parent = n
+	n.children = append(n.children, child)
+}
+
+// lookup resolves a prefix to its namespace URI in the scope of n.
+func (n *node) lookup(prefix string) (string, bool) {
+	if prefix == "xml" {
+		return xmlNS, true
+	}
+	for cur := n; cur != nil; cur = cur.parent {
+		for _, a := range cur.attrs {
+			if prefix == "" && a.Name.Space == "" && a.Name.Local == "xmlns" {
+				return a.Value, true
+			}
+			if a.Name.Space == "xmlns" && a.Name.Local == prefix {
+				return a.Value, true
+			}
+		}
+	}
+	return "", false
+}
+
+func (n *node) is(uri, local string) bool {
+	if n.kind != kindElement || n.name.Local != local {
+		return false
+	}
+	ns, _ := n.lookup(n.name.Space)
+	return ns == uri
+}
+
+// unprefixed attributes don't take the default namespace
+func (n *node) attrIs(a xml.Attr, uri, local string) bool {
+	if a.Name.Local != local || a.Name.Space == "" {
+		return false
+	}
+	ns, _ := n.lookup(a.Name.Space)
+	return ns == uri
+}
+
+func (n *node) attr(uri, local string) (int, bool) {
+	for i, a := range n.attrs {
+		if n.attrIs(a, uri, local) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func (n *node) elements() []*node {
+	var els []*node
+	for _, c := range n.children {
+		if c.kind == kindElement {
+			els = append(els, c)
+		}
+	}
+	return els
+}
+
+func (n *node) find(uri, local string) *node {
+	for _, c := range n.children {
+		if c.is(uri, local) {
+			return c
+		}
+		if found := c.find(uri, local); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func (n *node) textContent() string {
+	var sb strings.Builder
+	for _, c := range n.children {
+		if c.kind == kindText {
+			sb.WriteString(c.text)
+		}
+	}
+	return sb.String()
+}
+
+func (n *node) setText(text string) {
+	n.children = nil
+	n.append(&node{kind: kindText, text: text})
+}
+
+func (n *node) bytes() []byte {
+	var buf bytes.Buffer
+	n.write(&buf)
+	return buf.Bytes()
+}
+
+func (n *node) write(buf *bytes.Buffer) {
+	switch n.kind {
+	case kindDocument:
+		for _, c := range n.children {
+			c.write(buf)
+		}
+	case kindElement:
+		buf.WriteByte('<')
+		buf.WriteString(qname(n.name))
+		for _, a := range n.attrs {
+			buf.WriteByte(' ')
+			buf.WriteString(qname(a.Name))
+			buf.WriteString(`="`)
+			buf.WriteString(attrEscaper.Replace(a.Value))
+			buf.WriteByte('"')
+		}
+		if len(n.children) == 0 {
+			buf.WriteString("/>")
+			return
+		}
+		buf.WriteByte('>')
+		for _, c := range n.children {
+			c.write(buf)
+		}
+		buf.WriteString("</")
+		buf.WriteString(qname(n.name))
+		buf.WriteByte('>')
+	case kindText:
+		buf.WriteString(textEscaper.Replace(n.text))
+	case kindComment:
+		buf.WriteString("<!--")
+		buf.WriteString(n.text)
+		buf.WriteString("-->")
+	case kindProcInst:
+		buf.WriteString("<?")
+		buf.WriteString(n.name.Local)
+		if n.text != "" {
+			buf.WriteByte(' ')
+			buf.WriteString(n.text)
+		}
+		buf.WriteString("?>")
+	case kindDirective:
+		buf.WriteString("<!")
+		buf.WriteString(n.text)
+		buf.WriteByte('>')
+	}
+}
+
+func qname(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
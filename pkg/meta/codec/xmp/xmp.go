@@ -0,0 +1,377 @@
+package xmp
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/zzvanq/tinymedia/pkg/meta"
+)
+
+const (
+	rdfNS = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+
+	// ListSeparator joins the items of rdf:Bag and rdf:Seq values.
+	ListSeparator = "; "
+)
+
+const packetTemplate = "<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>" +
+	`<x:xmpmeta xmlns:x="adobe:ns:meta/">` +
+	`<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` +
+	`<rdf:Description rdf:about=""/>` +
+	`</rdf:RDF>` +
+	`</x:xmpmeta>` +
+	`<?xpacket end="w"?>`
+
+var (
+	ErrCorruptedXMP     = fmt.Errorf("%w xmp", meta.ErrCorrupted)
+	ErrInvalidProperty  = errors.New("invalid property name")
+	ErrUnknownNamespace = errors.New("unknown namespace")
+)
+
+// Namespaces are declared on demand when a property with one of these
+// prefixes is written and the packet doesn't declare the prefix yet.
+var Namespaces = map[string]string{
+	"dc":           "http://purl.org/dc/elements/1.1/",
+	"xmp":          "http://ns.adobe.com/xap/1.0/",
+	"xmpRights":    "http://ns.adobe.com/xap/1.0/rights/",
+	"xmpMM":        "http://ns.adobe.com/xap/1.0/mm/",
+	"xmpNote":      "http://ns.adobe.com/xmp/note/",
+	"photoshop":    "http://ns.adobe.com/photoshop/1.0/",
+	"Iptc4xmpCore": "http://iptc.org/std/Iptc4xmpCore/1.0/xmlns/",
+	"exif":         "http://ns.adobe.com/exif/1.0/",
+	"tiff":         "http://ns.adobe.com/tiff/1.0/",
+	"lr":           "http://ns.adobe.com/lightroom/1.0/",
+}
+
+type property struct {
+	uri   string
+	local string
+}
+
+// arrayProperties are written as RDF containers, the rest as simple values.
+var arrayProperties = map[property]string{
+	{Namespaces["dc"], "title"}:                         "Alt",
+	{Namespaces["dc"], "description"}:                   "Alt",
+	{Namespaces["dc"], "rights"}:                        "Alt",
+	{Namespaces["xmpRights"], "UsageTerms"}:             "Alt",
+	{Namespaces["dc"], "creator"}:                       "Seq",
+	{Namespaces["dc"], "date"}:                          "Seq",
+	{Namespaces["dc"], "subject"}:                       "Bag",
+	{Namespaces["dc"], "publisher"}:                     "Bag",
+	{Namespaces["dc"], "contributor"}:                   "Bag",
+	{Namespaces["dc"], "language"}:                      "Bag",
+	{Namespaces["dc"], "type"}:                          "Bag",
+	{Namespaces["lr"], "hierarchicalSubject"}:           "Bag",
+	{Namespaces["photoshop"], "SupplementalCategories"}: "Bag",
+}
+
+type xmp struct{}
+
+// XMP maps qualified property names, e.g. "dc:title", to their values.
+// Structured properties are left out of the decoded fields, but like
+// everything else the codec doesn't touch they are kept on update.
+// The URIs of the prefixes missing from Namespaces are read apart by
+// Namespaces, so the properties can be written elsewhere.
+var XMP = xmp{}
+
+func (x xmp) Encode(fields map[string]string) ([]byte, error) {
+	return x.Update(nil, fields)
+}
+
+func (x xmp) Decode(data []byte) (map[string]string, error) {
+	fields, _, err := decode(data)
+	return fields, err
+}
+
+// Namespaces returns the URIs of the prefixes of the decoded properties
+// which are missing from Namespaces or declared with another URI.
+func (x xmp) Namespaces(data []byte) (map[string]string, error) {
+	_, namespaces, err := decode(data)
+	return namespaces, err
+}
+
+func decode(data []byte) (map[string]string, map[string]string, error) {
+	root, err := parseTree(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rdf := root.find(rdfNS, "RDF")
+	if rdf == nil {
+		return nil, nil, ErrCorruptedXMP
+	}
+
+	fields := make(map[string]string)
+	namespaces := make(map[string]string)
+	declare := func(n *node, prefix string) {
+		if uri, ok := n.lookup(prefix); ok && uri != Namespaces[prefix] {
+			namespaces[prefix] = uri
+		}
+	}
+	for _, desc := range descriptions(rdf) {
+		for _, a := range desc.attrs {
+			if isPropertyAttr(desc, a) {
+				fields[qname(a.Name)] = a.Value
+				declare(desc, a.Name.Space)
+			}
+		}
+		for _, el := range desc.elements() {
+			if v, ok := propertyValue(el); ok {
+				fields[qname(el.name)] = v
+				declare(el, el.name.Space)
+			}
+		}
+	}
+	return fields, namespaces, nil
+}
+
+func (x xmp) Update(data []byte, fields map[string]string) ([]byte, error) {
+	return x.UpdateNamespaces(data, fields, nil)
+}
+
+// UpdateNamespaces is Update declaring the prefixes of namespaces the
+// packet misses, as returned by Namespaces for another packet.
+func (x xmp) UpdateNamespaces(data []byte, fields, namespaces map[string]string) ([]byte, error) {
+	if len(data) == 0 {
+		data = []byte(packetTemplate)
+	}
+
+	root, err := parseTree(data)
+	if err != nil {
+		return nil, err
+	}
+
+	rdf := root.find(rdfNS, "RDF")
+	if rdf == nil {
+		return nil, ErrCorruptedXMP
+	}
+
+	descs := descriptions(rdf)
+	if len(descs) == 0 {
+		desc := &node{
+			kind:  kindElement,
+			name:  xml.Name{Space: rdf.name.Space, Local: "Description"},
+			attrs: []xml.Attr{{Name: xml.Name{Space: rdf.name.Space, Local: "about"}}},
+		}
+		rdf.append(desc)
+		descs = append(descs, desc)
+	}
+
+	// the prefixes are declared before the properties using them
+	for _, prefix := range slices.Sorted(maps.Keys(namespaces)) {
+		if _, ok := descs[0].lookup(prefix); !ok {
+			descs[0].attrs = append(descs[0].attrs, xml.Attr{Name: xml.Name{Space: "xmlns", Local: prefix}, Value: namespaces[prefix]})
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(fields)) {
+		if err := setProperty(rdf, descs, key, fields[key]); err != nil {
+			return nil, err
+		}
+	}
+	return root.bytes(), nil
+}
+
+func (x xmp) Delete(data []byte, fields ...string) ([]byte, error) {
+	root, err := parseTree(data)
+	if err != nil {
+		return nil, err
+	}
+
+	rdf := root.find(rdfNS, "RDF")
+	if rdf == nil {
+		return nil, ErrCorruptedXMP
+	}
+
+	descs := descriptions(rdf)
+	for _, key := range fields {
+		prefix, local, ok := strings.Cut(key, ":")
+		if !ok {
+			continue
+		}
+		for _, desc := range descs {
+			uri, ok := desc.lookup(prefix)
+			if !ok {
+				uri, ok = Namespaces[prefix]
+			}
+			if !ok {
+				continue
+			}
+
+			desc.attrs = slices.DeleteFunc(desc.attrs, func(a xml.Attr) bool {
+				return desc.attrIs(a, uri, local)
+			})
+			desc.children = slices.DeleteFunc(desc.children, func(n *node) bool {
+				return n.is(uri, local)
+			})
+		}
+	}
+
+	for _, desc := range descs {
+		if len(desc.elements()) > 0 || slices.ContainsFunc(desc.attrs, func(a xml.Attr) bool { return isPropertyAttr(desc, a) }) {
+			return root.bytes(), nil
+		}
+	}
+	return nil, nil
+}
+
+func setProperty(rdf *node, descs []*node, key, value string) error {
+	prefix, local, ok := strings.Cut(key, ":")
+	if !ok || prefix == "" || local == "" || strings.Contains(local, ":") {
+		return fmt.Errorf("%w: %s", ErrInvalidProperty, key)
+	}
+
+	uri, ok := descs[0].lookup(prefix)
+	if !ok {
+		uri, ok = Namespaces[prefix]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownNamespace, prefix)
+		}
+		descs[0].attrs = append(descs[0].attrs, xml.Attr{Name: xml.Name{Space: "xmlns", Local: prefix}, Value: uri})
+	}
+
+	for _, desc := range descs {
+		if i, ok := desc.attr(uri, local); ok {
+			desc.attrs[i].Value = value
+			return nil
+		}
+		for _, el := range desc.elements() {
+			if el.is(uri, local) {
+				setValue(rdf, el, value)
+				return nil
+			}
+		}
+	}
+
+	el := &node{kind: kindElement, name: xml.Name{Space: prefix, Local: local}}
+	descs[0].append(el)
+	if kind, ok := arrayProperties[property{uri, local}]; ok {
+		container := &node{kind: kindElement, name: xml.Name{Space: rdf.name.Space, Local: kind}}
+		el.append(container)
+		fillContainer(rdf, container, value)
+		return nil
+	}
+	el.setText(value)
+	return nil
+}
+
+func setValue(rdf *node, el *node, value string) {
+	if i, ok := el.attr(rdfNS, "resource"); ok {
+		el.attrs[i].Value = value
+		return
+	}
+	if container := containerOf(el); container != nil {
+		fillContainer(rdf, container, value)
+		return
+	}
+	el.setText(value)
+}
+
+func fillContainer(rdf *node, container *node, value string) {
+	if container.name.Local == "Alt" {
+		if li := defaultItem(container); li != nil {
+			li.setText(value)
+			return
+		}
+		li := &node{
+			kind:  kindElement,
+			name:  xml.Name{Space: rdf.name.Space, Local: "li"},
+			attrs: []xml.Attr{{Name: xml.Name{Space: "xml", Local: "lang"}, Value: "x-default"}},
+		}
+		container.append(li)
+		li.setText(value)
+		return
+	}
+
+	container.children = nil
+	if value == "" {
+		return
+	}
+	for _, item := range strings.Split(value, ListSeparator) {
+		li := &node{kind: kindElement, name: xml.Name{Space: rdf.name.Space, Local: "li"}}
+		container.append(li)
+		li.setText(item)
+	}
+}
+
+func propertyValue(el *node) (string, bool) {
+	if i, ok := el.attr(rdfNS, "resource"); ok {
+		return el.attrs[i].Value, true
+	}
+
+	els := el.elements()
+	if len(els) == 0 {
+		return el.textContent(), true
+	}
+
+	container := containerOf(el)
+	if container == nil {
+		return "", false
+	}
+
+	if container.name.Local == "Alt" {
+		li := defaultItem(container)
+		if li == nil {
+			return "", true
+		}
+		return li.textContent(), true
+	}
+
+	var items []string
+	for _, li := range container.elements() {
+		if li.is(rdfNS, "li") {
+			items = append(items, li.textContent())
+		}
+	}
+	return strings.Join(items, ListSeparator), true
+}
+
+func containerOf(el *node) *node {
+	els := el.elements()
+	if len(els) != 1 {
+		return nil
+	}
+	for _, kind := range []string{"Alt", "Bag", "Seq"} {
+		if els[0].is(rdfNS, kind) {
+			return els[0]
+		}
+	}
+	return nil
+}
+
+func defaultItem(alt *node) *node {
+	var first *node
+	for _, li := range alt.elements() {
+		if !li.is(rdfNS, "li") {
+			continue
+		}
+		if first == nil {
+			first = li
+		}
+		if i, ok := li.attr(xmlNS, "lang"); ok && li.attrs[i].Value == "x-default" {
+			return li
+		}
+	}
+	return first
+}
+
+func descriptions(rdf *node) []*node {
+	var descs []*node
+	for _, el := range rdf.elements() {
+		if el.is(rdfNS, "Description") {
+			descs = append(descs, el)
+		}
+	}
+	return descs
+}
+
+func isPropertyAttr(desc *node, a xml.Attr) bool {
+	if a.Name.Space == "" || a.Name.Space == "xmlns" {
+		return false
+	}
+	ns, _ := desc.lookup(a.Name.Space)
+	return ns != rdfNS && ns != xmlNS
+}
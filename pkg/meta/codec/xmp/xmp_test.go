@@ -0,0 +1,215 @@
+package xmp
+
+import (
+	"errors"
+	"maps"
+	"strings"
+	"testing"
+)
+
+const testPacket = "<?xpacket begin=\"\ufeff\"" + ` id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/" x:xmptk="Test">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+    xmlns:acme="http://example.com/acme/1.0/"
+    xmp:Rating="3"
+    acme:Secret="s &amp; t">
+   <dc:title xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <rdf:Alt>
+     <rdf:li xml:lang="en">English</rdf:li>
+     <rdf:li xml:lang="x-default">Default</rdf:li>
+    </rdf:Alt>
+   </dc:title>
+   <acme:Struct rdf:parseType="Resource">
+    <acme:Inner>x</acme:Inner>
+   </acme:Struct>
+  </rdf:Description>
+  <rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/">
+   <dc:subject>
+    <rdf:Bag>
+     <rdf:li>one</rdf:li>
+     <rdf:li>two</rdf:li>
+    </rdf:Bag>
+   </dc:subject>
+   <!-- keep me -->
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`
+
+func Test_XMP_Decode(t *testing.T) {
+	got, err := XMP.Decode([]byte(testPacket))
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+
+	want := map[string]string{
+		"xmp:Rating":  "3",
+		"acme:Secret": "s & t",
+		"dc:title":    "Default",
+		"dc:subject":  "one; two",
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+}
+
+func Test_XMP_Decode_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "not xml", data: "<x:xmpmeta"},
+		{name: "mismatched", data: "<a><b></a></b>"},
+		{name: "no rdf", data: `<x:xmpmeta xmlns:x="adobe:ns:meta/"/>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := XMP.Decode([]byte(tt.data)); err != ErrCorruptedXMP {
+				t.Errorf("want error: %v, got: %v", ErrCorruptedXMP, err)
+			}
+		})
+	}
+}
+
+func Test_XMP_Update(t *testing.T) {
+	updated, err := XMP.Update([]byte(testPacket), map[string]string{
+		"xmp:Rating":     "5",
+		"dc:title":       "New",
+		"dc:subject":     "a; b; c",
+		"dc:creator":     "Someone",
+		"photoshop:City": "Oslo",
+	})
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+
+	got, err := XMP.Decode(updated)
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	want := map[string]string{
+		"xmp:Rating":     "5",
+		"acme:Secret":    "s & t",
+		"dc:title":       "New",
+		"dc:subject":     "a; b; c",
+		"dc:creator":     "Someone",
+		"photoshop:City": "Oslo",
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+
+	for _, keep := range []string{
+		`xmlns:acme="http://example.com/acme/1.0/"`,
+		`<acme:Inner>x</acme:Inner>`,
+		`<rdf:li xml:lang="en">English</rdf:li>`,
+		`<!-- keep me -->`,
+		`x:xmptk="Test"`,
+		`<?xpacket end="w"?>`,
+		`xmlns:photoshop="http://ns.adobe.com/photoshop/1.0/"`,
+		`<dc:creator><rdf:Seq><rdf:li>Someone</rdf:li></rdf:Seq></dc:creator>`,
+	} {
+		if !strings.Contains(string(updated), keep) {
+			t.Errorf("missing %s in:\n%s", keep, updated)
+		}
+	}
+}
+
+func Test_XMP_Delete(t *testing.T) {
+	updated, err := XMP.Delete([]byte(testPacket), "xmp:Rating", "dc:title", "dc:subject", "foo:bar", "nocolon")
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+
+	got, err := XMP.Decode(updated)
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	want := map[string]string{"acme:Secret": "s & t"}
+	if !maps.Equal(got, want) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+	if !strings.Contains(string(updated), `<acme:Inner>x</acme:Inner>`) {
+		t.Errorf("structured property removed:\n%s", updated)
+	}
+
+	encoded, _ := XMP.Encode(map[string]string{"dc:title": "T"})
+	empty, err := XMP.Delete(encoded, "dc:title")
+	if err != nil || empty != nil {
+		t.Errorf("want: %v, %v, got: %v, %v", nil, nil, empty, err)
+	}
+}
+
+func Test_XMP_Update_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		fields  map[string]string
+		wantErr error
+	}{
+		{name: "no prefix", fields: map[string]string{"title": "x"}, wantErr: ErrInvalidProperty},
+		{name: "empty local", fields: map[string]string{"dc:": "x"}, wantErr: ErrInvalidProperty},
+		{name: "unknown namespace", fields: map[string]string{"foo:bar": "x"}, wantErr: ErrUnknownNamespace},
+		{name: "namespace declaration", fields: map[string]string{"xmlns:foo": "http://example.com/foo/"}, wantErr: ErrUnknownNamespace},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := XMP.Encode(tt.fields); !errors.Is(err, tt.wantErr) {
+				t.Errorf("want error: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func Test_XMP_Encode(t *testing.T) {
+	data, err := XMP.Encode(map[string]string{"dc:title": "T", "xmp:Rating": "4"})
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+
+	got, err := XMP.Decode(data)
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	want := map[string]string{"dc:title": "T", "xmp:Rating": "4"}
+	if !maps.Equal(got, want) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+	if !strings.HasPrefix(string(data), "<?xpacket begin=") {
+		t.Errorf("missing packet wrapper:\n%s", data)
+	}
+}
+
+func Test_XMP_Namespaces(t *testing.T) {
+	got, err := XMP.Namespaces([]byte(testPacket))
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	want := map[string]string{"acme": "http://example.com/acme/1.0/"}
+	if !maps.Equal(got, want) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+}
+
+func Test_XMP_UpdateNamespaces(t *testing.T) {
+	fields := map[string]string{"crs:Exposure2012": "+0.50", "dc:title": "T"}
+	namespaces := map[string]string{"crs": "http://ns.adobe.com/camera-raw-settings/1.0/"}
+	data, err := XMP.UpdateNamespaces(nil, fields, namespaces)
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+
+	got, err := XMP.Decode(data)
+	if err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+	if !maps.Equal(got, fields) {
+		t.Errorf("want: %v, got: %v", fields, got)
+	}
+	if got, _ := XMP.Namespaces(data); !maps.Equal(got, namespaces) {
+		t.Errorf("want: %v, got: %v", namespaces, got)
+	}
+}
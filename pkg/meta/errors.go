@@ -5,3 +5,13 @@ import "errors"
 var (
 	ErrUnsupportedMetaFormat = errors.New("unsupported meta format")
 )
+
+// The errors of the file types and codecs wrap these, so they can be told
+// apart whatever the file type.
+var (
+	ErrVendorNotSupported = errors.New("vendor not supported")
+	ErrNotSupported       = errors.New("not supported")
+	ErrNotFound           = errors.New("not found")
+	ErrCorrupted          = errors.New("corrupted")
+	ErrInvalid            = errors.New("invalid")
+)
@@ -0,0 +1,180 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/zzvanq/tinymedia/pkg/meta"
+	"github.com/zzvanq/tinymedia/pkg/meta/codec"
+	"github.com/zzvanq/tinymedia/pkg/meta/codec/exif"
+	"github.com/zzvanq/tinymedia/pkg/meta/codec/xmp"
+)
+
+// CopyOptions select the metadata Copy and ReadAll take.
+type CopyOptions struct {
+	// Vendors to copy, by default every vendor present in the source
+	// both file types support.
+	Vendors []codec.MetaCodecVendor
+	// Include and Exclude are path.Match patterns of the field names,
+	// all the fields are included by default.
+	Include []string
+	Exclude []string
+}
+
+// Metadata is what ReadAll reads from a file for WriteAll.
+type Metadata struct {
+	// Fields by vendor.
+	Fields map[codec.MetaCodecVendor]map[string]string
+	// Namespaces are the URIs of the prefixes of the XMP fields, as
+	// returned by xmp.XMP.Namespaces.
+	Namespaces map[string]string
+}
+
+// Copy writes the metadata of src selected by opts into dst.
+func Copy(dst, src MetaManager, opts CopyOptions) error {
+	meta, err := ReadAll(src, opts)
+	if err != nil {
+		return err
+	}
+	return WriteAll(dst, meta, len(opts.Vendors) > 0)
+}
+
+// ReadAll returns the fields selected by opts by vendor. Vendors without
+// selected fields are left out.
+func ReadAll(src MetaManager, opts CopyOptions) (Metadata, error) {
+	for _, pattern := range slices.Concat(opts.Include, opts.Exclude) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return Metadata{}, fmt.Errorf("%q: %w", pattern, err)
+		}
+	}
+
+	vendors := opts.Vendors
+	explicit := len(vendors) > 0
+	if !explicit {
+		var err error
+		if vendors, err = src.Vendors(); err != nil {
+			return Metadata{}, err
+		}
+	}
+
+	meta := Metadata{Fields: make(map[codec.MetaCodecVendor]map[string]string)}
+	for _, v := range vendors {
+		fields, err := src.Fields(v)
+		if err != nil {
+			if !explicit && IsVendorNotSupported(err) {
+				continue
+			}
+			return Metadata{}, fmt.Errorf("%s: %w", v, err)
+		}
+
+		maps.DeleteFunc(fields, func(k, _ string) bool {
+			return !selected(k, opts)
+		})
+		if len(fields) == 0 {
+			continue
+		}
+		meta.Fields[v] = fields
+		if v == codec.XMPVendor {
+			if meta.Namespaces, err = namespaces(src, fields); err != nil {
+				return Metadata{}, fmt.Errorf("%s: %w", v, err)
+			}
+		}
+	}
+	return meta, nil
+}
+
+// WriteAll upserts the fields by vendor into dst, but the ones the codec
+// can't write. The vendors dst doesn't support are skipped unless explicit
+// is set.
+func WriteAll(dst MetaManager, meta Metadata, explicit bool) error {
+	for _, v := range slices.Sorted(maps.Keys(meta.Fields)) {
+		fields := writable(v, meta.Fields[v])
+		if len(fields) == 0 {
+			continue
+		}
+		if err := upsert(dst, v, fields, meta.Namespaces); err != nil {
+			if !explicit && IsVendorNotSupported(err) {
+				continue
+			}
+			return fmt.Errorf("%s: %w", v, err)
+		}
+	}
+	return nil
+}
+
+// IsVendorNotSupported reports whether err is due to the file type not
+// supporting the vendor.
+func IsVendorNotSupported(err error) bool {
+	return errors.Is(err, meta.ErrVendorNotSupported)
+}
+
+// namespaces returns the URIs of the prefixes of the XMP fields of src
+// missing from xmp.Namespaces.
+func namespaces(src MetaManager, fields map[string]string) (map[string]string, error) {
+	pm, ok := src.(PayloadManager)
+	if !ok {
+		return nil, nil
+	}
+	data, err := pm.Payload(codec.XMPVendor)
+	if err != nil {
+		return nil, err
+	}
+	namespaces, err := xmp.XMP.Namespaces(data)
+	if err != nil {
+		return nil, err
+	}
+	used := make(map[string]bool)
+	for k := range fields {
+		prefix, _, _ := strings.Cut(k, ":")
+		used[prefix] = true
+	}
+	maps.DeleteFunc(namespaces, func(prefix, _ string) bool { return !used[prefix] })
+	return namespaces, nil
+}
+
+// upsert upserts the fields, declaring the XMP namespaces when dst allows.
+func upsert(dst MetaManager, v codec.MetaCodecVendor, fields, namespaces map[string]string) error {
+	pm, ok := dst.(PayloadManager)
+	if v != codec.XMPVendor || len(namespaces) == 0 || !ok {
+		return dst.Upsert(v, fields)
+	}
+	return pm.UpsertPayload(v, func(data []byte) ([]byte, error) {
+		return xmp.XMP.UpdateNamespaces(data, fields, namespaces)
+	})
+}
+
+// vendorCodecs are the codecs every manager stores the vendors with.
+var vendorCodecs = map[codec.MetaCodecVendor]codec.Codec{
+	codec.ExifVendor: exif.Exif,
+	codec.XMPVendor:  xmp.XMP,
+}
+
+// Writable reports whether the codec of the vendor writes the field, the
+// exif one leaves the image layout tags to the file.
+func Writable(v codec.MetaCodecVendor, field string) bool {
+	r, ok := vendorCodecs[v].(codec.Restricter)
+	return !ok || r.Writable(field)
+}
+
+func writable(v codec.MetaCodecVendor, fields map[string]string) map[string]string {
+	fields = maps.Clone(fields)
+	maps.DeleteFunc(fields, func(k, _ string) bool { return !Writable(v, k) })
+	return fields
+}
+
+func selected(field string, opts CopyOptions) bool {
+	matches := func(patterns []string) bool {
+		return slices.ContainsFunc(patterns, func(p string) bool {
+			ok, _ := path.Match(p, field)
+			return ok
+		})
+	}
+	if len(opts.Include) > 0 && !matches(opts.Include) {
+		return false
+	}
+	return !matches(opts.Exclude)
+}
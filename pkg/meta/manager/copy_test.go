@@ -0,0 +1,156 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"maps"
+	"testing"
+
+	"github.com/zzvanq/tinymedia/internal/meta/manager/jpeg"
+	"github.com/zzvanq/tinymedia/internal/meta/manager/png"
+	"github.com/zzvanq/tinymedia/pkg/meta/codec"
+	"github.com/zzvanq/tinymedia/pkg/meta/codec/xmp"
+)
+
+// emptyPNG is a PNG with IHDR, IDAT and IEND chunks.
+var emptyPNG = []byte{
+	0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A,
+	0x00, 0x00, 0x00, 0x0D, 'I', 'H', 'D', 'R',
+	0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 0x08, 0x00, 0x00, 0x00, 0x00,
+	0x3A, 0x7E, 0x9B, 0x55,
+	0x00, 0x00, 0x00, 0x00, 'I', 'D', 'A', 'T', 0x35, 0xAF, 0x06, 0x1E,
+	0x00, 0x00, 0x00, 0x00, 'I', 'E', 'N', 'D', 0xAE, 0x42, 0x60, 0x82,
+}
+
+func Test_Copy(t *testing.T) {
+	src, _ := jpeg.NewJpegMetaManager(bytes.NewReader([]byte{0xFF, 0xD8, 0xFF, 0xDA, 0x00, 0x02}))
+	src.Upsert(codec.TinyMetaVendor, map[string]string{"artist": "a", "title": "t", "note": "n"})
+	src.Upsert(codec.ExifVendor, map[string]string{"Artist": "a", "Copyright": "c"})
+	src.Upsert(codec.XMPVendor, map[string]string{"dc:title": "t", "xmp:Rating": "5"})
+	data, _ := io.ReadAll(src.FileReader())
+	src, _ = jpeg.NewJpegMetaManager(bytes.NewReader(data))
+
+	dst, err := png.NewPngMetaManager(bytes.NewReader(emptyPNG))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := CopyOptions{Include: []string{"*t*"}, Exclude: []string{"xmp:*", "note"}}
+	if err := Copy(dst, src, opts); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+
+	data, _ = io.ReadAll(dst.FileReader())
+	dst, _ = png.NewPngMetaManager(bytes.NewReader(data))
+	want := map[codec.MetaCodecVendor]map[string]string{
+		codec.TinyMetaVendor: {"artist": "a", "title": "t"},
+		codec.ExifVendor:     {"Artist": "a", "Copyright": "c"},
+		codec.XMPVendor:      {"dc:title": "t"},
+	}
+	for vendor, fields := range want {
+		got, err := dst.Fields(vendor)
+		if err != nil {
+			t.Fatalf("%s: want error: %v, got: %v", vendor, nil, err)
+		}
+		if !maps.Equal(got, fields) {
+			t.Errorf("%s: want: %v, got: %v", vendor, fields, got)
+		}
+	}
+}
+
+// testExif returns a little-endian TIFF as cameras write it, with image
+// and exposure tags the codec reads but doesn't write.
+func testExif() []byte {
+	le := binary.LittleEndian
+	b := []byte("II*\x00\x08\x00\x00\x00")
+	entry := func(tag, typ uint16, count, value uint32) {
+		b = le.AppendUint16(b, tag)
+		b = le.AppendUint16(b, typ)
+		b = le.AppendUint32(b, count)
+		b = le.AppendUint32(b, value)
+	}
+
+	// IFD0, its Make value and the Exif IFD with its ExposureTime value
+	makeAt := uint32(8 + 2 + 3*12 + 4)
+	exifAt := makeAt + 6
+	b = le.AppendUint16(b, 3)
+	entry(0x0100, 3, 1, 4000)
+	entry(0x010F, 2, 6, makeAt)
+	entry(0x8769, 4, 1, exifAt)
+	b = le.AppendUint32(b, 0)
+	b = append(b, "Canon\x00"...)
+	b = le.AppendUint16(b, 1)
+	entry(0x829A, 5, 1, exifAt+2+12+4)
+	b = le.AppendUint32(b, 0)
+	b = le.AppendUint32(b, 1)
+	return le.AppendUint32(b, 250)
+}
+
+const testXMP = `<x:xmpmeta xmlns:x="adobe:ns:meta/">` +
+	`<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` +
+	`<rdf:Description rdf:about="" xmlns:crs="http://ns.adobe.com/camera-raw-settings/1.0/" crs:Exposure2012="+0.50"/>` +
+	`</rdf:RDF></x:xmpmeta>`
+
+// testJPEG returns a JPEG with the APP1 segments of the payloads.
+func testJPEG(payloads ...[]byte) []byte {
+	data := []byte{0xFF, 0xD8}
+	for _, p := range payloads {
+		data = append(data, 0xFF, 0xE1)
+		data = binary.BigEndian.AppendUint16(data, uint16(2+len(p)))
+		data = append(data, p...)
+	}
+	return append(data, 0xFF, 0xDA, 0x00, 0x02)
+}
+
+func Test_Copy_Camera(t *testing.T) {
+	src, err := jpeg.NewJpegMetaManager(bytes.NewReader(testJPEG(
+		append([]byte("Exif\x00\x00"), testExif()...),
+		append([]byte("http://ns.adobe.com/xap/1.0/\x00"), testXMP...),
+	)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := src.Fields(codec.ExifVendor); got["ImageWidth"] != "4000" || got["ExposureTime"] != "1/250" {
+		t.Fatalf("want the camera tags, got: %v", got)
+	}
+
+	dst, _ := png.NewPngMetaManager(bytes.NewReader(emptyPNG))
+	if err := Copy(dst, src, CopyOptions{}); err != nil {
+		t.Fatalf("want error: %v, got: %v", nil, err)
+	}
+
+	data, _ := io.ReadAll(dst.FileReader())
+	dst, _ = png.NewPngMetaManager(bytes.NewReader(data))
+	want := map[codec.MetaCodecVendor]map[string]string{
+		codec.ExifVendor: {"Make": "Canon"},
+		codec.XMPVendor:  {"crs:Exposure2012": "+0.50"},
+	}
+	for vendor, fields := range want {
+		got, err := dst.Fields(vendor)
+		if err != nil {
+			t.Fatalf("%s: want error: %v, got: %v", vendor, nil, err)
+		}
+		if !maps.Equal(got, fields) {
+			t.Errorf("%s: want: %v, got: %v", vendor, fields, got)
+		}
+	}
+
+	data, _ = dst.Payload(codec.XMPVendor)
+	namespaces, _ := xmp.XMP.Namespaces(data)
+	wantNamespaces := map[string]string{"crs": "http://ns.adobe.com/camera-raw-settings/1.0/"}
+	if !maps.Equal(namespaces, wantNamespaces) {
+		t.Errorf("want: %v, got: %v", wantNamespaces, namespaces)
+	}
+}
+
+func Test_Copy_Errors(t *testing.T) {
+	src, _ := jpeg.NewJpegMetaManager(bytes.NewReader([]byte{0xFF, 0xD8, 0xFF, 0xDA, 0x00, 0x02}))
+	dst, _ := png.NewPngMetaManager(bytes.NewReader(emptyPNG))
+
+	if err := Copy(dst, src, CopyOptions{Vendors: []codec.MetaCodecVendor{codec.TinyMetaVendor}}); err == nil {
+		t.Errorf("want error: %v, got: %v", jpeg.ErrMarkerNotFound, err)
+	}
+	if err := Copy(dst, src, CopyOptions{Include: []string{"["}}); err == nil {
+		t.Errorf("want bad pattern error, got: %v", err)
+	}
+}
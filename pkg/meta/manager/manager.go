@@ -3,7 +3,13 @@ package manager
 import (
 	"io"
 
+	"github.com/zzvanq/tinymedia/internal/meta/manager/gif"
+	"github.com/zzvanq/tinymedia/internal/meta/manager/isobmff"
 	"github.com/zzvanq/tinymedia/internal/meta/manager/jpeg"
+	"github.com/zzvanq/tinymedia/internal/meta/manager/mp3"
+	"github.com/zzvanq/tinymedia/internal/meta/manager/png"
+	"github.com/zzvanq/tinymedia/internal/meta/manager/tiff"
+	"github.com/zzvanq/tinymedia/internal/meta/manager/webp"
 	"github.com/zzvanq/tinymedia/pkg/file"
 	"github.com/zzvanq/tinymedia/pkg/meta/codec"
 )
@@ -12,13 +18,61 @@ type MetaManager interface {
 	Insert(vendor codec.MetaCodecVendor, fields map[string]string) error
 	Upsert(vendor codec.MetaCodecVendor, fields map[string]string) error
 	Extract(vendor codec.MetaCodecVendor, fields ...string) (map[string]string, error)
+	// Fields returns all the fields of the vendor.
+	Fields(vendor codec.MetaCodecVendor) (map[string]string, error)
+	// Vendors lists the vendors present in the file, unknown ones included.
+	Vendors() ([]codec.MetaCodecVendor, error)
+	// Delete removes the fields, dropping the vendor payload once it's empty.
+	Delete(vendor codec.MetaCodecVendor, fields ...string) error
+	// Strip removes the whole payloads of the vendors.
+	Strip(vendors ...codec.MetaCodecVendor) error
+	// StripAll removes all the metadata not needed to render the file.
+	StripAll() error
 	FileReader() io.Reader
 }
 
+// InPlaceWriter is implemented by managers able to update the file
+// without rewriting it, as long as the metadata fits the reserved padding.
+type InPlaceWriter interface {
+	// Reserve sets the padding written by FileReader.
+	Reserve(size int) error
+	// WriteInPlace writes the updated metadata over the original file.
+	WriteInPlace(w io.WriterAt) error
+}
+
+// PayloadManager is implemented by managers giving the encoded payloads,
+// for what the codecs keep besides the fields, e.g. the XMP namespaces.
+type PayloadManager interface {
+	// Payload returns the encoded payload of the vendor.
+	Payload(vendor codec.MetaCodecVendor) ([]byte, error)
+	// UpsertPayload replaces the payload of the vendor with the one update
+	// returns for it, given nil when there's none.
+	UpsertPayload(vendor codec.MetaCodecVendor, update func(data []byte) ([]byte, error)) error
+}
+
+// ErrNoRoomInPlace is returned by WriteInPlace when the file has to be
+// rewritten as a whole.
+var ErrNoRoomInPlace = jpeg.ErrNoRoomInPlace
+
+// MaxPadding is the largest size Reserve accepts.
+const MaxPadding = jpeg.PaddingMaxSize
+
 func NewMetaManager(r io.Reader, ftype file.FileType) (MetaManager, error) {
 	switch ftype {
 	case file.FileTypeJPEG:
 		return jpeg.NewJpegMetaManager(r)
+	case file.FileTypePNG:
+		return png.NewPngMetaManager(r)
+	case file.FileTypeGIF:
+		return gif.NewGifMetaManager(r)
+	case file.FileTypeWebP:
+		return webp.NewWebpMetaManager(r)
+	case file.FileTypeTIFF:
+		return tiff.NewTiffMetaManager(r)
+	case file.FileTypeISOBMFF:
+		return isobmff.NewIsobmffMetaManager(r)
+	case file.FileTypeMP3:
+		return mp3.NewMp3MetaManager(r)
 	default:
 		return nil, file.ErrUnsupportedFileType
 	}
@@ -6,7 +6,13 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/zzvanq/tinymedia/internal/meta/manager/gif"
+	"github.com/zzvanq/tinymedia/internal/meta/manager/isobmff"
 	"github.com/zzvanq/tinymedia/internal/meta/manager/jpeg"
+	"github.com/zzvanq/tinymedia/internal/meta/manager/mp3"
+	"github.com/zzvanq/tinymedia/internal/meta/manager/png"
+	"github.com/zzvanq/tinymedia/internal/meta/manager/tiff"
+	"github.com/zzvanq/tinymedia/internal/meta/manager/webp"
 	"github.com/zzvanq/tinymedia/pkg/file"
 )
 
@@ -23,8 +29,44 @@ func Test_NewMetaManager(t *testing.T) {
 			want:    &jpeg.JpegMetaManager{},
 			wantErr: nil,
 		},
+		{
+			name:    "png",
+			r:       bytes.NewReader([]byte{0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A}),
+			want:    &png.PngMetaManager{},
+			wantErr: nil,
+		},
 		{
 			name:    "gif",
+			r:       bytes.NewReader([]byte{0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00}),
+			want:    &gif.GifMetaManager{},
+			wantErr: nil,
+		},
+		{
+			name:    "webp",
+			r:       bytes.NewReader([]byte("RIFF\x04\x00\x00\x00WEBP")),
+			want:    &webp.WebpMetaManager{},
+			wantErr: nil,
+		},
+		{
+			name:    "tiff",
+			r:       bytes.NewReader([]byte("MM\x00*\x00\x00\x00\x08")),
+			want:    &tiff.TiffMetaManager{},
+			wantErr: nil,
+		},
+		{
+			name:    "isobmff",
+			r:       bytes.NewReader([]byte("\x00\x00\x00\x10ftypheic\x00\x00\x00\x00")),
+			want:    &isobmff.IsobmffMetaManager{},
+			wantErr: nil,
+		},
+		{
+			name:    "mp3",
+			r:       bytes.NewReader([]byte{0xFF, 0xFB, 0x90, 0x00}),
+			want:    &mp3.Mp3MetaManager{},
+			wantErr: nil,
+		},
+		{
+			name:    "unsupported",
 			r:       bytes.NewReader([]byte{0x47, 0x49, 0x46, 0x38}),
 			want:    nil,
 			wantErr: file.ErrUnsupportedFileType,